@@ -19,18 +19,70 @@ package v1alpha1
 import (
 	netv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ACLMode defines if the rules generated for an ACL are enforced.
+// +kubebuilder:validation:Enum=Enforce;Audit
+type ACLMode string
+
+const (
+	// ACLModeEnforce applies the generated policy to the cluster.
+	ACLModeEnforce ACLMode = "Enforce"
+
+	// ACLModeAudit only reports the generated policy on the status of the
+	// ACL, the policy currently applied is kept untouched. An ACL enforced
+	// before keeps its last enforced policy objects while in Audit mode.
+	ACLModeAudit ACLMode = "Audit"
+)
+
+// ACLAction defines if the traffic to a destination is allowed or denied.
+// +kubebuilder:validation:Enum=Allow;Deny
+type ACLAction string
+
+const (
+	// ACLActionAllow allows the traffic to the destination.
+	ACLActionAllow ACLAction = "Allow"
+
+	// ACLActionDeny denies the traffic to the destination regardless of
+	// other allow rules, only some policy backends support it.
+	ACLActionDeny ACLAction = "Deny"
 )
 
 // ACLSpec defines the desired state of ACL
 type ACLSpec struct {
 	Source       ACLSpecSource        `json:"source"`
-	Destinations []ACLSpecDestination `json:"destinations"`
+	Destinations []ACLSpecDestination `json:"destinations,omitempty"`
+
+	// AllowedFrom restricts the inbound traffic of the source, when empty
+	// the ingress of the source is not managed by the ACL.
+	AllowedFrom []ACLSpecAllowedFrom `json:"allowedFrom,omitempty"`
+
+	// Mode defines if the ACL is enforced, when empty the default mode of
+	// the operator is used. Audit only leaves the traffic unrestricted for
+	// ACLs that were never enforced: switching an enforced ACL to Audit does
+	// not remove its policy objects, the policy last enforced is kept as is
+	// and the audit diff is computed against it. Delete the ACL to stop
+	// enforcing it.
+	Mode ACLMode `json:"mode,omitempty"`
 }
 
 type ACLSpecSource struct {
 	TsuruApp      string                `json:"tsuruApp,omitempty"`
 	TsuruJob      string                `json:"tsuruJob,omitempty"`
 	RpaasInstance *ACLSpecRpaasInstance `json:"rpaasInstance,omitempty"`
+
+	// TsuruAppProcess restricts the TsuruApp source to the pods of a process
+	TsuruAppProcess string `json:"tsuruAppProcess,omitempty"`
+
+	// TsuruAppPool selects the pods of every app of the pool
+	TsuruAppPool string `json:"tsuruAppPool,omitempty"`
+
+	// TsuruTeam selects the pods of every app owned by the team
+	TsuruTeam string `json:"tsuruTeam,omitempty"`
+
+	// PodSelector selects the pods of the ACL namespace by their labels
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
 }
 
 type ACLSpecRpaasInstance struct {
@@ -41,28 +93,73 @@ type ACLSpecRpaasInstance struct {
 type ACLSpecDestination struct {
 	RuleID string `json:"ruleID,omitempty"`
 
+	TsuruApp          string                    `json:"tsuruApp,omitempty"`
+	TsuruAppPool      string                    `json:"tsuruAppPool,omitempty"`
+	RpaasInstance     *ACLSpecRpaasInstance     `json:"rpaasInstance,omitempty"`
+	ExternalDNS       *ACLSpecExternalDNS       `json:"externalDNS,omitempty"`
+	ExternalIP        *ACLSpecExternalIP        `json:"externalIP,omitempty"`
+	KubernetesService *ACLSpecKubernetesService `json:"kubernetesService,omitempty"`
+
+	// Ports restricts the ports allowed on TsuruApp, TsuruAppPool and
+	// RpaasInstance destinations, all ports are allowed when empty.
+	Ports ACLSpecProtoPorts `json:"ports,omitempty"`
+
+	// Action of the destination, Allow when empty
+	Action ACLAction `json:"action,omitempty"`
+}
+
+type ACLSpecKubernetesService struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// ClusterName is the cluster where the service runs, services of other
+	// clusters than the one managed by the operator are not resolved.
+	ClusterName string `json:"clusterName,omitempty"`
+}
+
+type ACLSpecAllowedFrom struct {
+	RuleID string `json:"ruleID,omitempty"`
+
 	TsuruApp      string                `json:"tsuruApp,omitempty"`
 	TsuruAppPool  string                `json:"tsuruAppPool,omitempty"`
 	RpaasInstance *ACLSpecRpaasInstance `json:"rpaasInstance,omitempty"`
-	ExternalDNS   *ACLSpecExternalDNS   `json:"externalDNS,omitempty"`
 	ExternalIP    *ACLSpecExternalIP    `json:"externalIP,omitempty"`
+
+	// Ports restricts the ports of the source reachable from TsuruApp,
+	// TsuruAppPool and RpaasInstance, all ports are allowed when empty.
+	Ports ACLSpecProtoPorts `json:"ports,omitempty"`
 }
 
 type ACLSpecExternalDNS struct {
 	Name  string            `json:"name"`
 	Ports ACLSpecProtoPorts `json:"ports,omitempty"`
+
+	// SyncWholeNetwork allows the whole network of each resolved address
+	SyncWholeNetwork bool `json:"syncWholeNetwork,omitempty"`
 }
 
 type ACLSpecExternalIP struct {
 	IP    string            `json:"ip"`
 	Ports ACLSpecProtoPorts `json:"ports,omitempty"`
+
+	// Except lists the CIDRs inside IP that must not be allowed
+	Except []string `json:"except,omitempty"`
+
+	// SyncWholeNetwork allows the whole network of the address
+	SyncWholeNetwork bool `json:"syncWholeNetwork,omitempty"`
 }
 
 type ACLSpecProtoPorts []ProtoPort
 
 type ProtoPort struct {
 	Protocol string `json:"protocol"`
-	Number   uint16 `json:"number"`
+	Number   uint16 `json:"number,omitempty"`
+
+	// EndPort is the last port of a range starting at Number
+	EndPort uint16 `json:"endPort,omitempty"`
+
+	// Name is a named port of the pods, only in-cluster destinations support it
+	Name string `json:"name,omitempty"`
 }
 
 // ACLStatus defines the observed state of ACL
@@ -72,8 +169,35 @@ type ACLStatus struct {
 	Reason        string   `json:"reason,omitempty"`
 	WarningErrors []string `json:"warningErrors,omitempty"`
 
-	Stale      []ACLStatusStale     `json:"stale,omitempty"`
-	RuleErrors []ACLStatusRuleError `json:"errors,omitempty"`
+	// NetworkPolicies are the names of the policy objects of the ACL, the
+	// egress rules of large ACLs are split across NetworkPolicy-0..N
+	NetworkPolicies []string `json:"networkPolicies,omitempty"`
+
+	Stale        []ACLStatusStale        `json:"stale,omitempty"`
+	IngressStale []ACLStatusIngressStale `json:"ingressStale,omitempty"`
+	RuleErrors   []ACLStatusRuleError    `json:"errors,omitempty"`
+
+	// Audit is filled while the ACL runs in Audit mode
+	Audit *ACLStatusAudit `json:"audit,omitempty"`
+
+	// ObservedGeneration is the generation handled by the last reconcile
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+type ACLStatusAudit struct {
+	// Policy is the object that would be applied if the ACL was enforced, a
+	// List of the objects when the policy is sharded
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Policy runtime.RawExtension `json:"policy"`
+
+	// Diff holds an unified diff per policy object between the spec currently
+	// applied and the spec that would be applied, objects that would be
+	// removed are diffed against nothing
+	Diff string `json:"diff,omitempty"`
 }
 
 type ACLStatusStale struct {
@@ -81,6 +205,11 @@ type ACLStatusStale struct {
 	Rules  []netv1.NetworkPolicyEgressRule `json:"rules"`
 }
 
+type ACLStatusIngressStale struct {
+	RuleID string                           `json:"ruleID"`
+	Rules  []netv1.NetworkPolicyIngressRule `json:"rules"`
+}
+
 type ACLStatusRuleError struct {
 	RuleID string `json:"ruleID"`
 	Error  string `json:"error"`
@@ -89,6 +218,7 @@ type ACLStatusRuleError struct {
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Ready",type=boolean,JSONPath=`.status.ready`
+//+kubebuilder:printcolumn:name="Mode",type=string,JSONPath=`.spec.mode`
 
 // ACL is the Schema for the acls API
 type ACL struct {
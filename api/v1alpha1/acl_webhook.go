@@ -0,0 +1,427 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"strings"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+var supportedProtocols = []string{"TCP", "UDP", "SCTP"}
+
+func (r *ACL) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-extensions-tsuru-io-v1alpha1-acl,mutating=true,failurePolicy=fail,sideEffects=None,groups=extensions.tsuru.io,resources=acls,verbs=create;update,versions=v1alpha1,name=macl.extensions.tsuru.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &ACL{}
+
+// Default implements webhook.Defaulter, the destinations and allowedFrom
+// rules are normalized to keep the spec stable across updates.
+func (r *ACL) Default() {
+	r.Spec.Destinations = NormalizeDestinations(r.Spec.Destinations)
+
+	for i := range r.Spec.AllowedFrom {
+		if r.Spec.AllowedFrom[i].ExternalIP != nil {
+			normalizeExternalIP(r.Spec.AllowedFrom[i].ExternalIP)
+		}
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-extensions-tsuru-io-v1alpha1-acl,mutating=false,failurePolicy=fail,sideEffects=None,groups=extensions.tsuru.io,resources=acls,verbs=create;update,versions=v1alpha1,name=vacl.extensions.tsuru.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ACL{}
+
+// ValidateCreate implements webhook.Validator
+func (r *ACL) ValidateCreate() error {
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator
+func (r *ACL) ValidateUpdate(old runtime.Object) error {
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator
+func (r *ACL) ValidateDelete() error {
+	return nil
+}
+
+func (r *ACL) validate() error {
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	allErrs = append(allErrs, validateSource(specPath.Child("source"), r.Spec.Source)...)
+
+	for i, destination := range r.Spec.Destinations {
+		allErrs = append(allErrs, validateDestination(specPath.Child("destinations").Index(i), destination)...)
+	}
+
+	for i, allowedFrom := range r.Spec.AllowedFrom {
+		allErrs = append(allErrs, validateAllowedFrom(specPath.Child("allowedFrom").Index(i), allowedFrom)...)
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return k8sErrors.NewInvalid(GroupVersion.WithKind("ACL").GroupKind(), r.Name, allErrs)
+}
+
+// ValidateDestination runs the validation of the webhook on a single
+// destination, it's used on the destinations of ACLs created by the operator.
+func ValidateDestination(destination ACLSpecDestination) error {
+	return validateDestination(field.NewPath("destination"), destination).ToAggregate()
+}
+
+func validateSource(path *field.Path, source ACLSpecSource) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	targets := []string{}
+	if source.TsuruApp != "" {
+		targets = append(targets, "tsuruApp")
+	}
+	if source.TsuruJob != "" {
+		targets = append(targets, "tsuruJob")
+	}
+	if source.TsuruAppProcess != "" && source.TsuruApp == "" {
+		allErrs = append(allErrs, field.Forbidden(path.Child("tsuruAppProcess"), "may only be set together with tsuruApp"))
+	}
+	if source.RpaasInstance != nil {
+		targets = append(targets, "rpaasInstance")
+		allErrs = append(allErrs, validateRpaasInstance(path.Child("rpaasInstance"), source.RpaasInstance)...)
+	}
+	if source.TsuruAppPool != "" {
+		targets = append(targets, "tsuruAppPool")
+	}
+	if source.TsuruTeam != "" {
+		targets = append(targets, "tsuruTeam")
+	}
+	if source.PodSelector != nil {
+		targets = append(targets, "podSelector")
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(source.PodSelector, path.Child("podSelector"))...)
+	}
+
+	return append(allErrs, validateSingleTarget(path, targets)...)
+}
+
+func validateDestination(path *field.Path, destination ACLSpecDestination) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	targets := []string{}
+	if destination.TsuruApp != "" {
+		targets = append(targets, "tsuruApp")
+	}
+	if destination.TsuruAppPool != "" {
+		targets = append(targets, "tsuruAppPool")
+	}
+	if destination.RpaasInstance != nil {
+		targets = append(targets, "rpaasInstance")
+		allErrs = append(allErrs, validateRpaasInstance(path.Child("rpaasInstance"), destination.RpaasInstance)...)
+	}
+	if destination.ExternalDNS != nil {
+		targets = append(targets, "externalDNS")
+		allErrs = append(allErrs, validateExternalDNS(path.Child("externalDNS"), destination.ExternalDNS)...)
+	}
+	if destination.ExternalIP != nil {
+		targets = append(targets, "externalIP")
+		allErrs = append(allErrs, validateExternalIP(path.Child("externalIP"), destination.ExternalIP, false)...)
+	}
+	if destination.KubernetesService != nil {
+		targets = append(targets, "kubernetesService")
+		allErrs = append(allErrs, validateKubernetesService(path.Child("kubernetesService"), destination.KubernetesService)...)
+	}
+
+	if len(destination.Ports) > 0 {
+		if destination.TsuruApp == "" && destination.TsuruAppPool == "" && destination.RpaasInstance == nil {
+			allErrs = append(allErrs, field.Forbidden(path.Child("ports"), "only supported for tsuruApp, tsuruAppPool and rpaasInstance destinations"))
+		}
+		allErrs = append(allErrs, validateProtoPorts(path.Child("ports"), destination.Ports, true)...)
+	}
+
+	return append(allErrs, validateSingleTarget(path, targets)...)
+}
+
+func validateAllowedFrom(path *field.Path, allowedFrom ACLSpecAllowedFrom) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	targets := []string{}
+	if allowedFrom.TsuruApp != "" {
+		targets = append(targets, "tsuruApp")
+	}
+	if allowedFrom.TsuruAppPool != "" {
+		targets = append(targets, "tsuruAppPool")
+	}
+	if allowedFrom.RpaasInstance != nil {
+		targets = append(targets, "rpaasInstance")
+		allErrs = append(allErrs, validateRpaasInstance(path.Child("rpaasInstance"), allowedFrom.RpaasInstance)...)
+	}
+	if allowedFrom.ExternalIP != nil {
+		targets = append(targets, "externalIP")
+		allErrs = append(allErrs, validateExternalIP(path.Child("externalIP"), allowedFrom.ExternalIP, true)...)
+	}
+
+	if len(allowedFrom.Ports) > 0 {
+		if allowedFrom.TsuruApp == "" && allowedFrom.TsuruAppPool == "" && allowedFrom.RpaasInstance == nil {
+			allErrs = append(allErrs, field.Forbidden(path.Child("ports"), "only supported for tsuruApp, tsuruAppPool and rpaasInstance sources"))
+		}
+		allErrs = append(allErrs, validateProtoPorts(path.Child("ports"), allowedFrom.Ports, true)...)
+	}
+
+	return append(allErrs, validateSingleTarget(path, targets)...)
+}
+
+// validateSingleTarget ensures that exactly one of the targets is filled,
+// the controllers only handle the first target found.
+func validateSingleTarget(path *field.Path, targets []string) field.ErrorList {
+	if len(targets) == 0 {
+		return field.ErrorList{field.Required(path, "one target must be specified")}
+	}
+
+	if len(targets) > 1 {
+		return field.ErrorList{field.Invalid(path, strings.Join(targets, ", "), "only one target may be specified")}
+	}
+
+	return nil
+}
+
+func validateRpaasInstance(path *field.Path, rpaasInstance *ACLSpecRpaasInstance) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if rpaasInstance.ServiceName == "" {
+		allErrs = append(allErrs, field.Required(path.Child("serviceName"), ""))
+	}
+	if rpaasInstance.Instance == "" {
+		allErrs = append(allErrs, field.Required(path.Child("instance"), ""))
+	}
+	return allErrs
+}
+
+func validateExternalDNS(path *field.Path, externalDNS *ACLSpecExternalDNS) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if strings.TrimPrefix(externalDNS.Name, ".") == "" {
+		allErrs = append(allErrs, field.Required(path.Child("name"), ""))
+	}
+	return append(allErrs, validateProtoPorts(path.Child("ports"), externalDNS.Ports, false)...)
+}
+
+// validateExternalIP validates an external address, namedPorts is only true
+// for ingress rules where the ports belong to the pods of the source.
+func validateExternalIP(path *field.Path, externalIP *ACLSpecExternalIP, namedPorts bool) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if externalIP.IP == "" {
+		allErrs = append(allErrs, field.Required(path.Child("ip"), ""))
+	} else if !isValidIPOrCIDR(externalIP.IP) {
+		allErrs = append(allErrs, field.Invalid(path.Child("ip"), externalIP.IP, "must be a valid IP address or CIDR"))
+	} else {
+		allErrs = append(allErrs, validateExcept(path.Child("except"), externalIP.IP, externalIP.Except)...)
+	}
+	return append(allErrs, validateProtoPorts(path.Child("ports"), externalIP.Ports, namedPorts)...)
+}
+
+// validateExcept ensures that every except entry is a network strictly
+// contained in the allowed network, as required by the NetworkPolicy API.
+func validateExcept(path *field.Path, address string, except []string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	_, ipNet, _ := net.ParseCIDR(IPToCIDR(address))
+	ones, _ := ipNet.Mask.Size()
+
+	for i, exceptAddress := range except {
+		if !isValidIPOrCIDR(exceptAddress) {
+			allErrs = append(allErrs, field.Invalid(path.Index(i), exceptAddress, "must be a valid IP address or CIDR"))
+			continue
+		}
+
+		_, exceptNet, _ := net.ParseCIDR(IPToCIDR(exceptAddress))
+		exceptOnes, _ := exceptNet.Mask.Size()
+		if !ipNet.Contains(exceptNet.IP) || exceptOnes <= ones {
+			allErrs = append(allErrs, field.Invalid(path.Index(i), exceptAddress, "must be a network contained in "+address))
+		}
+	}
+
+	return allErrs
+}
+
+func validateKubernetesService(path *field.Path, kubernetesService *ACLSpecKubernetesService) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if kubernetesService.Namespace == "" {
+		allErrs = append(allErrs, field.Required(path.Child("namespace"), ""))
+	}
+	if kubernetesService.Name == "" {
+		allErrs = append(allErrs, field.Required(path.Child("name"), ""))
+	}
+	return allErrs
+}
+
+func validateProtoPorts(path *field.Path, ports ACLSpecProtoPorts, namedPorts bool) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, port := range ports {
+		portPath := path.Index(i)
+		if port.Protocol != "" && !isSupportedProtocol(port.Protocol) {
+			allErrs = append(allErrs, field.NotSupported(portPath.Child("protocol"), port.Protocol, supportedProtocols))
+		}
+
+		if port.Name != "" {
+			allErrs = append(allErrs, validateNamedPort(portPath, port, namedPorts)...)
+			continue
+		}
+
+		if port.Number == 0 {
+			allErrs = append(allErrs, field.Invalid(portPath.Child("number"), int(port.Number), "must be between 1 and 65535"))
+		}
+		if port.EndPort != 0 && port.EndPort < port.Number {
+			allErrs = append(allErrs, field.Invalid(portPath.Child("endPort"), int(port.EndPort), "must be greater than or equal to number"))
+		}
+	}
+	return allErrs
+}
+
+func validateNamedPort(path *field.Path, port ProtoPort, namedPorts bool) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if !namedPorts {
+		allErrs = append(allErrs, field.Forbidden(path.Child("name"), "named ports are only supported for in-cluster destinations"))
+	}
+	for _, msg := range validation.IsValidPortName(port.Name) {
+		allErrs = append(allErrs, field.Invalid(path.Child("name"), port.Name, msg))
+	}
+	if port.Number != 0 {
+		allErrs = append(allErrs, field.Forbidden(path.Child("number"), "may not be set together with name"))
+	}
+	if port.EndPort != 0 {
+		allErrs = append(allErrs, field.Forbidden(path.Child("endPort"), "may not be set together with name"))
+	}
+	return allErrs
+}
+
+func isSupportedProtocol(protocol string) bool {
+	for _, supported := range supportedProtocols {
+		if strings.EqualFold(protocol, supported) {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidIPOrCIDR(address string) bool {
+	if strings.Contains(address, "/") {
+		_, _, err := net.ParseCIDR(address)
+		return err == nil
+	}
+
+	return net.ParseIP(address) != nil
+}
+
+// NormalizeDestinations returns the destinations in their canonical form, DNS
+// names are lowercased, IPs are converted to network CIDRs, protocols are
+// uppercased, and identical destinations are removed. The result is sorted.
+func NormalizeDestinations(destinations []ACLSpecDestination) []ACLSpecDestination {
+	if destinations == nil {
+		return nil
+	}
+
+	result := make([]ACLSpecDestination, 0, len(destinations))
+	keys := map[string]bool{}
+
+	for _, destination := range destinations {
+		destination = *destination.DeepCopy()
+
+		if destination.ExternalDNS != nil {
+			destination.ExternalDNS.Name = strings.ToLower(destination.ExternalDNS.Name)
+			normalizeProtoPorts(destination.ExternalDNS.Ports)
+		}
+
+		if destination.ExternalIP != nil {
+			normalizeExternalIP(destination.ExternalIP)
+		}
+
+		normalizeProtoPorts(destination.Ports)
+
+		key := destinationKey(destination)
+		if keys[key] {
+			continue
+		}
+		keys[key] = true
+
+		result = append(result, destination)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return destinationKey(result[i]) < destinationKey(result[j])
+	})
+
+	return result
+}
+
+// IPToCIDR converts a bare IP address to a single address CIDR and CIDRs to
+// their network address, 10.0.0.1/24 becomes 10.0.0.0/24. Invalid addresses
+// return an empty string.
+func IPToCIDR(address string) string {
+	if !strings.Contains(address, "/") {
+		if net.ParseIP(address) == nil {
+			return ""
+		}
+
+		if strings.Contains(address, ":") {
+			address += "/128"
+		} else {
+			address += "/32"
+		}
+	}
+
+	_, ipNet, err := net.ParseCIDR(address)
+	if err != nil {
+		return ""
+	}
+
+	return ipNet.String()
+}
+
+func normalizeExternalIP(externalIP *ACLSpecExternalIP) {
+	if cidr := IPToCIDR(externalIP.IP); cidr != "" {
+		externalIP.IP = cidr
+	}
+	for i := range externalIP.Except {
+		if cidr := IPToCIDR(externalIP.Except[i]); cidr != "" {
+			externalIP.Except[i] = cidr
+		}
+	}
+	sort.Strings(externalIP.Except)
+	normalizeProtoPorts(externalIP.Ports)
+}
+
+func normalizeProtoPorts(ports ACLSpecProtoPorts) {
+	for i := range ports {
+		ports[i].Protocol = strings.ToUpper(ports[i].Protocol)
+	}
+}
+
+func destinationKey(destination ACLSpecDestination) string {
+	data, _ := json.Marshal(destination)
+	return string(data)
+}
@@ -0,0 +1,246 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestACLValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   ACLSpec
+		errors []string
+	}{
+		{
+			name: "valid",
+			spec: ACLSpec{
+				Source: ACLSpecSource{TsuruApp: "myapp"},
+				Destinations: []ACLSpecDestination{
+					{TsuruApp: "otherapp"},
+					{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.1"}},
+					{ExternalIP: &ACLSpecExternalIP{IP: "2001:db8::/32"}},
+					{ExternalDNS: &ACLSpecExternalDNS{Name: ".example.com", Ports: ACLSpecProtoPorts{{Protocol: "tcp", Number: 443}}}},
+					{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.2", Ports: ACLSpecProtoPorts{{Protocol: "udp", Number: 10000, EndPort: 20000}}}},
+				},
+				AllowedFrom: []ACLSpecAllowedFrom{
+					{TsuruAppPool: "my-pool"},
+					{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.3", Ports: ACLSpecProtoPorts{{Name: "http"}}}},
+				},
+			},
+		},
+		{
+			name: "source with multiple targets",
+			spec: ACLSpec{
+				Source: ACLSpecSource{TsuruApp: "myapp", TsuruJob: "myjob"},
+			},
+			errors: []string{`spec.source: Invalid value: "tsuruApp, tsuruJob": only one target may be specified`},
+		},
+		{
+			name: "process without app",
+			spec: ACLSpec{
+				Source: ACLSpecSource{TsuruJob: "myjob", TsuruAppProcess: "worker"},
+			},
+			errors: []string{`spec.source.tsuruAppProcess: Forbidden: may only be set together with tsuruApp`},
+		},
+		{
+			name: "invalid pod selector source",
+			spec: ACLSpec{
+				Source: ACLSpecSource{
+					TsuruAppPool: "my-pool",
+					PodSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpIn}},
+					},
+				},
+			},
+			errors: []string{
+				`spec.source.podSelector.matchExpressions[0].values: Required value`,
+				`spec.source: Invalid value: "tsuruAppPool, podSelector": only one target may be specified`,
+			},
+		},
+		{
+			name: "destination without target",
+			spec: ACLSpec{
+				Source:       ACLSpecSource{TsuruApp: "myapp"},
+				Destinations: []ACLSpecDestination{{RuleID: "empty"}},
+			},
+			errors: []string{`spec.destinations[0]: Required value: one target must be specified`},
+		},
+		{
+			name: "destination with multiple targets",
+			spec: ACLSpec{
+				Source: ACLSpecSource{TsuruApp: "myapp"},
+				Destinations: []ACLSpecDestination{
+					{TsuruApp: "otherapp", ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.1"}},
+				},
+			},
+			errors: []string{`spec.destinations[0]: Invalid value: "tsuruApp, externalIP": only one target may be specified`},
+		},
+		{
+			name: "malformed addresses",
+			spec: ACLSpec{
+				Source: ACLSpecSource{TsuruApp: "myapp"},
+				Destinations: []ACLSpecDestination{
+					{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.300"}},
+					{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.0/33"}},
+				},
+				AllowedFrom: []ACLSpecAllowedFrom{
+					{ExternalIP: &ACLSpecExternalIP{IP: "example.com"}},
+				},
+			},
+			errors: []string{
+				`spec.destinations[0].externalIP.ip: Invalid value: "10.0.0.300": must be a valid IP address or CIDR`,
+				`spec.destinations[1].externalIP.ip: Invalid value: "10.0.0.0/33": must be a valid IP address or CIDR`,
+				`spec.allowedFrom[0].externalIP.ip: Invalid value: "example.com": must be a valid IP address or CIDR`,
+			},
+		},
+		{
+			name: "invalid ports",
+			spec: ACLSpec{
+				Source: ACLSpecSource{TsuruApp: "myapp"},
+				Destinations: []ACLSpecDestination{
+					{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.1", Ports: ACLSpecProtoPorts{{Protocol: "icmp", Number: 80}, {Protocol: "udp"}}}},
+				},
+			},
+			errors: []string{
+				`spec.destinations[0].externalIP.ports[0].protocol: Unsupported value: "icmp": supported values: "TCP", "UDP", "SCTP"`,
+				`spec.destinations[0].externalIP.ports[1].number: Invalid value: 0: must be between 1 and 65535`,
+			},
+		},
+		{
+			name: "except networks",
+			spec: ACLSpec{
+				Source: ACLSpecSource{TsuruApp: "myapp"},
+				Destinations: []ACLSpecDestination{
+					{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.0/8", Except: []string{"10.1.0.0/16", "169.254.169.254", "192.168.0.0/24", "10.0.0.0/8", "invalid"}}},
+				},
+			},
+			errors: []string{
+				`spec.destinations[0].externalIP.except[2]: Invalid value: "192.168.0.0/24": must be a network contained in 10.0.0.0/8`,
+				`spec.destinations[0].externalIP.except[3]: Invalid value: "10.0.0.0/8": must be a network contained in 10.0.0.0/8`,
+				`spec.destinations[0].externalIP.except[4]: Invalid value: "invalid": must be a valid IP address or CIDR`,
+			},
+		},
+		{
+			name: "destination ports",
+			spec: ACLSpec{
+				Source: ACLSpecSource{TsuruApp: "myapp"},
+				Destinations: []ACLSpecDestination{
+					{TsuruApp: "otherapp", Ports: ACLSpecProtoPorts{{Protocol: "tcp", Number: 8080}, {Name: "grpc"}}},
+					{ExternalDNS: &ACLSpecExternalDNS{Name: "example.com"}, Ports: ACLSpecProtoPorts{{Protocol: "tcp", Number: 443}}},
+				},
+			},
+			errors: []string{
+				`spec.destinations[1].ports: Forbidden: only supported for tsuruApp, tsuruAppPool and rpaasInstance destinations`,
+			},
+		},
+		{
+			name: "allowedFrom ports",
+			spec: ACLSpec{
+				Source: ACLSpecSource{TsuruApp: "myapp"},
+				AllowedFrom: []ACLSpecAllowedFrom{
+					{TsuruApp: "otherapp", Ports: ACLSpecProtoPorts{{Protocol: "tcp", Number: 5432}, {Name: "grpc"}}},
+					{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.1"}, Ports: ACLSpecProtoPorts{{Protocol: "tcp", Number: 5432}}},
+				},
+			},
+			errors: []string{
+				`spec.allowedFrom[1].ports: Forbidden: only supported for tsuruApp, tsuruAppPool and rpaasInstance sources`,
+			},
+		},
+		{
+			name: "port ranges and named ports",
+			spec: ACLSpec{
+				Source: ACLSpecSource{TsuruApp: "myapp"},
+				Destinations: []ACLSpecDestination{
+					{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.1", Ports: ACLSpecProtoPorts{{Protocol: "udp", Number: 2000, EndPort: 1000}, {Name: "http"}}}},
+				},
+				AllowedFrom: []ACLSpecAllowedFrom{
+					{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.2", Ports: ACLSpecProtoPorts{{Name: "http"}, {Name: "Invalid_Name"}, {Name: "grpc", Number: 9000}}}},
+				},
+			},
+			errors: []string{
+				`spec.destinations[0].externalIP.ports[0].endPort: Invalid value: 1000: must be greater than or equal to number`,
+				`spec.destinations[0].externalIP.ports[1].name: Forbidden: named ports are only supported for in-cluster destinations`,
+				`spec.allowedFrom[0].externalIP.ports[1].name: Invalid value: "Invalid_Name"`,
+				`spec.allowedFrom[0].externalIP.ports[2].number: Forbidden: may not be set together with name`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acl := &ACL{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "default"},
+				Spec:       tt.spec,
+			}
+
+			err := acl.ValidateCreate()
+			if len(tt.errors) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			for _, expected := range tt.errors {
+				assert.Contains(t, err.Error(), expected)
+			}
+		})
+	}
+}
+
+func TestACLDefault(t *testing.T) {
+	acl := &ACL{
+		Spec: ACLSpec{
+			Source: ACLSpecSource{TsuruApp: "myapp"},
+			Destinations: []ACLSpecDestination{
+				{TsuruApp: "otherapp"},
+				{ExternalIP: &ACLSpecExternalIP{IP: "2001:db8::1", Ports: ACLSpecProtoPorts{{Protocol: "udp", Number: 53}}}},
+				{ExternalDNS: &ACLSpecExternalDNS{Name: "WWW.Example.com"}},
+				{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.1"}},
+				{ExternalDNS: &ACLSpecExternalDNS{Name: "www.example.com"}},
+				{TsuruApp: "otherapp"},
+				{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.1/8", Except: []string{"10.1.0.0/16", "10.0.0.1"}}},
+			},
+			AllowedFrom: []ACLSpecAllowedFrom{
+				{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.2", Ports: ACLSpecProtoPorts{{Protocol: "tcp", Number: 80}}}},
+			},
+		},
+	}
+
+	acl.Default()
+
+	assert.Equal(t, []ACLSpecDestination{
+		{ExternalDNS: &ACLSpecExternalDNS{Name: "www.example.com"}},
+		{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.0/8", Except: []string{"10.0.0.1/32", "10.1.0.0/16"}}},
+		{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.1/32"}},
+		{ExternalIP: &ACLSpecExternalIP{IP: "2001:db8::1/128", Ports: ACLSpecProtoPorts{{Protocol: "UDP", Number: 53}}}},
+		{TsuruApp: "otherapp"},
+	}, acl.Spec.Destinations)
+	assert.Equal(t, []ACLSpecAllowedFrom{
+		{ExternalIP: &ACLSpecExternalIP{IP: "10.0.0.2/32", Ports: ACLSpecProtoPorts{{Protocol: "TCP", Number: 80}}}},
+	}, acl.Spec.AllowedFrom)
+
+	destinations := NormalizeDestinations(acl.Spec.Destinations)
+	assert.Equal(t, acl.Spec.Destinations, destinations)
+}
+
+func TestIPToCIDR(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.1":        "10.0.0.1/32",
+		"10.0.0.1/32":     "10.0.0.1/32",
+		"10.0.0.1/24":     "10.0.0.0/24",
+		"2001:db8::1":     "2001:db8::1/128",
+		"2001:db8::1/32":  "2001:db8::/32",
+		"0.0.0.0/0":       "0.0.0.0/0",
+		"10.0.0.300":      "",
+		"10.0.0.1/33":     "",
+		"my-invalid-host": "",
+		"":                "",
+	}
+
+	for address, expected := range tests {
+		assert.Equal(t, expected, IPToCIDR(address), address)
+	}
+}
@@ -27,6 +27,27 @@ import (
 type ACLDNSEntrySpec struct {
 	Host          string   `json:"host"`
 	AdditionalIPs []string `json:"additionalIPs,omitempty"`
+
+	// Retention overrides the retention policy of the operator for this host
+	Retention *ACLDNSEntryRetention `json:"retention,omitempty"`
+}
+
+// ACLDNSEntryRetention bounds how long an address no longer answered by the
+// DNS stays allowed, the address is removed as soon as any limit is reached.
+// Addresses of the last resolution are always kept.
+type ACLDNSEntryRetention struct {
+	// Duration is how long an address is kept after it was last seen
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// MaxIPs is the maximum number of addresses kept, the ones seen least
+	// recently are removed first
+	//+kubebuilder:validation:Minimum=0
+	MaxIPs int32 `json:"maxIPs,omitempty"`
+
+	// KeepResolutions removes the addresses missing from the last N
+	// resolutions
+	//+kubebuilder:validation:Minimum=0
+	KeepResolutions int32 `json:"keepResolutions,omitempty"`
 }
 
 // ACLDNSEntryStatus defines the observed state of ACLDNSEntry
@@ -34,11 +55,58 @@ type ACLDNSEntryStatus struct {
 	IPs    []ACLDNSEntryStatusIP `json:"ips,omitempty"`
 	Ready  bool                  `json:"ready"`
 	Reason string                `json:"reason,omitempty"`
+
+	// TTL is the lowest TTL in seconds of the records of the last resolution
+	TTL int32 `json:"ttl,omitempty"`
+	// NextResolution is when the host will be resolved again
+	NextResolution *metav1.Time `json:"nextResolution,omitempty"`
+
+	// CNAMEs is the chain of canonical names followed by the last resolution
+	CNAMEs []string `json:"cnames,omitempty"`
+	// Nameserver is the nameserver that answered the last resolution
+	Nameserver string `json:"nameserver,omitempty"`
+	// History holds the last changes of the resolution results, the most
+	// recent first
+	History []ACLDNSEntryResolution `json:"history,omitempty"`
+
+	// ObservedGeneration is the generation handled by the last reconcile
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ACLDNSEntryResolution is a result of the resolution of the host, a new
+// one is only recorded when the addresses, the CNAME chain or the error
+// change.
+type ACLDNSEntryResolution struct {
+	// Time is the RFC3339 timestamp of the resolution
+	Time       string   `json:"time"`
+	IPs        []string `json:"ips,omitempty"`
+	CNAMEs     []string `json:"cnames,omitempty"`
+	Nameserver string   `json:"nameserver,omitempty"`
+	Error      string   `json:"error,omitempty"`
 }
 
 type ACLDNSEntryStatusIP struct {
-	Address    string `json:"address"`
-	ValidUntil string `json:"validUtil"`
+	Address string `json:"address"`
+
+	// FirstSeen, LastSeen and ValidUntil are RFC3339 timestamps
+	FirstSeen  string `json:"firstSeen,omitempty"`
+	LastSeen   string `json:"lastSeen,omitempty"`
+	ValidUntil string `json:"validUntil,omitempty"`
+
+	// TTL is the TTL in seconds of the record when it was last resolved
+	TTL int32 `json:"ttl,omitempty"`
+
+	// MissedResolutions is the number of resolutions since the address was
+	// last seen
+	MissedResolutions int32 `json:"missedResolutions,omitempty"`
+
+	// DeprecatedValidUntil is the day until the address was valid, written
+	// by previous versions of the operator under a misspelled key
+	DeprecatedValidUntil string `json:"validUtil,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,23 @@
+package v1alpha1
+
+// Condition types reported on the status of the resources.
+const (
+	// ConditionReady reports that the resource was fully reconciled.
+	ConditionReady = "Ready"
+
+	// ConditionResolved reports that the addresses of the resource were
+	// resolved on the last reconcile.
+	ConditionResolved = "Resolved"
+
+	// ConditionPolicyApplied reports that the generated policy is applied
+	// to the cluster.
+	ConditionPolicyApplied = "PolicyApplied"
+
+	// ConditionDegraded reports that some rules of the resource could not be
+	// generated.
+	ConditionDegraded = "Degraded"
+
+	// ConditionStale reports that some rules or addresses come from previous
+	// reconciles, because the current ones could not be generated.
+	ConditionStale = "Stale"
+)
@@ -0,0 +1,95 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PoolACLSpec defines the desired state of PoolACL
+type PoolACLSpec struct {
+	// Pool is the tsuru pool whose app pods are allowed to reach the destinations
+	Pool string `json:"pool"`
+
+	// Baseline renders the rules into the BaselineAdminNetworkPolicy, which
+	// applies only to traffic not matched by any NetworkPolicy. Otherwise the
+	// rules are rendered into an AdminNetworkPolicy, which takes precedence
+	// over the NetworkPolicies of the apps. The BaselineAdminNetworkPolicy is
+	// a singleton, only the pool of the oldest baseline PoolACL is rendered.
+	Baseline bool `json:"baseline,omitempty"`
+
+	// Priority of the AdminNetworkPolicy, lower values take precedence. When
+	// unset, the PoolACL gets the lowest priority from 500 on not used by other
+	// PoolACLs, which is kept in status.priority.
+	//+kubebuilder:validation:Minimum=0
+	//+kubebuilder:validation:Maximum=1000
+	Priority *int32 `json:"priority,omitempty"`
+
+	Destinations []ACLSpecDestination `json:"destinations"`
+}
+
+// PoolACLStatus defines the observed state of PoolACL
+type PoolACLStatus struct {
+	AdminNetworkPolicy string `json:"adminNetworkPolicy,omitempty"`
+	Ready              bool   `json:"ready"`
+	Reason             string `json:"reason,omitempty"`
+
+	// Priority is the priority of the AdminNetworkPolicy of the PoolACL
+	Priority *int32 `json:"priority,omitempty"`
+
+	// Egress holds the rules generated by the destinations, the baseline
+	// PoolACLs are merged from it into the BaselineAdminNetworkPolicy.
+	Egress     []netv1.NetworkPolicyEgressRule `json:"egress,omitempty"`
+	EgressDeny []netv1.NetworkPolicyEgressRule `json:"egressDeny,omitempty"`
+	RuleErrors []ACLStatusRuleError            `json:"errors,omitempty"`
+
+	// ObservedGeneration is the generation handled by the last reconcile
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Pool",type=string,JSONPath=`.spec.pool`
+//+kubebuilder:printcolumn:name="Ready",type=boolean,JSONPath=`.status.ready`
+
+// PoolACL is the Schema for the poolacls API
+type PoolACL struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PoolACLSpec   `json:"spec,omitempty"`
+	Status PoolACLStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PoolACLList contains a list of PoolACL
+type PoolACLList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PoolACL `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PoolACL{}, &PoolACLList{})
+}
@@ -33,6 +33,13 @@ type ResourceAddressStatus struct {
 	UpdatedAt string   `json:"updatedAt,omitempty"`
 	IPs       []string `json:"ips,omitempty"`
 	Pool      string   `json:"pool,omitempty"`
+
+	// ObservedGeneration is the generation handled by the last reconcile
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
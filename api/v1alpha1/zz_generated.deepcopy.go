@@ -22,8 +22,9 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"k8s.io/api/networking/v1"
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -112,6 +113,51 @@ func (in *ACLDNSEntryList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ACLDNSEntryResolution) DeepCopyInto(out *ACLDNSEntryResolution) {
+	*out = *in
+	if in.IPs != nil {
+		in, out := &in.IPs, &out.IPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CNAMEs != nil {
+		in, out := &in.CNAMEs, &out.CNAMEs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLDNSEntryResolution.
+func (in *ACLDNSEntryResolution) DeepCopy() *ACLDNSEntryResolution {
+	if in == nil {
+		return nil
+	}
+	out := new(ACLDNSEntryResolution)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ACLDNSEntryRetention) DeepCopyInto(out *ACLDNSEntryRetention) {
+	*out = *in
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLDNSEntryRetention.
+func (in *ACLDNSEntryRetention) DeepCopy() *ACLDNSEntryRetention {
+	if in == nil {
+		return nil
+	}
+	out := new(ACLDNSEntryRetention)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ACLDNSEntrySpec) DeepCopyInto(out *ACLDNSEntrySpec) {
 	*out = *in
@@ -120,6 +166,11 @@ func (in *ACLDNSEntrySpec) DeepCopyInto(out *ACLDNSEntrySpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(ACLDNSEntryRetention)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLDNSEntrySpec.
@@ -140,6 +191,29 @@ func (in *ACLDNSEntryStatus) DeepCopyInto(out *ACLDNSEntryStatus) {
 		*out = make([]ACLDNSEntryStatusIP, len(*in))
 		copy(*out, *in)
 	}
+	if in.NextResolution != nil {
+		in, out := &in.NextResolution, &out.NextResolution
+		*out = (*in).DeepCopy()
+	}
+	if in.CNAMEs != nil {
+		in, out := &in.CNAMEs, &out.CNAMEs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]ACLDNSEntryResolution, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLDNSEntryStatus.
@@ -210,6 +284,13 @@ func (in *ACLSpec) DeepCopyInto(out *ACLSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.AllowedFrom != nil {
+		in, out := &in.AllowedFrom, &out.AllowedFrom
+		*out = make([]ACLSpecAllowedFrom, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLSpec.
@@ -222,6 +303,36 @@ func (in *ACLSpec) DeepCopy() *ACLSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ACLSpecAllowedFrom) DeepCopyInto(out *ACLSpecAllowedFrom) {
+	*out = *in
+	if in.RpaasInstance != nil {
+		in, out := &in.RpaasInstance, &out.RpaasInstance
+		*out = new(ACLSpecRpaasInstance)
+		**out = **in
+	}
+	if in.ExternalIP != nil {
+		in, out := &in.ExternalIP, &out.ExternalIP
+		*out = new(ACLSpecExternalIP)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make(ACLSpecProtoPorts, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLSpecAllowedFrom.
+func (in *ACLSpecAllowedFrom) DeepCopy() *ACLSpecAllowedFrom {
+	if in == nil {
+		return nil
+	}
+	out := new(ACLSpecAllowedFrom)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ACLSpecDestination) DeepCopyInto(out *ACLSpecDestination) {
 	*out = *in
@@ -240,6 +351,16 @@ func (in *ACLSpecDestination) DeepCopyInto(out *ACLSpecDestination) {
 		*out = new(ACLSpecExternalIP)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.KubernetesService != nil {
+		in, out := &in.KubernetesService, &out.KubernetesService
+		*out = new(ACLSpecKubernetesService)
+		**out = **in
+	}
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make(ACLSpecProtoPorts, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLSpecDestination.
@@ -280,6 +401,11 @@ func (in *ACLSpecExternalIP) DeepCopyInto(out *ACLSpecExternalIP) {
 		*out = make(ACLSpecProtoPorts, len(*in))
 		copy(*out, *in)
 	}
+	if in.Except != nil {
+		in, out := &in.Except, &out.Except
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLSpecExternalIP.
@@ -292,6 +418,21 @@ func (in *ACLSpecExternalIP) DeepCopy() *ACLSpecExternalIP {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ACLSpecKubernetesService) DeepCopyInto(out *ACLSpecKubernetesService) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLSpecKubernetesService.
+func (in *ACLSpecKubernetesService) DeepCopy() *ACLSpecKubernetesService {
+	if in == nil {
+		return nil
+	}
+	out := new(ACLSpecKubernetesService)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in ACLSpecProtoPorts) DeepCopyInto(out *ACLSpecProtoPorts) {
 	{
@@ -334,6 +475,11 @@ func (in *ACLSpecSource) DeepCopyInto(out *ACLSpecSource) {
 		*out = new(ACLSpecRpaasInstance)
 		**out = **in
 	}
+	if in.PodSelector != nil {
+		in, out := &in.PodSelector, &out.PodSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLSpecSource.
@@ -354,6 +500,11 @@ func (in *ACLStatus) DeepCopyInto(out *ACLStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.NetworkPolicies != nil {
+		in, out := &in.NetworkPolicies, &out.NetworkPolicies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Stale != nil {
 		in, out := &in.Stale, &out.Stale
 		*out = make([]ACLStatusStale, len(*in))
@@ -361,11 +512,30 @@ func (in *ACLStatus) DeepCopyInto(out *ACLStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.IngressStale != nil {
+		in, out := &in.IngressStale, &out.IngressStale
+		*out = make([]ACLStatusIngressStale, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.RuleErrors != nil {
 		in, out := &in.RuleErrors, &out.RuleErrors
 		*out = make([]ACLStatusRuleError, len(*in))
 		copy(*out, *in)
 	}
+	if in.Audit != nil {
+		in, out := &in.Audit, &out.Audit
+		*out = new(ACLStatusAudit)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLStatus.
@@ -378,6 +548,44 @@ func (in *ACLStatus) DeepCopy() *ACLStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ACLStatusAudit) DeepCopyInto(out *ACLStatusAudit) {
+	*out = *in
+	in.Policy.DeepCopyInto(&out.Policy)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLStatusAudit.
+func (in *ACLStatusAudit) DeepCopy() *ACLStatusAudit {
+	if in == nil {
+		return nil
+	}
+	out := new(ACLStatusAudit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ACLStatusIngressStale) DeepCopyInto(out *ACLStatusIngressStale) {
+	*out = *in
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]networkingv1.NetworkPolicyIngressRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ACLStatusIngressStale.
+func (in *ACLStatusIngressStale) DeepCopy() *ACLStatusIngressStale {
+	if in == nil {
+		return nil
+	}
+	out := new(ACLStatusIngressStale)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ACLStatusRuleError) DeepCopyInto(out *ACLStatusRuleError) {
 	*out = *in
@@ -398,7 +606,7 @@ func (in *ACLStatusStale) DeepCopyInto(out *ACLStatusStale) {
 	*out = *in
 	if in.Rules != nil {
 		in, out := &in.Rules, &out.Rules
-		*out = make([]v1.NetworkPolicyEgressRule, len(*in))
+		*out = make([]networkingv1.NetworkPolicyEgressRule, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -415,6 +623,138 @@ func (in *ACLStatusStale) DeepCopy() *ACLStatusStale {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolACL) DeepCopyInto(out *PoolACL) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolACL.
+func (in *PoolACL) DeepCopy() *PoolACL {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolACL)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PoolACL) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolACLList) DeepCopyInto(out *PoolACLList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PoolACL, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolACLList.
+func (in *PoolACLList) DeepCopy() *PoolACLList {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolACLList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PoolACLList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolACLSpec) DeepCopyInto(out *PoolACLSpec) {
+	*out = *in
+	if in.Priority != nil {
+		in, out := &in.Priority, &out.Priority
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Destinations != nil {
+		in, out := &in.Destinations, &out.Destinations
+		*out = make([]ACLSpecDestination, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolACLSpec.
+func (in *PoolACLSpec) DeepCopy() *PoolACLSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolACLSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolACLStatus) DeepCopyInto(out *PoolACLStatus) {
+	*out = *in
+	if in.Priority != nil {
+		in, out := &in.Priority, &out.Priority
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Egress != nil {
+		in, out := &in.Egress, &out.Egress
+		*out = make([]networkingv1.NetworkPolicyEgressRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EgressDeny != nil {
+		in, out := &in.EgressDeny, &out.EgressDeny
+		*out = make([]networkingv1.NetworkPolicyEgressRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RuleErrors != nil {
+		in, out := &in.RuleErrors, &out.RuleErrors
+		*out = make([]ACLStatusRuleError, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolACLStatus.
+func (in *PoolACLStatus) DeepCopy() *PoolACLStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolACLStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProtoPort) DeepCopyInto(out *ProtoPort) {
 	*out = *in
@@ -438,6 +778,13 @@ func (in *ResourceAddressStatus) DeepCopyInto(out *ResourceAddressStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceAddressStatus.
@@ -36,11 +36,14 @@ type ProtoPorts []ProtoPort
 type ProtoPort struct {
 	Protocol string
 	Port     uint16
+	EndPort  uint16
+	Name     string
 }
 
 type TsuruAppRule struct {
-	AppName  string
-	PoolName string
+	AppName     string
+	PoolName    string
+	ProcessName string
 }
 
 type KubernetesServiceRule struct {
@@ -58,6 +61,7 @@ type ExternalDNSRule struct {
 type ExternalIPRule struct {
 	IP               string
 	Ports            ProtoPorts
+	Except           []string
 	SyncWholeNetwork bool
 }
 
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pmezard/go-difflib/difflib"
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// auditPolicy renders the shards of the policy of an ACL in Audit mode and
+// compares them with the policy objects currently applied, the previous
+// objects that enforcing the ACL would remove are compared with nothing.
+// Nothing is changed on the cluster.
+func (r *ACLReconciler) auditPolicy(ctx context.Context, backend PolicyBackend, acl *v1alpha1.ACL, shards []*ACLPolicy, previous []string) (*v1alpha1.ACLStatusAudit, error) {
+	desiredObjects := []interface{}{}
+	current := []string{}
+	diff := ""
+
+	for _, shard := range shards {
+		desired, err := backend.Render(acl, shard)
+		if err != nil {
+			return nil, fmt.Errorf("could not render policy object: %w", err)
+		}
+
+		desiredObject, err := auditObject(desired)
+		if err != nil {
+			return nil, err
+		}
+
+		existingObject, err := r.auditExistingObject(ctx, backend, client.ObjectKeyFromObject(desired))
+		if err != nil {
+			return nil, err
+		}
+
+		shardDiff, err := auditDiff(desired.GetName(), existingObject["spec"], desiredObject["spec"])
+		if err != nil {
+			return nil, err
+		}
+
+		desiredObjects = append(desiredObjects, desiredObject)
+		current = append(current, desired.GetName())
+		diff += shardDiff
+	}
+
+	for _, name := range stalePolicyNames(previous, current) {
+		existingObject, err := r.auditExistingObject(ctx, backend, client.ObjectKey{Namespace: acl.Namespace, Name: name})
+		if err != nil {
+			return nil, err
+		}
+
+		staleDiff, err := auditDiff(name, existingObject["spec"], nil)
+		if err != nil {
+			return nil, err
+		}
+		diff += staleDiff
+	}
+
+	var policy interface{} = desiredObjects[0]
+	if len(desiredObjects) > 1 {
+		policy = map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "List",
+			"items":      desiredObjects,
+		}
+	}
+
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1alpha1.ACLStatusAudit{
+		Policy: runtime.RawExtension{Raw: raw},
+		Diff:   diff,
+	}, nil
+}
+
+// auditExistingObject returns the unstructured form of the applied policy
+// object, an empty one when it does not exist.
+func (r *ACLReconciler) auditExistingObject(ctx context.Context, backend PolicyBackend, key client.ObjectKey) (map[string]interface{}, error) {
+	existing := backend.NewObject()
+	err := r.Client.Get(ctx, key, existing)
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return nil, fmt.Errorf("could not get policy object: %w", err)
+	} else if err != nil {
+		return map[string]interface{}{}, nil
+	}
+
+	return auditObject(existing)
+}
+
+// auditObject converts the policy object to its unstructured form, fields
+// filled by the API server are removed to keep the status stable.
+func auditObject(obj client.Object) (map[string]interface{}, error) {
+	result, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert policy object: %w", err)
+	}
+
+	unstructured.RemoveNestedField(result, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(result, "status")
+
+	return result, nil
+}
+
+// auditDiff compares the specs of the policy object with the given name, the
+// files of the diff are named after it.
+func auditDiff(name string, existingSpec, desiredSpec interface{}) (string, error) {
+	if existingSpec == nil && desiredSpec == nil {
+		return "", nil
+	}
+
+	lines := [2][]string{}
+	for i, spec := range []interface{}{existingSpec, desiredSpec} {
+		if spec == nil {
+			continue
+		}
+
+		data, err := yaml.Marshal(spec)
+		if err != nil {
+			return "", fmt.Errorf("could not marshal policy spec: %w", err)
+		}
+		lines[i] = difflib.SplitLines(string(data))
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        lines[0],
+		B:        lines[1],
+		FromFile: "applied/" + name,
+		ToFile:   "audit/" + name,
+		Context:  3,
+	})
+}
@@ -21,6 +21,7 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"reflect"
 	"regexp"
@@ -35,11 +36,15 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
@@ -51,13 +56,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var (
-	requeueAfter = getRequeueAfter()
-
-	desiredPolicyType = []netv1.PolicyType{
-		netv1.PolicyTypeEgress,
-	}
-)
+var requeueAfter = getRequeueAfter()
 
 func getRequeueAfter() time.Duration {
 	if v := os.Getenv("REQUEUE_AFTER"); v != "" {
@@ -69,9 +68,15 @@ func getRequeueAfter() time.Duration {
 }
 
 const (
-	externalDNSIndex   = "external-dns-name"
-	rpaasInstanceIndex = "rpaas-instance-name"
-	tsuruAppNameIndex  = "tsuru-app-name"
+	defaultWholeNetworkIPv4PrefixLength = 24
+	defaultWholeNetworkIPv6PrefixLength = 64
+)
+
+const (
+	externalDNSIndex       = "external-dns-name"
+	rpaasInstanceIndex     = "rpaas-instance-name"
+	tsuruAppNameIndex      = "tsuru-app-name"
+	kubernetesServiceIndex = "kubernetes-service"
 )
 
 // ACLReconciler reconciles a ACL object
@@ -80,6 +85,38 @@ type ACLReconciler struct {
 	Scheme   *runtime.Scheme
 	TsuruAPI tsuruapi.Client
 	Resolver ACLDNSResolver
+	Recorder record.EventRecorder
+
+	// ClusterName is the name of the cluster managed by the operator, used to
+	// match KubernetesService destinations.
+	ClusterName string
+
+	// WholeNetworkIPv4PrefixLength and WholeNetworkIPv6PrefixLength are the
+	// prefix lengths of the networks allowed by destinations with
+	// SyncWholeNetwork, defaults to /24 and /64.
+	WholeNetworkIPv4PrefixLength int
+	WholeNetworkIPv6PrefixLength int
+
+	// PolicyBackend defines which destinations are supported, defaults to
+	// NetworkPolicyBackend.
+	PolicyBackend PolicyBackend
+
+	// DefaultMode is the mode of ACLs without spec.mode, defaults to
+	// Enforce.
+	DefaultMode v1alpha1.ACLMode
+
+	// MaxPolicyEgressPeers is the maximum number of egress peers of a policy
+	// object, the rules of larger ACLs are split across multiple objects.
+	// Zero disables the sharding.
+	MaxPolicyEgressPeers int
+
+	// AggregateCIDRs collapses adjacent IP blocks of the egress rules into
+	// their covering CIDRs.
+	AggregateCIDRs bool
+
+	// DNSEntryReconciler resolves the ACLDNSEntries created by the ACLs with
+	// the configuration of the ACLDNSEntry controller.
+	DNSEntryReconciler *ACLDNSEntryReconciler
 
 	serviceCache atomic.Pointer[serviceCache]
 }
@@ -87,6 +124,9 @@ type ACLReconciler struct {
 //+kubebuilder:rbac:groups=extensions.tsuru.io,resources=acls,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=extensions.tsuru.io,resources=acls/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=extensions.tsuru.io,resources=acls/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=cilium.io,resources=ciliumnetworkpolicies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=projectcalico.org,resources=networkpolicies;globalnetworksets,verbs=get;list;watch;create;update;patch;delete
 
 func (r *ACLReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	l := log.FromContext(ctx)
@@ -101,39 +141,12 @@ func (r *ACLReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 
 	oldStatus := acl.Status.DeepCopy()
 
-	networkPolicy := &netv1.NetworkPolicy{}
-	networkPolicyName := acl.Status.NetworkPolicy
-	if networkPolicyName == "" {
-		networkPolicyName = "acl-" + req.Name
-	}
-
-	err = r.Get(ctx, client.ObjectKey{
-		Namespace: req.Namespace,
-		Name:      networkPolicyName,
-	}, networkPolicy)
-
-	if k8sErrors.IsNotFound(err) {
-	} else if err != nil {
-		l.Error(err, "could not get NetworkPolicy object")
-		return ctrl.Result{}, err
-	}
-
-	networkPolicyHasChanges := false
 	statusNeedsUpdate := false
-	networkPolicy.Namespace = acl.Namespace
-	networkPolicy.Name = networkPolicyName
+	backend := r.policyBackend()
 
-	if len(networkPolicy.OwnerReferences) == 0 {
-		networkPolicy.OwnerReferences = []metav1.OwnerReference{
-			*metav1.NewControllerRef(acl, acl.GroupVersionKind()),
-		}
-
-		networkPolicyHasChanges = true
-	}
-
-	if !reflect.DeepEqual(networkPolicy.Spec.PolicyTypes, desiredPolicyType) {
-		networkPolicy.Spec.PolicyTypes = desiredPolicyType
-		networkPolicyHasChanges = true
+	policyName := acl.Status.NetworkPolicy
+	if policyName == "" {
+		policyName = "acl-" + req.Name
 	}
 
 	podSelector := r.podSelectorForSource(acl.Spec.Source)
@@ -142,15 +155,12 @@ func (r *ACLReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return ctrl.Result{}, err
 	}
 
-	if !reflect.DeepEqual(networkPolicy.Spec.PodSelector.MatchLabels, podSelector) {
-		networkPolicy.Spec.PodSelector.MatchLabels = podSelector
-		networkPolicyHasChanges = true
-	}
-
 	newEgressRules := []netv1.NetworkPolicyEgressRule{}
+	newEgressDenyRules := []netv1.NetworkPolicyEgressRule{}
 
 	// TODO: think how to remove unused rules from stale
 	ruleIDErrors := map[string]string{}
+	ingressRuleIDErrors := map[string]string{}
 	ruleIDDestinations := map[string][]netv1.NetworkPolicyEgressRule{}
 
 	mapStaleEgress := map[string][]netv1.NetworkPolicyEgressRule{}
@@ -158,7 +168,35 @@ func (r *ACLReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		mapStaleEgress[stale.RuleID] = stale.Rules
 	}
 
+	nativeDestinations := []v1alpha1.ACLSpecDestination{}
+	nativeDestinationPorts := map[string][]netv1.NetworkPolicyPort{}
 	for _, destination := range acl.Spec.Destinations {
+		if err = backend.ValidateDestination(destination); err != nil {
+			l.Info("destination is not supported by the policy backend", "error", err.Error())
+			ruleIDErrors[ruleIDForDestination(destination)] = err.Error()
+			recordEvent(r.Recorder, acl, corev1.EventTypeWarning, eventReasonUnsupportedDestination, err.Error())
+			continue
+		}
+
+		if backend.IsNativeDestination(destination) {
+			if err = r.validateNativeDestination(destination); err != nil {
+				ruleIDErrors[ruleIDForDestination(destination)] = err.Error()
+				continue
+			}
+
+			ports, err := r.nativeDestinationPorts(ctx, destination)
+			if err != nil {
+				ruleIDErrors[ruleIDForDestination(destination)] = err.Error()
+				continue
+			}
+			if len(ports) > 0 {
+				nativeDestinationPorts[ruleIDForDestination(destination)] = ports
+			}
+
+			nativeDestinations = append(nativeDestinations, destination)
+			continue
+		}
+
 		egressRules, err := r.egressRulesForDestination(ctx, destination)
 		// TODO: think about inconsistences, or temporarrly inconsistences
 		if err != nil && destination.RuleID == "" {
@@ -170,16 +208,50 @@ func (r *ACLReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		} else if err != nil {
 			ruleIDErrors[destination.RuleID] = err.Error()
 			egressRules = mapStaleEgress[destination.RuleID] // try to use stale
+			r.recordRuleError(acl, destination.RuleID, len(egressRules) > 0, err)
 			ruleIDDestinations[destination.RuleID] = copyEgressRules(egressRules)
 		} else if destination.RuleID != "" {
 			ruleIDDestinations[destination.RuleID] = copyEgressRules(egressRules)
 		}
 
+		if destination.Action == v1alpha1.ACLActionDeny {
+			newEgressDenyRules = append(newEgressDenyRules, egressRules...)
+			continue
+		}
+
 		newEgressRules = append(newEgressRules, egressRules...)
 	}
 
+	newIngressRules := []netv1.NetworkPolicyIngressRule{}
+	ruleIDSources := map[string][]netv1.NetworkPolicyIngressRule{}
+
+	mapStaleIngress := map[string][]netv1.NetworkPolicyIngressRule{}
+	for _, stale := range acl.Status.IngressStale {
+		mapStaleIngress[stale.RuleID] = stale.Rules
+	}
+
+	for _, allowedFrom := range acl.Spec.AllowedFrom {
+		ingressRules, err := r.ingressRulesForAllowedFrom(ctx, allowedFrom)
+		if err != nil && allowedFrom.RuleID == "" {
+			allowedFromJSON, _ := json.Marshal(allowedFrom)
+			l.Error(err, "could not generate ingress rule for allowedFrom", "allowedFrom", string(allowedFromJSON))
+			err = r.setUnreadyStatus(ctx, acl, "could not generate ingress rule for allowedFrom "+string(allowedFromJSON)+", err: "+err.Error())
+			return ctrl.Result{}, err
+		} else if err != nil {
+			ingressRuleIDErrors[allowedFrom.RuleID] = err.Error()
+			ingressRules = mapStaleIngress[allowedFrom.RuleID] // try to use stale
+			r.recordRuleError(acl, allowedFrom.RuleID, len(ingressRules) > 0, err)
+			ruleIDSources[allowedFrom.RuleID] = copyIngressRules(ingressRules)
+		} else if allowedFrom.RuleID != "" {
+			ruleIDSources[allowedFrom.RuleID] = copyIngressRules(ingressRules)
+		}
+
+		newIngressRules = append(newIngressRules, ingressRules...)
+	}
+
 	acl.Status.Stale = make([]v1alpha1.ACLStatusStale, 0, len(ruleIDDestinations))
-	acl.Status.RuleErrors = make([]v1alpha1.ACLStatusRuleError, 0, len(ruleIDErrors))
+	acl.Status.IngressStale = nil
+	acl.Status.RuleErrors = make([]v1alpha1.ACLStatusRuleError, 0, len(ruleIDErrors)+len(ingressRuleIDErrors))
 
 	for ruleID, rules := range ruleIDDestinations {
 		acl.Status.Stale = append(acl.Status.Stale, v1alpha1.ACLStatusStale{
@@ -191,13 +263,33 @@ func (r *ACLReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return acl.Status.Stale[i].RuleID < acl.Status.Stale[j].RuleID
 	})
 
+	for ruleID, rules := range ruleIDSources {
+		acl.Status.IngressStale = append(acl.Status.IngressStale, v1alpha1.ACLStatusIngressStale{
+			RuleID: ruleID,
+			Rules:  rules,
+		})
+	}
+	sort.Slice(acl.Status.IngressStale, func(i, j int) bool {
+		return acl.Status.IngressStale[i].RuleID < acl.Status.IngressStale[j].RuleID
+	})
+
 	for ruleID, errStr := range ruleIDErrors {
 		acl.Status.RuleErrors = append(acl.Status.RuleErrors, v1alpha1.ACLStatusRuleError{
 			RuleID: ruleID,
 			Error:  errStr,
 		})
 	}
+	// destinations and allowedFrom may share ruleIDs, the errors of both are kept
+	for ruleID, errStr := range ingressRuleIDErrors {
+		acl.Status.RuleErrors = append(acl.Status.RuleErrors, v1alpha1.ACLStatusRuleError{
+			RuleID: ruleID,
+			Error:  errStr,
+		})
+	}
 	sort.Slice(acl.Status.RuleErrors, func(i, j int) bool {
+		if acl.Status.RuleErrors[i].RuleID == acl.Status.RuleErrors[j].RuleID {
+			return acl.Status.RuleErrors[i].Error < acl.Status.RuleErrors[j].Error
+		}
 		return acl.Status.RuleErrors[i].RuleID < acl.Status.RuleErrors[j].RuleID
 	})
 
@@ -205,57 +297,124 @@ func (r *ACLReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 	acl.Status.Reason = ""
 
 	newEgressRules, err = r.fillPodSelectorByCIDR(ctx, newEgressRules)
+	if err == nil {
+		newEgressDenyRules, err = r.fillPodSelectorByCIDR(ctx, newEgressDenyRules)
+	}
 	if err != nil {
 		l.Error(err, "could not generate egress rule based on kubernetes selector", "destination")
 		err = r.setUnreadyStatus(ctx, acl, "could not generate egress rule based on kubernetes selector, err: "+err.Error())
 		return ctrl.Result{}, err
 	}
 
-	if len(newEgressRules) == 0 {
+	newEgressRules = normalizeEgressRules(newEgressRules, r.AggregateCIDRs)
+	newEgressDenyRules = normalizeEgressRules(newEgressDenyRules, r.AggregateCIDRs)
+
+	if len(newEgressRules) == 0 && len(newEgressDenyRules) == 0 && len(nativeDestinations) == 0 && (len(acl.Spec.Destinations) > 0 || len(acl.Spec.AllowedFrom) == 0) {
 		err = r.setUnreadyStatus(ctx, acl, "No egress generated by spec.destinations")
 		return ctrl.Result{}, err
 	}
 
-	if !reflect.DeepEqual(oldStatus, acl.Status) {
-		statusNeedsUpdate = true
+	if len(newIngressRules) == 0 && len(acl.Spec.AllowedFrom) > 0 {
+		// an empty ingress list would deny all inbound traffic of the source
+		err = r.setUnreadyStatus(ctx, acl, "No ingress generated by spec.allowedFrom")
+		return ctrl.Result{}, err
 	}
 
-	if !reflect.DeepEqual(networkPolicy.Spec.Egress, newEgressRules) {
-		networkPolicy.Spec.Egress = newEgressRules
-		networkPolicyHasChanges = true
+	if len(newEgressRules) == 0 {
+		newEgressRules = nil
 	}
 
-	if networkPolicy.CreationTimestamp.IsZero() {
-		err = r.Create(ctx, networkPolicy)
+	if len(newEgressDenyRules) == 0 {
+		newEgressDenyRules = nil
+	}
+
+	if len(newIngressRules) == 0 {
+		newIngressRules = nil
+	}
+
+	policy := &ACLPolicy{
+		Name:               policyName,
+		PodSelector:        *podSelector,
+		PolicyTypes:        policyTypesForSpec(acl.Spec),
+		Egress:             newEgressRules,
+		EgressDeny:         newEgressDenyRules,
+		Ingress:            newIngressRules,
+		NativeDestinations: nativeDestinations,
+
+		NativeDestinationPorts: nativeDestinationPorts,
+	}
+
+	shards := shardPolicy(policy, r.MaxPolicyEgressPeers)
+	previousNames := previousPolicyNames(acl)
+
+	auditMode := r.modeForACL(acl) == v1alpha1.ACLModeAudit
+	acl.Status.Audit = nil
+	if auditMode {
+		acl.Status.Audit, err = r.auditPolicy(ctx, backend, acl, shards, previousNames)
 		if err != nil {
-			l.Error(err, "could not create NetworkPolicy object")
-			statusErr := r.setUnreadyStatus(ctx, acl, "could not create NetworkPolicy object, err: "+err.Error())
-			if statusErr != nil {
-				l.Error(err, "could not update status")
-			}
+			l.Error(err, "could not audit policy object", "backend", backend.Name())
+			err = r.setUnreadyStatus(ctx, acl, "could not audit policy object, err: "+err.Error())
 			return ctrl.Result{}, err
 		}
-		l.Info("NetworkPolicy object has been created")
+	}
 
-		acl.Status.NetworkPolicy = networkPolicy.Name
-		acl.Status.Ready = true
-		acl.Status.Reason = ""
-		statusNeedsUpdate = true
+	if auditMode {
+		setCondition(&acl.Status.Conditions, acl.Generation, v1alpha1.ConditionPolicyApplied, false, "AuditMode", "the ACL runs in Audit mode, the policy is not enforced")
+	} else {
+		shardNames := make([]string, 0, len(shards))
+
+		for _, shard := range shards {
+			var result controllerutil.OperationResult
+			result, err = backend.Ensure(ctx, r.Client, acl, shard)
+			if err != nil {
+				l.Error(err, "could not ensure policy object", "backend", backend.Name(), "policy", shard.Name)
+				setCondition(&acl.Status.Conditions, acl.Generation, v1alpha1.ConditionPolicyApplied, false, "ApplyFailed", err.Error())
+				statusErr := r.setUnreadyStatus(ctx, acl, "could not ensure policy object, err: "+err.Error())
+				if statusErr != nil {
+					l.Error(err, "could not update status")
+				}
+				return ctrl.Result{}, err
+			}
 
-	} else if networkPolicyHasChanges {
-		err = r.Update(ctx, networkPolicy)
-		if err != nil {
-			l.Error(err, "could not update NetworkPolicy object")
-			statusErr := r.setUnreadyStatus(ctx, acl, "could not update NetworkPolicy object, err: "+err.Error())
-			if statusErr != nil {
-				l.Error(err, "could not update status")
+			if result == controllerutil.OperationResultCreated {
+				l.Info("policy object has been created", "backend", backend.Name(), "policy", shard.Name)
+				recordEvent(r.Recorder, acl, corev1.EventTypeNormal, eventReasonPolicyCreated, fmt.Sprintf("%s policy %s has been created", backend.Name(), shard.Name))
+
+				acl.Status.NetworkPolicy = policy.Name
+				acl.Status.Ready = true
+				acl.Status.Reason = ""
+				statusNeedsUpdate = true
+
+			} else if result == controllerutil.OperationResultUpdated {
+				l.Info("policy object has been updated", "backend", backend.Name(), "policy", shard.Name)
+				recordEvent(r.Recorder, acl, corev1.EventTypeNormal, eventReasonPolicyUpdated, fmt.Sprintf("%s policy %s has been updated", backend.Name(), shard.Name))
+
+				acl.Status.NetworkPolicy = policy.Name
+				statusNeedsUpdate = true
 			}
+
+			shardNames = append(shardNames, shard.Name)
+		}
+
+		removed, err := removeStalePolicies(ctx, r.Client, backend, acl, previousNames, shardNames)
+		for _, name := range removed {
+			l.Info("policy object has been removed", "backend", backend.Name(), "policy", name)
+			recordEvent(r.Recorder, acl, corev1.EventTypeNormal, eventReasonPolicyRemoved, fmt.Sprintf("%s policy %s has been removed", backend.Name(), name))
+		}
+		if err != nil {
+			l.Error(err, "could not remove stale policy objects", "backend", backend.Name())
 			return ctrl.Result{}, err
 		}
 
-		l.Info("NetworkPolicy object has been updated")
+		acl.Status.NetworkPolicies = shardNames
+	}
+
+	if !auditMode {
+		setCondition(&acl.Status.Conditions, acl.Generation, v1alpha1.ConditionPolicyApplied, true, "PolicyApplied", "")
+	}
+	setACLConditions(acl)
 
-		acl.Status.NetworkPolicy = networkPolicy.Name
+	if !reflect.DeepEqual(oldStatus, &acl.Status) {
 		statusNeedsUpdate = true
 	}
 
@@ -278,6 +437,8 @@ func (r *ACLReconciler) setUnreadyStatus(ctx context.Context, acl *v1alpha1.ACL,
 
 	acl.Status.Ready = false
 	acl.Status.Reason = reason
+	setACLConditions(acl)
+	recordEvent(r.Recorder, acl, corev1.EventTypeWarning, eventReasonReconcileFailed, reason)
 
 	err := r.Status().Update(ctx, acl)
 	if err != nil {
@@ -286,43 +447,139 @@ func (r *ACLReconciler) setUnreadyStatus(ctx context.Context, acl *v1alpha1.ACL,
 	return err
 }
 
-func (r *ACLReconciler) podSelectorForSource(source v1alpha1.ACLSpecSource) map[string]string {
+// recordRuleError emits an event for a rule that could not be generated,
+// the rules of previous reconciles are kept when available.
+func (r *ACLReconciler) recordRuleError(acl *v1alpha1.ACL, ruleID string, hasStale bool, err error) {
+	if hasStale {
+		recordEvent(r.Recorder, acl, corev1.EventTypeWarning, eventReasonRuleFallbackToStale, fmt.Sprintf("using rules of previous reconciles for rule %s: %s", ruleID, err.Error()))
+		return
+	}
+
+	recordEvent(r.Recorder, acl, corev1.EventTypeWarning, eventReasonRuleFailed, fmt.Sprintf("could not generate rule %s: %s", ruleID, err.Error()))
+}
+
+func (r *ACLReconciler) policyBackend() PolicyBackend {
+	if r.PolicyBackend == nil {
+		return NetworkPolicyBackend
+	}
+	return r.PolicyBackend
+}
+
+func (r *ACLReconciler) modeForACL(acl *v1alpha1.ACL) v1alpha1.ACLMode {
+	if acl.Spec.Mode != "" {
+		return acl.Spec.Mode
+	}
+	if r.DefaultMode != "" {
+		return r.DefaultMode
+	}
+	return v1alpha1.ACLModeEnforce
+}
+
+// validateNativeDestination checks the destinations rendered by the policy
+// backend, which are not verified by the egress rule generation.
+func (r *ACLReconciler) validateNativeDestination(destination v1alpha1.ACLSpecDestination) error {
+	if destination.KubernetesService != nil {
+		return r.validateKubernetesServiceCluster(destination.KubernetesService)
+	}
+
+	return nil
+}
+
+// nativeDestinationPorts returns the ports of the native destinations that
+// are not in the spec, the ports of the pods behind kubernetes services.
+func (r *ACLReconciler) nativeDestinationPorts(ctx context.Context, destination v1alpha1.ACLSpecDestination) ([]netv1.NetworkPolicyPort, error) {
+	if destination.KubernetesService == nil {
+		return nil, nil
+	}
+
+	svc := &corev1.Service{}
+	err := r.Get(ctx, client.ObjectKey{
+		Namespace: destination.KubernetesService.Namespace,
+		Name:      destination.KubernetesService.Name,
+	}, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.servicePorts(svc.Spec.Ports, true), nil
+}
+
+func (r *ACLReconciler) podSelectorForSource(source v1alpha1.ACLSpecSource) *metav1.LabelSelector {
 	if source.TsuruApp != "" {
-		return r.podSelectorForTsuruApp(source.TsuruApp)
+		matchLabels := r.podSelectorForTsuruApp(source.TsuruApp)
+		if source.TsuruAppProcess != "" {
+			matchLabels["tsuru.io/app-process"] = source.TsuruAppProcess
+		}
+		return &metav1.LabelSelector{MatchLabels: matchLabels}
 	}
 
 	if source.TsuruJob != "" {
-		return r.podSelectorForTsuruJob(source.TsuruJob)
+		return &metav1.LabelSelector{MatchLabels: r.podSelectorForTsuruJob(source.TsuruJob)}
 	}
 
 	if source.RpaasInstance != nil {
-		return r.podSelectorForRpasInstance(source.RpaasInstance)
+		return &metav1.LabelSelector{MatchLabels: r.podSelectorForRpasInstance(source.RpaasInstance)}
+	}
+
+	if source.TsuruAppPool != "" {
+		return &metav1.LabelSelector{MatchLabels: map[string]string{
+			"tsuru.io/app-pool": source.TsuruAppPool,
+		}}
+	}
+
+	if source.TsuruTeam != "" {
+		// tsuru labels the app pods with the team owner of the app, see
+		// LabelAppTeamOwner of github.com/tsuru/tsuru/provision
+		return &metav1.LabelSelector{MatchLabels: map[string]string{
+			"tsuru.io/app-team": source.TsuruTeam,
+		}}
+	}
+
+	if source.PodSelector != nil {
+		return source.PodSelector.DeepCopy()
 	}
 
 	return nil
 }
 
+func policyTypesForSpec(spec v1alpha1.ACLSpec) []netv1.PolicyType {
+	policyTypes := []netv1.PolicyType{}
+
+	if len(spec.Destinations) > 0 || len(spec.AllowedFrom) == 0 {
+		policyTypes = append(policyTypes, netv1.PolicyTypeEgress)
+	}
+
+	if len(spec.AllowedFrom) > 0 {
+		policyTypes = append(policyTypes, netv1.PolicyTypeIngress)
+	}
+
+	return policyTypes
+}
+
 func (r *ACLReconciler) egressRulesForDestination(ctx context.Context, destination v1alpha1.ACLSpecDestination) ([]netv1.NetworkPolicyEgressRule, error) {
 	if destination.TsuruApp != "" {
-		return r.egressRulesForTsuruApp(ctx, destination.TsuruApp)
+		return r.egressRulesForTsuruApp(ctx, destination.TsuruApp, destination.Ports)
 	} else if destination.TsuruAppPool != "" {
-		return r.egressRulesForTsuruAppPool(ctx, destination.TsuruAppPool)
+		return r.egressRulesForTsuruAppPool(ctx, destination.TsuruAppPool, destination.Ports)
 	} else if destination.ExternalDNS != nil {
 		return r.egressRulesForExternalDNS(ctx, destination.ExternalDNS)
 	} else if destination.ExternalIP != nil {
 		return r.egressRulesForExternalIP(ctx, destination.ExternalIP)
 	} else if destination.RpaasInstance != nil {
-		return r.egressRulesForRpaasInstance(ctx, destination.RpaasInstance)
+		return r.egressRulesForRpaasInstance(ctx, destination.RpaasInstance, destination.Ports)
+	} else if destination.KubernetesService != nil {
+		return r.egressRulesForKubernetesService(ctx, destination.KubernetesService)
 	}
 	return nil, nil
 }
 
-func (r *ACLReconciler) egressRulesForTsuruApp(ctx context.Context, tsuruApp string) ([]netv1.NetworkPolicyEgressRule, error) {
+func (r *ACLReconciler) egressRulesForTsuruApp(ctx context.Context, tsuruApp string, ports v1alpha1.ACLSpecProtoPorts) ([]netv1.NetworkPolicyEgressRule, error) {
 	l := log.FromContext(ctx)
 
 	allErrors := &tsuruErrors.MultiError{}
 	egress := []netv1.NetworkPolicyEgressRule{
 		{
+			Ports: r.ports(ports),
 			To: []netv1.NetworkPolicyPeer{
 				{
 					PodSelector: &metav1.LabelSelector{
@@ -352,7 +609,7 @@ func (r *ACLReconciler) egressRulesForTsuruApp(ctx context.Context, tsuruApp str
 		})
 	}
 
-	resourceEgress, errors := r.egressRulesForResourceAddressStatus(ctx, existingTsuruAppAddress.Status)
+	resourceEgress, errors := r.egressRulesForResourceAddressStatus(ctx, existingTsuruAppAddress.Status, ports)
 	egress = append(egress, resourceEgress...)
 	for _, err := range errors {
 		allErrors.Add(err)
@@ -360,7 +617,7 @@ func (r *ACLReconciler) egressRulesForTsuruApp(ctx context.Context, tsuruApp str
 
 	additionalIPs := []netv1.NetworkPolicyPeer{}
 	for _, ip := range existingTsuruAppAddress.Spec.AdditionalIPs {
-		cidr := ipToCIDR(ip)
+		cidr := v1alpha1.IPToCIDR(ip)
 		if cidr == "" {
 			continue
 		}
@@ -370,19 +627,20 @@ func (r *ACLReconciler) egressRulesForTsuruApp(ctx context.Context, tsuruApp str
 		}})
 	}
 	if len(additionalIPs) > 0 {
-		egress = append(egress, []netv1.NetworkPolicyEgressRule{{To: additionalIPs}}...)
+		egress = append(egress, []netv1.NetworkPolicyEgressRule{{Ports: r.ports(ports), To: additionalIPs}}...)
 	}
 
 	return egress, allErrors.ToError()
 }
 
-func (r *ACLReconciler) egressRulesForResourceAddressStatus(ctx context.Context, status v1alpha1.ResourceAddressStatus) ([]netv1.NetworkPolicyEgressRule, []error) {
+func (r *ACLReconciler) egressRulesForResourceAddressStatus(ctx context.Context, status v1alpha1.ResourceAddressStatus, ports v1alpha1.ACLSpecProtoPorts) ([]netv1.NetworkPolicyEgressRule, []error) {
 	errs := []error{}
 	egresses := []netv1.NetworkPolicyEgressRule{}
 
 	for _, routerIP := range status.IPs {
 		addrEgresses, err := r.egressRulesForExternalIP(ctx, &v1alpha1.ACLSpecExternalIP{
-			IP: routerIP,
+			IP:    routerIP,
+			Ports: ports,
 		})
 		if err != nil {
 			errs = append(errs, fmt.Errorf("could not generate egress rule for %q: %w", routerIP, err))
@@ -394,40 +652,47 @@ func (r *ACLReconciler) egressRulesForResourceAddressStatus(ctx context.Context,
 	return egresses, errs
 }
 
-func (r *ACLReconciler) egressRulesForTsuruAppPool(_ context.Context, tsuruAppPool string) ([]netv1.NetworkPolicyEgressRule, error) {
+func (r *ACLReconciler) egressRulesForTsuruAppPool(_ context.Context, tsuruAppPool string, ports v1alpha1.ACLSpecProtoPorts) ([]netv1.NetworkPolicyEgressRule, error) {
 	egress := []netv1.NetworkPolicyEgressRule{
 		{
-			To: []netv1.NetworkPolicyPeer{
-				{
-					PodSelector: &metav1.LabelSelector{
-						MatchLabels: map[string]string{
-							"tsuru.io/app-pool": tsuruAppPool,
-						},
-					},
+			Ports: r.ports(ports),
+			To:    r.peersForTsuruAppPool(tsuruAppPool),
+		},
+	}
+
+	return egress, nil
+}
+
+func (r *ACLReconciler) peersForTsuruAppPool(tsuruAppPool string) []netv1.NetworkPolicyPeer {
+	return []netv1.NetworkPolicyPeer{
+		{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"tsuru.io/app-pool": tsuruAppPool,
 				},
-				{
-					PodSelector: &metav1.LabelSelector{
-						MatchLabels: map[string]string{
-							"tsuru.io/app-pool": tsuruAppPool,
-						},
-					},
-					NamespaceSelector: &metav1.LabelSelector{
-						MatchLabels: map[string]string{
-							"name": "tsuru-" + tsuruAppPool,
-						},
-					},
+			},
+		},
+		{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"tsuru.io/app-pool": tsuruAppPool,
+				},
+			},
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"name": "tsuru-" + tsuruAppPool,
 				},
 			},
 		},
 	}
-
-	return egress, nil
 }
 
 func (r *ACLReconciler) egressRulesForExternalDNS(ctx context.Context, externalDNS *v1alpha1.ACLSpecExternalDNS) ([]netv1.NetworkPolicyEgressRule, error) {
 	l := log.FromContext(ctx)
 
 	if isWildCard(externalDNS.Name) {
+		// wildcards have no addresses to resolve, the policy backend
+		// expresses them natively
 		return nil, nil
 	}
 
@@ -445,23 +710,28 @@ func (r *ACLReconciler) egressRulesForExternalDNS(ctx context.Context, externalD
 		l.Info("DNSEntry is not ready but has Status IPs, using stale", "reason", existingDNSEntry.Status.Reason)
 	}
 
-	to := []netv1.NetworkPolicyPeer{}
+	addresses := []string{}
 	for _, ip := range existingDNSEntry.Status.IPs {
-		cidr := ipToCIDR(ip.Address)
+		addresses = append(addresses, ip.Address)
+	}
+	addresses = append(addresses, existingDNSEntry.Spec.AdditionalIPs...)
+
+	to := []netv1.NetworkPolicyPeer{}
+	seenCIDRs := map[string]bool{}
+	for _, address := range addresses {
+		cidr := v1alpha1.IPToCIDR(address)
 		if cidr == "" {
 			continue
 		}
 
-		to = append(to, netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{
-			CIDR: cidr,
-		}})
-	}
+		if externalDNS.SyncWholeNetwork {
+			cidr = r.wholeNetworkCIDR(cidr)
+		}
 
-	for _, ip := range existingDNSEntry.Spec.AdditionalIPs {
-		cidr := ipToCIDR(ip)
-		if cidr == "" {
+		if seenCIDRs[cidr] {
 			continue
 		}
+		seenCIDRs[cidr] = true
 
 		to = append(to, netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{
 			CIDR: cidr,
@@ -478,27 +748,19 @@ func (r *ACLReconciler) egressRulesForExternalDNS(ctx context.Context, externalD
 	return egress, nil
 }
 
-func ipToCIDR(address string) string {
-	if strings.Contains(address, ":") {
-		return address + "/128"
-	}
-	if strings.Contains(address, ".") {
-		return address + "/32"
+func (r *ACLReconciler) egressRulesForExternalIP(_ context.Context, externalIP *v1alpha1.ACLSpecExternalIP) ([]netv1.NetworkPolicyEgressRule, error) {
+	cidr := v1alpha1.IPToCIDR(externalIP.IP)
+	if cidr == "" {
+		return nil, fmt.Errorf("invalid IP address %q", externalIP.IP)
 	}
 
-	return ""
-}
-
-func (r *ACLReconciler) egressRulesForExternalIP(_ context.Context, externalIP *v1alpha1.ACLSpecExternalIP) ([]netv1.NetworkPolicyEgressRule, error) {
-	var cidr string
+	if externalIP.SyncWholeNetwork {
+		cidr = r.wholeNetworkCIDR(cidr)
+	}
 
-	cidr = externalIP.IP
-	if !strings.Contains(cidr, "/") {
-		if strings.Contains(cidr, ":") {
-			cidr = cidr + "/128"
-		} else if strings.Contains(cidr, ".") {
-			cidr = cidr + "/32"
-		}
+	except, err := r.exceptCIDRs(externalIP.Except)
+	if err != nil {
+		return nil, err
 	}
 
 	egress := []netv1.NetworkPolicyEgressRule{
@@ -506,7 +768,8 @@ func (r *ACLReconciler) egressRulesForExternalIP(_ context.Context, externalIP *
 			To: []netv1.NetworkPolicyPeer{
 				{
 					IPBlock: &netv1.IPBlock{
-						CIDR: cidr,
+						CIDR:   cidr,
+						Except: except,
 					},
 				},
 			},
@@ -517,12 +780,64 @@ func (r *ACLReconciler) egressRulesForExternalIP(_ context.Context, externalIP *
 	return egress, nil
 }
 
-func (r *ACLReconciler) egressRulesForRpaasInstance(ctx context.Context, rpaasInstance *v1alpha1.ACLSpecRpaasInstance) ([]netv1.NetworkPolicyEgressRule, error) {
+func (r *ACLReconciler) exceptCIDRs(except []string) ([]string, error) {
+	if len(except) == 0 {
+		return nil, nil
+	}
+
+	result := make([]string, 0, len(except))
+	for _, address := range except {
+		cidr := v1alpha1.IPToCIDR(address)
+		if cidr == "" {
+			return nil, fmt.Errorf("invalid except address %q", address)
+		}
+		result = append(result, cidr)
+	}
+
+	return result, nil
+}
+
+// wholeNetworkCIDR widens the cidr to the network that contains it, cidrs
+// already wider than the configured prefix length are kept as is.
+func (r *ACLReconciler) wholeNetworkCIDR(cidr string) string {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return cidr
+	}
+
+	ones, bits := ipNet.Mask.Size()
+
+	prefixLength := r.WholeNetworkIPv4PrefixLength
+	if prefixLength == 0 {
+		prefixLength = defaultWholeNetworkIPv4PrefixLength
+	}
+	if bits == net.IPv6len*8 {
+		prefixLength = r.WholeNetworkIPv6PrefixLength
+		if prefixLength == 0 {
+			prefixLength = defaultWholeNetworkIPv6PrefixLength
+		}
+	}
+
+	if ones <= prefixLength {
+		return ipNet.String()
+	}
+
+	mask := net.CIDRMask(prefixLength, bits)
+	wholeNetwork := &net.IPNet{
+		IP:   ipNet.IP.Mask(mask),
+		Mask: mask,
+	}
+
+	return wholeNetwork.String()
+}
+
+func (r *ACLReconciler) egressRulesForRpaasInstance(ctx context.Context, rpaasInstance *v1alpha1.ACLSpecRpaasInstance, ports v1alpha1.ACLSpecProtoPorts) ([]netv1.NetworkPolicyEgressRule, error) {
 	l := log.FromContext(ctx)
 
 	allErrors := &tsuruErrors.MultiError{}
 	egress := []netv1.NetworkPolicyEgressRule{
 		{
+			Ports: r.ports(ports),
 			To: []netv1.NetworkPolicyPeer{
 				{
 					PodSelector: &metav1.LabelSelector{
@@ -554,7 +869,7 @@ func (r *ACLReconciler) egressRulesForRpaasInstance(ctx context.Context, rpaasIn
 			},
 		})
 	}
-	resourceEgress, errors := r.egressRulesForResourceAddressStatus(ctx, existingRpaasInstanceAddress.Status)
+	resourceEgress, errors := r.egressRulesForResourceAddressStatus(ctx, existingRpaasInstanceAddress.Status, ports)
 	egress = append(egress, resourceEgress...)
 	for _, err := range errors {
 		allErrors.Add(err)
@@ -563,6 +878,213 @@ func (r *ACLReconciler) egressRulesForRpaasInstance(ctx context.Context, rpaasIn
 	return egress, allErrors.ToError()
 }
 
+func (r *ACLReconciler) egressRulesForKubernetesService(ctx context.Context, kubernetesService *v1alpha1.ACLSpecKubernetesService) ([]netv1.NetworkPolicyEgressRule, error) {
+	if err := r.validateKubernetesServiceCluster(kubernetesService); err != nil {
+		return nil, err
+	}
+
+	svc := &corev1.Service{}
+	err := r.Get(ctx, client.ObjectKey{
+		Namespace: kubernetesService.Namespace,
+		Name:      kubernetesService.Name,
+	}, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
+		return nil, fmt.Errorf("service %s/%s is an ExternalName service, use an externalDNS destination instead", svc.Namespace, svc.Name)
+	}
+
+	egress := []netv1.NetworkPolicyEgressRule{}
+
+	if len(svc.Spec.Selector) > 0 {
+		egress = append(egress, netv1.NetworkPolicyEgressRule{
+			To: []netv1.NetworkPolicyPeer{
+				{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: svc.Spec.Selector,
+					},
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"name": svc.Namespace,
+						},
+					},
+				},
+			},
+			Ports: r.servicePorts(svc.Spec.Ports, true),
+		})
+	}
+
+	clusterIPs := []netv1.NetworkPolicyPeer{}
+	for _, clusterIP := range serviceClusterIPs(svc) {
+		cidr := v1alpha1.IPToCIDR(clusterIP)
+		if cidr == "" {
+			continue
+		}
+
+		clusterIPs = append(clusterIPs, netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{
+			CIDR: cidr,
+		}})
+	}
+	if len(clusterIPs) > 0 {
+		egress = append(egress, netv1.NetworkPolicyEgressRule{
+			To:    clusterIPs,
+			Ports: r.servicePorts(svc.Spec.Ports, false),
+		})
+	}
+
+	if len(egress) == 0 {
+		return nil, fmt.Errorf("service %s/%s has neither selector nor cluster IPs", svc.Namespace, svc.Name)
+	}
+
+	return egress, nil
+}
+
+func (r *ACLReconciler) validateKubernetesServiceCluster(kubernetesService *v1alpha1.ACLSpecKubernetesService) error {
+	if kubernetesService.ClusterName != "" && r.ClusterName != "" && kubernetesService.ClusterName != r.ClusterName {
+		return fmt.Errorf("service %s/%s belongs to cluster %q, not to %q", kubernetesService.Namespace, kubernetesService.Name, kubernetesService.ClusterName, r.ClusterName)
+	}
+
+	return nil
+}
+
+func serviceClusterIPs(svc *corev1.Service) []string {
+	clusterIPs := svc.Spec.ClusterIPs
+	if len(clusterIPs) == 0 && svc.Spec.ClusterIP != "" {
+		clusterIPs = []string{svc.Spec.ClusterIP}
+	}
+
+	result := []string{}
+	for _, clusterIP := range clusterIPs {
+		if clusterIP == corev1.ClusterIPNone {
+			continue
+		}
+		result = append(result, clusterIP)
+	}
+
+	return result
+}
+
+func (r *ACLReconciler) ingressRulesForAllowedFrom(ctx context.Context, allowedFrom v1alpha1.ACLSpecAllowedFrom) ([]netv1.NetworkPolicyIngressRule, error) {
+	if allowedFrom.TsuruApp != "" {
+		return r.ingressRulesForTsuruApp(ctx, allowedFrom.TsuruApp, allowedFrom.Ports)
+	} else if allowedFrom.TsuruAppPool != "" {
+		return []netv1.NetworkPolicyIngressRule{
+			{
+				From:  r.peersForTsuruAppPool(allowedFrom.TsuruAppPool),
+				Ports: r.ports(allowedFrom.Ports),
+			},
+		}, nil
+	} else if allowedFrom.ExternalIP != nil {
+		cidr := v1alpha1.IPToCIDR(allowedFrom.ExternalIP.IP)
+		if cidr == "" {
+			return nil, fmt.Errorf("invalid IP address %q", allowedFrom.ExternalIP.IP)
+		}
+
+		except, err := r.exceptCIDRs(allowedFrom.ExternalIP.Except)
+		if err != nil {
+			return nil, err
+		}
+
+		return []netv1.NetworkPolicyIngressRule{
+			{
+				From: []netv1.NetworkPolicyPeer{
+					{
+						IPBlock: &netv1.IPBlock{
+							CIDR:   cidr,
+							Except: except,
+						},
+					},
+				},
+				Ports: r.ports(allowedFrom.ExternalIP.Ports),
+			},
+		}, nil
+	} else if allowedFrom.RpaasInstance != nil {
+		return r.ingressRulesForRpaasInstance(ctx, allowedFrom.RpaasInstance, allowedFrom.Ports)
+	}
+	return nil, nil
+}
+
+func (r *ACLReconciler) ingressRulesForTsuruApp(ctx context.Context, tsuruApp string, ports v1alpha1.ACLSpecProtoPorts) ([]netv1.NetworkPolicyIngressRule, error) {
+	l := log.FromContext(ctx)
+
+	ingress := []netv1.NetworkPolicyIngressRule{
+		{
+			From: []netv1.NetworkPolicyPeer{
+				{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: r.podSelectorForTsuruApp(tsuruApp),
+					},
+				},
+			},
+			Ports: r.ports(ports),
+		},
+	}
+
+	existingTsuruAppAddress, err := r.ensureTsuruAppAddress(ctx, tsuruApp)
+	if err != nil {
+		l.Error(err, "could not get TsuruAppAddress", "appName", tsuruApp)
+		return nil, err
+	}
+
+	if existingTsuruAppAddress.Status.Pool != "" {
+		ingress[0].From = append(ingress[0].From, netv1.NetworkPolicyPeer{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: r.podSelectorForTsuruApp(tsuruApp),
+			},
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"name": "tsuru-" + existingTsuruAppAddress.Status.Pool,
+				},
+			},
+		})
+	}
+
+	return ingress, nil
+}
+
+func (r *ACLReconciler) ingressRulesForRpaasInstance(ctx context.Context, rpaasInstance *v1alpha1.ACLSpecRpaasInstance, ports v1alpha1.ACLSpecProtoPorts) ([]netv1.NetworkPolicyIngressRule, error) {
+	l := log.FromContext(ctx)
+
+	ingress := []netv1.NetworkPolicyIngressRule{
+		{
+			From: []netv1.NetworkPolicyPeer{
+				{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: r.podSelectorForRpasInstance(rpaasInstance),
+					},
+				},
+			},
+			Ports: r.ports(ports),
+		},
+	}
+
+	existingRpaasInstanceAddress, err := r.ensureRpaasInstanceAddress(ctx, rpaasInstance)
+	if err != nil {
+		l.Error(err, "could not get RpaasInstanceAddress",
+			"rpaasInstance", rpaasInstance.Instance,
+			"rpaasService", rpaasInstance.ServiceName,
+		)
+		return nil, err
+	}
+
+	if existingRpaasInstanceAddress.Status.Pool != "" {
+		ingress[0].From = append(ingress[0].From, netv1.NetworkPolicyPeer{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: r.podSelectorForRpasInstance(rpaasInstance),
+			},
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"name": existingRpaasInstanceAddress.Spec.ServiceName + "-" + existingRpaasInstanceAddress.Status.Pool,
+				},
+			},
+		})
+	}
+
+	return ingress, nil
+}
+
 func (r *ACLReconciler) ensureDNSEntry(ctx context.Context, host string) (*v1alpha1.ACLDNSEntry, error) {
 	l := log.FromContext(ctx)
 
@@ -589,14 +1111,8 @@ func (r *ACLReconciler) ensureDNSEntry(ctx context.Context, host string) (*v1alp
 			return nil, err
 		}
 
-		subReconciler := &ACLDNSEntryReconciler{
-			Client:   r.Client,
-			Scheme:   r.Scheme,
-			Resolver: r.Resolver,
-		}
-
 		operationStart := time.Now()
-		err = subReconciler.FillStatus(ctx, dnsEntry)
+		err = r.dnsEntryReconciler().FillStatus(ctx, dnsEntry)
 		operationDuration := time.Since(operationStart)
 		subReconcilerTime.WithLabelValues("acl", "acldnsentry").Observe(operationDuration.Seconds())
 		if err != nil {
@@ -615,6 +1131,20 @@ func (r *ACLReconciler) ensureDNSEntry(ctx context.Context, host string) (*v1alp
 	return existingDNSEntry, nil
 }
 
+// dnsEntryReconciler returns the DNSEntryReconciler, or a reconciler with
+// the default configuration when it's not set.
+func (r *ACLReconciler) dnsEntryReconciler() *ACLDNSEntryReconciler {
+	if r.DNSEntryReconciler != nil {
+		return r.DNSEntryReconciler
+	}
+
+	return &ACLDNSEntryReconciler{
+		Client:   r.Client,
+		Scheme:   r.Scheme,
+		Resolver: r.Resolver,
+	}
+}
+
 func (r *ACLReconciler) ensureTsuruAppAddress(ctx context.Context, appName string) (*v1alpha1.TsuruAppAddress, error) {
 	l := log.FromContext(ctx)
 
@@ -728,10 +1258,45 @@ func (r *ACLReconciler) ports(p []v1alpha1.ProtoPort) []netv1.NetworkPolicyPort
 			protocol = &p
 		}
 
-		portNumber := intstr.FromInt(int(port.Number))
+		portValue := intstr.FromInt(int(port.Number))
+		if port.Name != "" {
+			portValue = intstr.FromString(port.Name)
+		}
+
+		var endPort *int32
+		if port.Name == "" && port.EndPort > port.Number {
+			e := int32(port.EndPort)
+			endPort = &e
+		}
+
 		result = append(result, netv1.NetworkPolicyPort{
 			Protocol: protocol,
-			Port:     &portNumber,
+			Port:     &portValue,
+			EndPort:  endPort,
+		})
+	}
+	return result
+}
+
+// servicePorts returns the ports exposed by a service, targetPort selects the
+// ports of the backing pods instead of the ports of the service itself.
+func (r *ACLReconciler) servicePorts(servicePorts []corev1.ServicePort, targetPort bool) []netv1.NetworkPolicyPort {
+	var result []netv1.NetworkPolicyPort
+	for _, servicePort := range servicePorts {
+		var protocol *corev1.Protocol
+		if servicePort.Protocol != "" {
+			p := servicePort.Protocol
+			protocol = &p
+		}
+
+		port := intstr.FromInt(int(servicePort.Port))
+		if targetPort && (servicePort.TargetPort.Type == intstr.String || servicePort.TargetPort.IntVal != 0) {
+			port = servicePort.TargetPort
+		}
+
+		result = append(result, netv1.NetworkPolicyPort{
+			Protocol: protocol,
+			Port:     &port,
 		})
 	}
 	return result
@@ -773,6 +1338,17 @@ func (r *ACLReconciler) fillPodSelectorByCIDR(ctx context.Context, rules []netv1
 
 	result := make([]netv1.NetworkPolicyEgressRule, 0, len(rules))
 
+	// pods already targeted by a destination, e.g. a kubernetesService
+	// destination, must not be widened to all ports by its cluster IPs
+	targetedPods := map[string]struct{}{}
+	for _, egressRule := range rules {
+		for _, to := range egressRule.To {
+			if to.PodSelector != nil && to.NamespaceSelector != nil {
+				targetedPods[labelSelectorKey(to.PodSelector)+"/"+labelSelectorKey(to.NamespaceSelector)] = struct{}{}
+			}
+		}
+	}
+
 	for _, egressRule := range rules {
 		result = append(result, egressRule)
 
@@ -791,19 +1367,23 @@ func (r *ACLReconciler) fillPodSelectorByCIDR(ctx context.Context, rules []netv1
 						continue toLoop
 					}
 
-					result = append(result, netv1.NetworkPolicyEgressRule{
-						To: []netv1.NetworkPolicyPeer{
-							{
-								PodSelector: &metav1.LabelSelector{
-									MatchLabels: svc.Spec.Selector,
-								},
-								NamespaceSelector: &metav1.LabelSelector{
-									MatchLabels: map[string]string{
-										"name": svc.Namespace, // we have a common practice to add name of namespace as a label
-									},
-								},
+					peer := netv1.NetworkPolicyPeer{
+						PodSelector: &metav1.LabelSelector{
+							MatchLabels: svc.Spec.Selector,
+						},
+						NamespaceSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"name": svc.Namespace, // we have a common practice to add name of namespace as a label
 							},
 						},
+					}
+
+					if _, found := targetedPods[labelSelectorKey(peer.PodSelector)+"/"+labelSelectorKey(peer.NamespaceSelector)]; found {
+						continue toLoop
+					}
+
+					result = append(result, netv1.NetworkPolicyEgressRule{
+						To: []netv1.NetworkPolicyPeer{peer},
 					})
 				}
 			}
@@ -818,7 +1398,7 @@ func (r *ACLReconciler) SetupWithManager(mgr ctrl.Manager, maxConcurrentReconcil
 	ctrl, err := ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.ACL{}).
 		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrentReconciles, RecoverPanic: true}).
-		Owns(&netv1.NetworkPolicy{}).
+		Owns(r.policyBackend().NewObject()).
 		Build(r)
 	if err != nil {
 		return err
@@ -869,6 +1449,30 @@ func (r *ACLReconciler) setupIndexes(mgr ctrl.Manager) error {
 				keys = append(keys, destination.RpaasInstance.ServiceName+"/"+destination.RpaasInstance.Instance)
 			}
 		}
+		for _, allowedFrom := range acl.Spec.AllowedFrom {
+			if allowedFrom.RpaasInstance != nil {
+				keys = append(keys, allowedFrom.RpaasInstance.ServiceName+"/"+allowedFrom.RpaasInstance.Instance)
+			}
+		}
+
+		return keys
+	})
+	if err != nil {
+		return err
+	}
+
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.ACL{}, kubernetesServiceIndex, func(o client.Object) []string {
+		acl, ok := o.(*v1alpha1.ACL)
+		if !ok {
+			return nil
+		}
+
+		keys := []string{}
+		for _, destination := range acl.Spec.Destinations {
+			if destination.KubernetesService != nil {
+				keys = append(keys, destination.KubernetesService.Namespace+"/"+destination.KubernetesService.Name)
+			}
+		}
 
 		return keys
 	})
@@ -888,6 +1492,11 @@ func (r *ACLReconciler) setupIndexes(mgr ctrl.Manager) error {
 				keys = append(keys, destination.TsuruApp)
 			}
 		}
+		for _, allowedFrom := range acl.Spec.AllowedFrom {
+			if allowedFrom.TsuruApp != "" {
+				keys = append(keys, allowedFrom.TsuruApp)
+			}
+		}
 
 		return keys
 	})
@@ -898,6 +1507,35 @@ func (r *ACLReconciler) setupIndexes(mgr ctrl.Manager) error {
 	return nil
 }
 
+// dnsEntryAddressesChanged ignores the updates of ACLDNSEntries that keep
+// the addresses used by the ACLs, the schedule of the resolutions changes on
+// every one of them.
+var dnsEntryAddressesChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldEntry, ok := e.ObjectOld.(*v1alpha1.ACLDNSEntry)
+		if !ok {
+			return true
+		}
+		newEntry, ok := e.ObjectNew.(*v1alpha1.ACLDNSEntry)
+		if !ok {
+			return true
+		}
+
+		return oldEntry.Generation != newEntry.Generation ||
+			oldEntry.Status.Ready != newEntry.Status.Ready ||
+			!reflect.DeepEqual(dnsEntryAddresses(oldEntry), dnsEntryAddresses(newEntry))
+	},
+}
+
+func dnsEntryAddresses(dnsEntry *v1alpha1.ACLDNSEntry) []string {
+	addresses := make([]string, 0, len(dnsEntry.Status.IPs))
+	for _, ip := range dnsEntry.Status.IPs {
+		addresses = append(addresses, ip.Address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
 func (r *ACLReconciler) setupWatchers(ctrl controller.Controller) error {
 	err := ctrl.Watch(&source.Kind{Type: &v1alpha1.ACLDNSEntry{}},
 		handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
@@ -908,6 +1546,7 @@ func (r *ACLReconciler) setupWatchers(ctrl controller.Controller) error {
 
 			return r.reconcileRequestsForIndex(externalDNSIndex, dnsEntry.Spec.Host)
 		}),
+		dnsEntryAddressesChanged,
 	)
 	if err != nil {
 		return err
@@ -942,6 +1581,15 @@ func (r *ACLReconciler) setupWatchers(ctrl controller.Controller) error {
 		return err
 	}
 
+	err = ctrl.Watch(&source.Kind{Type: &corev1.Service{}},
+		handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			return r.reconcileRequestsForIndex(kubernetesServiceIndex, o.GetNamespace()+"/"+o.GetName())
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -965,6 +1613,16 @@ func (r *ACLReconciler) reconcileRequestsForIndex(index, value string) []reconci
 	return requests
 }
 
+func labelSelectorKey(selector *metav1.LabelSelector) string {
+	keys := make([]string, 0, len(selector.MatchLabels))
+	for k, v := range selector.MatchLabels {
+		keys = append(keys, k+"="+v)
+	}
+	sort.Strings(keys)
+
+	return strings.Join(keys, ",")
+}
+
 func isWildCard(name string) bool {
 	return name != "" && name[0] == '.'
 }
@@ -1003,3 +1661,13 @@ func copyEgressRules(in []netv1.NetworkPolicyEgressRule) []netv1.NetworkPolicyEg
 
 	return out
 }
+
+func copyIngressRules(in []netv1.NetworkPolicyIngressRule) []netv1.NetworkPolicyIngressRule {
+	out := make([]netv1.NetworkPolicyIngressRule, len(in))
+
+	for i := range in {
+		out[i] = *in[i].DeepCopy()
+	}
+
+	return out
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"strings"
 	"testing"
@@ -12,13 +13,17 @@ import (
 	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
 	"github.com/tsuru/acl-operator/clients/tsuruapi"
 	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
 	appTypes "github.com/tsuru/tsuru/types/app"
 	corev1 "k8s.io/api/core/v1"
 	netv1 "k8s.io/api/networking/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
 	controllerruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -157,6 +162,85 @@ func (suite *ControllerSuite) TestACLReconcilerSimpleReconcile() {
 	}, existingNP.Spec.Egress[1])
 }
 
+func (suite *ControllerSuite) TestACLReconcilerSelectorSourcesReconcile() {
+	tests := []struct {
+		source   v1alpha1.ACLSpecSource
+		expected metav1.LabelSelector
+	}{
+		{
+			source: v1alpha1.ACLSpecSource{TsuruAppPool: "my-pool"},
+			expected: metav1.LabelSelector{
+				MatchLabels: map[string]string{"tsuru.io/app-pool": "my-pool"},
+			},
+		},
+		{
+			source: v1alpha1.ACLSpecSource{TsuruTeam: "my-team"},
+			expected: metav1.LabelSelector{
+				// the label of the team owner set by the tsuru provisioner on app pods
+				MatchLabels: map[string]string{"tsuru.io/" + provision.LabelAppTeamOwner: "my-team"},
+			},
+		},
+		{
+			source: v1alpha1.ACLSpecSource{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"egress": "restricted"},
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"web", "worker"}},
+					},
+				},
+			},
+			expected: metav1.LabelSelector{
+				MatchLabels: map[string]string{"egress": "restricted"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"web", "worker"}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		ctx := context.Background()
+		acl := &v1alpha1.ACL{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "baseline",
+				Namespace: "default",
+			},
+			Spec: v1alpha1.ACLSpec{
+				Source: tt.source,
+				Destinations: []v1alpha1.ACLSpecDestination{
+					{
+						ExternalIP: &v1alpha1.ACLSpecExternalIP{
+							IP: "10.0.0.0/8",
+						},
+					},
+				},
+			},
+		}
+
+		reconciler := &ACLReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+			Scheme:   scheme.Scheme,
+			Resolver: &fakeResolver{},
+			TsuruAPI: &fakeTsuruAPI{},
+		}
+		_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      "baseline",
+				Namespace: "default",
+			},
+		})
+		suite.Require().NoError(err)
+
+		existingNP := &netv1.NetworkPolicy{}
+		err = reconciler.Client.Get(ctx, client.ObjectKey{
+			Namespace: "default",
+			Name:      "acl-baseline",
+		}, existingNP)
+		suite.Require().NoError(err)
+		suite.Assert().Equal(tt.expected, existingNP.Spec.PodSelector)
+	}
+}
+
 func (suite *ControllerSuite) TestACLReconcilerStaleReconcile() {
 	ctx := context.Background()
 	acl := &v1alpha1.ACL{
@@ -197,11 +281,13 @@ func (suite *ControllerSuite) TestACLReconcilerStaleReconcile() {
 		},
 	}
 
+	recorder := record.NewFakeRecorder(10)
 	reconciler := &ACLReconciler{
 		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
 		Scheme:   scheme.Scheme,
 		Resolver: &fakeResolver{},
 		TsuruAPI: &fakeTsuruAPI{},
+		Recorder: recorder,
 	}
 	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
 		NamespacedName: types.NamespacedName{
@@ -238,6 +324,13 @@ func (suite *ControllerSuite) TestACLReconcilerStaleReconcile() {
 		RuleID: "external-ip-2",
 		Error:  "timeout for host",
 	}, existingACL.Status.RuleErrors[0])
+	suite.Assert().True(meta.IsStatusConditionTrue(existingACL.Status.Conditions, v1alpha1.ConditionPolicyApplied))
+	suite.Assert().True(meta.IsStatusConditionTrue(existingACL.Status.Conditions, v1alpha1.ConditionDegraded))
+	suite.Assert().True(meta.IsStatusConditionTrue(existingACL.Status.Conditions, v1alpha1.ConditionStale))
+
+	suite.Require().Len(recorder.Events, 2)
+	suite.Assert().Equal("Warning RuleFallbackToStale using rules of previous reconciles for rule external-ip-2: timeout for host", <-recorder.Events)
+	suite.Assert().Equal("Normal PolicyCreated networkpolicy policy acl-myapp has been created", <-recorder.Events)
 
 	existingNP := &netv1.NetworkPolicy{}
 	err = reconciler.Client.Get(ctx, client.ObjectKey{
@@ -387,48 +480,41 @@ func (suite *ControllerSuite) TestACLReconcilerDestinationAppReconcile() {
 	suite.Assert().Equal(map[string]string{
 		"tsuru.io/app-name": "myapp",
 	}, existingNP.Spec.PodSelector.MatchLabels)
-	suite.Assert().Len(existingNP.Spec.Egress, 5)
-
-	suite.Assert().Len(existingNP.Spec.Egress[0].To, 1)
-	suite.Assert().Len(existingNP.Spec.Egress[1].To, 1)
-	suite.Assert().Len(existingNP.Spec.Egress[2].To, 1)
-	suite.Assert().Len(existingNP.Spec.Egress[3].To, 1)
-	suite.Assert().Len(existingNP.Spec.Egress[4].To, 2)
+	// rules without ports are merged into a single rule
+	suite.Require().Len(existingNP.Spec.Egress, 1)
+	// Ports must be nil when use podSelector, some services has port translation and does not match
+	suite.Assert().Nil(existingNP.Spec.Egress[0].Ports)
 
-	suite.Assert().Equal(netv1.NetworkPolicyPeer{
-		PodSelector: &metav1.LabelSelector{
-			MatchLabels: map[string]string{
-				"tsuru.io/app-name": "my-other-app",
+	suite.Assert().Equal([]netv1.NetworkPolicyPeer{
+		{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"tsuru.io/app-name": "my-other-app",
+				},
 			},
 		},
-	}, existingNP.Spec.Egress[0].To[0])
-	suite.Assert().Equal(netv1.NetworkPolicyPeer{
-		IPBlock: &netv1.IPBlock{
-			CIDR: "1.1.1.1/32",
-		},
-	}, existingNP.Spec.Egress[1].To[0])
-	// Ports must be nil when use podSelector, some services has port translation and does not match
-	suite.Assert().Nil(existingNP.Spec.Egress[2].Ports)
-	suite.Assert().Equal(netv1.NetworkPolicyPeer{
-		PodSelector: &metav1.LabelSelector{
-			MatchLabels: map[string]string{
-				"svc": "my-awesome-service",
+		{
+			IPBlock: &netv1.IPBlock{
+				CIDR: "1.1.1.1/32",
 			},
 		},
-		NamespaceSelector: &metav1.LabelSelector{
-			MatchLabels: map[string]string{
-				"name": "default",
+		{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"svc": "my-awesome-service",
+				},
+			},
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"name": "default",
+				},
 			},
 		},
-	}, existingNP.Spec.Egress[2].To[0])
-
-	suite.Assert().Equal(netv1.NetworkPolicyPeer{
-		IPBlock: &netv1.IPBlock{
-			CIDR: "2.2.2.2/32",
+		{
+			IPBlock: &netv1.IPBlock{
+				CIDR: "2.2.2.2/32",
+			},
 		},
-	}, existingNP.Spec.Egress[3].To[0])
-
-	suite.Assert().Equal([]netv1.NetworkPolicyPeer{
 		{
 			IPBlock: &netv1.IPBlock{
 				CIDR: "3.3.3.3/32",
@@ -439,7 +525,121 @@ func (suite *ControllerSuite) TestACLReconcilerDestinationAppReconcile() {
 				CIDR: "4.4.4.4/32",
 			},
 		},
-	}, existingNP.Spec.Egress[4].To)
+	}, existingNP.Spec.Egress[0].To)
+
+	// Ports must be nil for podSelector service peers, some services has port translation and does not match
+	serviceRules := 0
+	for _, rule := range existingNP.Spec.Egress {
+		for _, peer := range rule.To {
+			if peer.PodSelector != nil && peer.PodSelector.MatchLabels["svc"] == "my-awesome-service" {
+				serviceRules++
+				suite.Assert().Nil(rule.Ports)
+			}
+		}
+	}
+	suite.Assert().Equal(1, serviceRules)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerDestinationPortsReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					TsuruApp: "my-other-app",
+					Ports: v1alpha1.ACLSpecProtoPorts{
+						{Protocol: "TCP", Number: 8080},
+					},
+				},
+				{
+					TsuruAppPool: "my-pool",
+					Ports: v1alpha1.ACLSpecProtoPorts{
+						{Protocol: "TCP", Name: "grpc"},
+					},
+				},
+			},
+		},
+	}
+
+	tsuruAppAddress := &v1alpha1.TsuruAppAddress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "my-other-app",
+		},
+		Spec: v1alpha1.TsuruAppAddressSpec{
+			Name: "my-other-app",
+		},
+		Status: v1alpha1.ResourceAddressStatus{
+			Ready: true,
+			IPs: []string{
+				"1.1.1.1",
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithRuntimeObjects(acl, tsuruAppAddress).
+			Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingNP := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "acl-myapp",
+	}, existingNP)
+	suite.Require().NoError(err)
+	suite.Require().Len(existingNP.Spec.Egress, 2)
+
+	tcp := corev1.ProtocolTCP
+	appPorts := []netv1.NetworkPolicyPort{
+		{
+			Protocol: &tcp,
+			Port:     &intstr.IntOrString{IntVal: 8080},
+		},
+	}
+	suite.Assert().Equal(netv1.NetworkPolicyEgressRule{
+		Ports: appPorts,
+		To: []netv1.NetworkPolicyPeer{
+			{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"tsuru.io/app-name": "my-other-app",
+					},
+				},
+			},
+			{
+				IPBlock: &netv1.IPBlock{
+					CIDR: "1.1.1.1/32",
+				},
+			},
+		},
+	}, existingNP.Spec.Egress[0])
+
+	suite.Assert().Equal([]netv1.NetworkPolicyPort{
+		{
+			Protocol: &tcp,
+			Port:     &intstr.IntOrString{Type: intstr.String, StrVal: "grpc"},
+		},
+	}, existingNP.Spec.Egress[1].Ports)
+	suite.Assert().Len(existingNP.Spec.Egress[1].To, 2)
 }
 
 func (suite *ControllerSuite) TestACLReconcilerDestinationExternalDNSReconcile() {
@@ -762,82 +962,1378 @@ func (suite *ControllerSuite) TestACLReconcilerDestinationRPaaSReconcile() {
 	suite.Assert().Equal(map[string]string{
 		"tsuru.io/app-name": "myapp",
 	}, existingNP.Spec.PodSelector.MatchLabels)
-	suite.Require().Len(existingNP.Spec.Egress, 2)
-
-	suite.Assert().Len(existingNP.Spec.Egress[0].To, 1)
-	suite.Assert().Len(existingNP.Spec.Egress[1].To, 1)
+	suite.Require().Len(existingNP.Spec.Egress, 1)
 
-	suite.Assert().Equal(netv1.NetworkPolicyPeer{
-		PodSelector: &metav1.LabelSelector{
-			MatchLabels: map[string]string{
-				"rpaas.extensions.tsuru.io/instance-name": "my-instance",
-				"rpaas.extensions.tsuru.io/service-name":  "rpaasv2",
+	suite.Assert().Equal([]netv1.NetworkPolicyPeer{
+		{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"rpaas.extensions.tsuru.io/instance-name": "my-instance",
+					"rpaas.extensions.tsuru.io/service-name":  "rpaasv2",
+				},
 			},
 		},
-	}, existingNP.Spec.Egress[0].To[0])
-	suite.Assert().Equal(netv1.NetworkPolicyPeer{
-		IPBlock: &netv1.IPBlock{
-			CIDR: "3.3.3.3/32",
+		{
+			IPBlock: &netv1.IPBlock{
+				CIDR: "3.3.3.3/32",
+			},
 		},
-	}, existingNP.Spec.Egress[1].To[0])
+	}, existingNP.Spec.Egress[0].To)
 }
 
-type fakeTsuruAPI struct{}
-
-func (f *fakeTsuruAPI) AppInfo(ctx context.Context, appName string) (*app.App, error) {
-	if appName == "my-other-app" {
-		return &app.App{
-			Name: appName,
-			Pool: "my-pool",
-			Routers: []appTypes.AppRouter{
+func (suite *ControllerSuite) TestACLReconcilerAllowedFromReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mydb",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "mydb",
+			},
+			AllowedFrom: []v1alpha1.ACLSpecAllowedFrom{
 				{
-					Name: "https-router",
-					Addresses: []string{
-						"https://myapp.io",
-					},
+					RuleID:       "pool-1",
+					TsuruAppPool: "my-pool",
 				},
 				{
-					Name: "http-router",
-					Addresses: []string{
-						"http.myapp.io",
+					RuleID: "external-ip-1",
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.0.0.1",
+						Ports: v1alpha1.ACLSpecProtoPorts{
+							{
+								Protocol: "tcp",
+								Number:   5432,
+							},
+						},
 					},
 				},
 			},
-		}, nil
+		},
 	}
 
-	return nil, errors.New("no app found")
-}
-
-func (f *fakeTsuruAPI) ServiceInstanceInfo(ctx context.Context, service, instance string) (*tsuruapi.ServiceInstanceInfo, error) {
-	if service == "rpaasv2" && instance == "my-instance" {
-		return &tsuruapi.ServiceInstanceInfo{
-			CustomInfo: map[string]interface{}{
-				"Address": "3.3.3.3",
-			},
-		}, nil
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
 	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "mydb",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
 
-	return nil, errors.New("not implemented yet")
-}
-
-func TestValidResourceName(t *testing.T) {
-	expectations := map[string]string{
-		"user":         "user",
-		"*.globo.com":  "globo.com-102f523825",
-		".google.com":  "google.com-5d59719991",
-		"10.1.1.1/10":  "10.1.1.1-10-22f870d4a0",
-		"facebook.com": "facebook.com",
-
-		strings.Repeat("testing-", 30): "testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing--2744fb94f9",
-	}
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().True(existingACL.Status.Ready)
+	suite.Assert().Len(existingACL.Status.Stale, 0)
+	suite.Require().Len(existingACL.Status.IngressStale, 2)
+	suite.Assert().Equal("external-ip-1", existingACL.Status.IngressStale[0].RuleID)
+	suite.Assert().Equal("pool-1", existingACL.Status.IngressStale[1].RuleID)
 
-	for input, expectedOutput := range expectations {
-		output := validResourceName(input)
-		assert.Equal(t, expectedOutput, output, "input", input)
+	existingNP := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: existingACL.Namespace,
+		Name:      existingACL.Status.NetworkPolicy,
+	}, existingNP)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]netv1.PolicyType{netv1.PolicyTypeIngress}, existingNP.Spec.PolicyTypes)
+	suite.Assert().Nil(existingNP.Spec.Egress)
+	suite.Require().Len(existingNP.Spec.Ingress, 2)
 
-		errs := validation.IsDNS1123Subdomain(output)
+	suite.Assert().Len(existingNP.Spec.Ingress[0].From, 2)
+	suite.Assert().Equal(netv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"tsuru.io/app-pool": "my-pool",
+			},
+		},
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"name": "tsuru-my-pool",
+			},
+		},
+	}, existingNP.Spec.Ingress[0].From[1])
 
-		assert.Len(t, errs, 0)
+	tcp := corev1.ProtocolTCP
+	suite.Assert().Equal(netv1.NetworkPolicyIngressRule{
+		Ports: []netv1.NetworkPolicyPort{
+			{
+				Port: &intstr.IntOrString{
+					IntVal: 5432,
+				},
+				Protocol: &tcp,
+			},
+		},
+		From: []netv1.NetworkPolicyPeer{
+			{
+				IPBlock: &netv1.IPBlock{
+					CIDR: "10.0.0.1/32",
+				},
+			},
+		},
+	}, existingNP.Spec.Ingress[1])
+}
+
+func (suite *ControllerSuite) TestACLReconcilerPortRangesAndNamedPorts() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.0.0.1/32",
+						Ports: v1alpha1.ACLSpecProtoPorts{
+							{Protocol: "udp", Number: 10000, EndPort: 20000},
+						},
+					},
+				},
+			},
+			AllowedFrom: []v1alpha1.ACLSpecAllowedFrom{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.0.0.2/32",
+						Ports: v1alpha1.ACLSpecProtoPorts{
+							{Protocol: "tcp", Name: "http"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingNP := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "acl-myapp",
+	}, existingNP)
+	suite.Require().NoError(err)
+
+	udp := corev1.ProtocolUDP
+	endPort := int32(20000)
+	suite.Require().Len(existingNP.Spec.Egress, 1)
+	suite.Assert().Equal([]netv1.NetworkPolicyPort{
+		{
+			Protocol: &udp,
+			Port:     &intstr.IntOrString{IntVal: 10000},
+			EndPort:  &endPort,
+		},
+	}, existingNP.Spec.Egress[0].Ports)
+
+	tcp := corev1.ProtocolTCP
+	suite.Require().Len(existingNP.Spec.Ingress, 1)
+	suite.Assert().Equal([]netv1.NetworkPolicyPort{
+		{
+			Protocol: &tcp,
+			Port:     &intstr.IntOrString{Type: intstr.String, StrVal: "http"},
+		},
+	}, existingNP.Spec.Ingress[0].Ports)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerExternalIPExceptReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP:     "10.0.0.0/8",
+						Except: []string{"10.1.0.0/16", "10.2.2.2"},
+					},
+				},
+			},
+			AllowedFrom: []v1alpha1.ACLSpecAllowedFrom{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP:     "192.168.0.0/16",
+						Except: []string{"192.168.1.0/24"},
+					},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingNP := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "acl-myapp",
+	}, existingNP)
+	suite.Require().NoError(err)
+
+	suite.Require().Len(existingNP.Spec.Egress, 1)
+	suite.Assert().Equal([]netv1.NetworkPolicyPeer{
+		{
+			IPBlock: &netv1.IPBlock{
+				CIDR:   "10.0.0.0/8",
+				Except: []string{"10.1.0.0/16", "10.2.2.2/32"},
+			},
+		},
+	}, existingNP.Spec.Egress[0].To)
+
+	suite.Require().Len(existingNP.Spec.Ingress, 1)
+	suite.Assert().Equal([]netv1.NetworkPolicyPeer{
+		{
+			IPBlock: &netv1.IPBlock{
+				CIDR:   "192.168.0.0/16",
+				Except: []string{"192.168.1.0/24"},
+			},
+		},
+	}, existingNP.Spec.Ingress[0].From)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerDenyNotSupportedReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.0.0.0/8",
+					},
+				},
+				{
+					RuleID: "metadata",
+					Action: v1alpha1.ACLActionDeny,
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "169.254.169.254",
+					},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]v1alpha1.ACLStatusRuleError{
+		{
+			RuleID: "metadata",
+			Error:  "deny rules are not supported by the networkpolicy policy backend",
+		},
+	}, existingACL.Status.RuleErrors)
+
+	existingNP := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "acl-myapp",
+	}, existingNP)
+	suite.Require().NoError(err)
+	suite.Require().Len(existingNP.Spec.Egress, 1)
+	suite.Assert().Equal("10.0.0.0/8", existingNP.Spec.Egress[0].To[0].IPBlock.CIDR)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerAllowedFromAndDestinationsReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mydb",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "mydb",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "1.1.1.1/32",
+					},
+				},
+			},
+			AllowedFrom: []v1alpha1.ACLSpecAllowedFrom{
+				{
+					RuleID:   "app-1",
+					TsuruApp: "my-other-app",
+				},
+			},
+		},
+	}
+
+	tsuruAppAddress := &v1alpha1.TsuruAppAddress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "my-other-app",
+		},
+		Spec: v1alpha1.TsuruAppAddressSpec{
+			Name: "my-other-app",
+		},
+		Status: v1alpha1.ResourceAddressStatus{
+			Ready: true,
+			Pool:  "my-pool",
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl, tsuruAppAddress).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "mydb",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().True(existingACL.Status.Ready)
+
+	existingNP := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: existingACL.Namespace,
+		Name:      existingACL.Status.NetworkPolicy,
+	}, existingNP)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]netv1.PolicyType{netv1.PolicyTypeEgress, netv1.PolicyTypeIngress}, existingNP.Spec.PolicyTypes)
+	suite.Require().Len(existingNP.Spec.Egress, 1)
+	suite.Require().Len(existingNP.Spec.Ingress, 1)
+	suite.Assert().Equal([]netv1.NetworkPolicyPeer{
+		{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"tsuru.io/app-name": "my-other-app",
+				},
+			},
+		},
+		{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"tsuru.io/app-name": "my-other-app",
+				},
+			},
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"name": "tsuru-my-pool",
+				},
+			},
+		},
+	}, existingNP.Spec.Ingress[0].From)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerAllowedFromPortsReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mydb",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "mydb",
+			},
+			AllowedFrom: []v1alpha1.ACLSpecAllowedFrom{
+				{
+					TsuruApp: "my-other-app",
+					Ports: v1alpha1.ACLSpecProtoPorts{
+						{Protocol: "tcp", Number: 5432},
+					},
+				},
+				{
+					TsuruAppPool: "my-pool",
+					Ports: v1alpha1.ACLSpecProtoPorts{
+						{Protocol: "tcp", Number: 5433},
+					},
+				},
+				{
+					RpaasInstance: &v1alpha1.ACLSpecRpaasInstance{
+						ServiceName: "rpaasv2-be",
+						Instance:    "my-instance",
+					},
+					Ports: v1alpha1.ACLSpecProtoPorts{
+						{Protocol: "tcp", Name: "metrics"},
+					},
+				},
+			},
+		},
+	}
+
+	tsuruAppAddress := &v1alpha1.TsuruAppAddress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "my-other-app",
+		},
+		Spec: v1alpha1.TsuruAppAddressSpec{
+			Name: "my-other-app",
+		},
+		Status: v1alpha1.ResourceAddressStatus{
+			Ready: true,
+		},
+	}
+
+	rpaasInstanceAddress := &v1alpha1.RpaasInstanceAddress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "rpaasv2-be-my-instance",
+		},
+		Spec: v1alpha1.RpaasInstanceAddressSpec{
+			ServiceName: "rpaasv2-be",
+			Instance:    "my-instance",
+		},
+		Status: v1alpha1.ResourceAddressStatus{
+			Ready: true,
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl, tsuruAppAddress, rpaasInstanceAddress).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "mydb",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingNP := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "acl-mydb",
+	}, existingNP)
+	suite.Require().NoError(err)
+	suite.Require().Len(existingNP.Spec.Ingress, 3)
+
+	tcp := corev1.ProtocolTCP
+	suite.Assert().Equal([]netv1.NetworkPolicyPort{
+		{Protocol: &tcp, Port: &intstr.IntOrString{IntVal: 5432}},
+	}, existingNP.Spec.Ingress[0].Ports)
+	suite.Assert().Equal([]netv1.NetworkPolicyPort{
+		{Protocol: &tcp, Port: &intstr.IntOrString{IntVal: 5433}},
+	}, existingNP.Spec.Ingress[1].Ports)
+	suite.Assert().Equal([]netv1.NetworkPolicyPort{
+		{Protocol: &tcp, Port: &intstr.IntOrString{Type: intstr.String, StrVal: "metrics"}},
+	}, existingNP.Spec.Ingress[2].Ports)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerAllowedFromAndDestinationSameRuleIDErrors() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mydb",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "mydb",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					RuleID: "rule-1",
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.0.0.300",
+					},
+				},
+			},
+			AllowedFrom: []v1alpha1.ACLSpecAllowedFrom{
+				{
+					RuleID: "rule-1",
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "example.com",
+					},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "mydb",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().False(existingACL.Status.Ready)
+	suite.Assert().Equal([]v1alpha1.ACLStatusRuleError{
+		{
+			RuleID: "rule-1",
+			Error:  `invalid IP address "10.0.0.300"`,
+		},
+		{
+			RuleID: "rule-1",
+			Error:  `invalid IP address "example.com"`,
+		},
+	}, existingACL.Status.RuleErrors)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerDestinationKubernetesServiceReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					RuleID: "kafka",
+					KubernetesService: &v1alpha1.ACLSpecKubernetesService{
+						Namespace:   "kafka",
+						Name:        "kafka-bootstrap",
+						ClusterName: "my-cluster",
+					},
+				},
+				{
+					RuleID: "redis",
+					KubernetesService: &v1alpha1.ACLSpecKubernetesService{
+						Namespace:   "redis",
+						Name:        "redis",
+						ClusterName: "other-cluster",
+					},
+				},
+			},
+		},
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kafka-bootstrap",
+			Namespace: "kafka",
+		},
+		Spec: corev1.ServiceSpec{
+			Type:       corev1.ServiceTypeClusterIP,
+			ClusterIP:  "10.96.0.10",
+			ClusterIPs: []string{"10.96.0.10"},
+			Selector: map[string]string{
+				"app": "kafka",
+			},
+			Ports: []corev1.ServicePort{
+				{
+					Protocol:   corev1.ProtocolTCP,
+					Port:       9092,
+					TargetPort: intstr.FromInt(19092),
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:      fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl, svc).Build(),
+		Scheme:      scheme.Scheme,
+		Resolver:    &fakeResolver{},
+		TsuruAPI:    &fakeTsuruAPI{},
+		ClusterName: "my-cluster",
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]v1alpha1.ACLStatusRuleError{
+		{
+			RuleID: "redis",
+			Error:  `service redis/redis belongs to cluster "other-cluster", not to "my-cluster"`,
+		},
+	}, existingACL.Status.RuleErrors)
+
+	existingNP := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: existingACL.Namespace,
+		Name:      existingACL.Status.NetworkPolicy,
+	}, existingNP)
+	suite.Require().NoError(err)
+
+	tcp := corev1.ProtocolTCP
+	// the cluster IP must not generate an additional rule without ports
+	suite.Require().Len(existingNP.Spec.Egress, 2)
+	suite.Assert().Equal(netv1.NetworkPolicyEgressRule{
+		Ports: []netv1.NetworkPolicyPort{
+			{
+				Port:     &intstr.IntOrString{IntVal: 19092},
+				Protocol: &tcp,
+			},
+		},
+		To: []netv1.NetworkPolicyPeer{
+			{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"app": "kafka",
+					},
+				},
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"name": "kafka",
+					},
+				},
+			},
+		},
+	}, existingNP.Spec.Egress[0])
+	suite.Assert().Equal(netv1.NetworkPolicyEgressRule{
+		Ports: []netv1.NetworkPolicyPort{
+			{
+				Port:     &intstr.IntOrString{IntVal: 9092},
+				Protocol: &tcp,
+			},
+		},
+		To: []netv1.NetworkPolicyPeer{
+			{
+				IPBlock: &netv1.IPBlock{
+					CIDR: "10.96.0.10/32",
+				},
+			},
+		},
+	}, existingNP.Spec.Egress[1])
+}
+
+func (suite *ControllerSuite) TestACLReconcilerSyncWholeNetworkReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP:               "10.1.1.1/32",
+						SyncWholeNetwork: true,
+					},
+				},
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP:               "2001:db8:1:2::10",
+						SyncWholeNetwork: true,
+					},
+				},
+				{
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name:             "partner.io",
+						SyncWholeNetwork: true,
+					},
+				},
+			},
+		},
+	}
+
+	dnsEntry := &v1alpha1.ACLDNSEntry{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "partner.io",
+		},
+		Spec: v1alpha1.ACLDNSEntrySpec{
+			Host: "partner.io",
+		},
+		Status: v1alpha1.ACLDNSEntryStatus{
+			Ready: true,
+			IPs: []v1alpha1.ACLDNSEntryStatusIP{
+				{
+					Address: "200.1.2.3",
+				},
+				{
+					Address: "200.1.2.200",
+				},
+				{
+					Address: "200.1.3.3",
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl, dnsEntry).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+
+		WholeNetworkIPv4PrefixLength: 24,
+		WholeNetworkIPv6PrefixLength: 48,
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().True(existingACL.Status.Ready)
+
+	existingNP := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: existingACL.Namespace,
+		Name:      existingACL.Status.NetworkPolicy,
+	}, existingNP)
+	suite.Require().NoError(err)
+	suite.Require().Len(existingNP.Spec.Egress, 1)
+	suite.Assert().Equal([]netv1.NetworkPolicyPeer{
+		{IPBlock: &netv1.IPBlock{CIDR: "10.1.1.0/24"}},
+		{IPBlock: &netv1.IPBlock{CIDR: "2001:db8:1::/48"}},
+		{IPBlock: &netv1.IPBlock{CIDR: "200.1.2.0/24"}},
+		{IPBlock: &netv1.IPBlock{CIDR: "200.1.3.0/24"}},
+	}, existingNP.Spec.Egress[0].To)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerWildcardDNSNotSupportedReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name: ".example.com",
+					},
+				},
+				{
+					RuleID: "wildcard-2",
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name: ".example.org",
+					},
+				},
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.1.1.1/32",
+					},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]v1alpha1.ACLStatusRuleError{
+		{
+			RuleID: "externalDNS/.example.com",
+			Error:  `wildcard DNS ".example.com" is not supported by the networkpolicy policy backend`,
+		},
+		{
+			RuleID: "wildcard-2",
+			Error:  `wildcard DNS ".example.org" is not supported by the networkpolicy policy backend`,
+		},
+	}, existingACL.Status.RuleErrors)
+
+	dnsEntries := &v1alpha1.ACLDNSEntryList{}
+	err = reconciler.Client.List(ctx, dnsEntries)
+	suite.Require().NoError(err)
+	suite.Assert().Len(dnsEntries.Items, 0)
+
+	existingNP := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: existingACL.Namespace,
+		Name:      existingACL.Status.NetworkPolicy,
+	}, existingNP)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]netv1.NetworkPolicyEgressRule{
+		{
+			To: []netv1.NetworkPolicyPeer{
+				{IPBlock: &netv1.IPBlock{CIDR: "10.1.1.1/32"}},
+			},
+		},
+	}, existingNP.Spec.Egress)
+}
+
+type fakeTsuruAPI struct{}
+
+func (f *fakeTsuruAPI) AppInfo(ctx context.Context, appName string) (*app.App, error) {
+	if appName == "my-other-app" {
+		return &app.App{
+			Name: appName,
+			Pool: "my-pool",
+			Routers: []appTypes.AppRouter{
+				{
+					Name: "https-router",
+					Addresses: []string{
+						"https://myapp.io",
+					},
+				},
+				{
+					Name: "http-router",
+					Addresses: []string{
+						"http.myapp.io",
+					},
+				},
+			},
+		}, nil
+	}
+
+	return nil, errors.New("no app found")
+}
+
+func (f *fakeTsuruAPI) ServiceInstanceInfo(ctx context.Context, service, instance string) (*tsuruapi.ServiceInstanceInfo, error) {
+	if service == "rpaasv2" && instance == "my-instance" {
+		return &tsuruapi.ServiceInstanceInfo{
+			CustomInfo: map[string]interface{}{
+				"Address": "3.3.3.3",
+			},
+		}, nil
+	}
+
+	return nil, errors.New("not implemented yet")
+}
+
+func TestValidResourceName(t *testing.T) {
+	expectations := map[string]string{
+		"user":         "user",
+		"*.globo.com":  "globo.com-102f523825",
+		".google.com":  "google.com-5d59719991",
+		"10.1.1.1/10":  "10.1.1.1-10-22f870d4a0",
+		"facebook.com": "facebook.com",
+
+		strings.Repeat("testing-", 30): "testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing-testing--2744fb94f9",
+	}
+
+	for input, expectedOutput := range expectations {
+		output := validResourceName(input)
+		assert.Equal(t, expectedOutput, output, "input", input)
+
+		errs := validation.IsDNS1123Subdomain(output)
+
+		assert.Len(t, errs, 0)
+	}
+}
+
+func (suite *ControllerSuite) TestACLReconcilerAuditModeReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Mode: v1alpha1.ACLModeAudit,
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.1.1.1/32",
+					},
+				},
+			},
+		},
+		Status: v1alpha1.ACLStatus{
+			NetworkPolicy: "acl-myapp",
+		},
+	}
+
+	appliedNetworkPolicy := &netv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "acl-myapp",
+			Namespace:         "default",
+			CreationTimestamp: metav1.Now(),
+		},
+		Spec: netv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"tsuru.io/app-name": "myapp",
+				},
+			},
+			PolicyTypes: []netv1.PolicyType{netv1.PolicyTypeEgress},
+			Egress: []netv1.NetworkPolicyEgressRule{
+				{
+					To: []netv1.NetworkPolicyPeer{
+						{IPBlock: &netv1.IPBlock{CIDR: "10.0.0.1/32"}},
+					},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl, appliedNetworkPolicy).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().True(existingACL.Status.Ready)
+	suite.Assert().True(meta.IsStatusConditionFalse(existingACL.Status.Conditions, v1alpha1.ConditionPolicyApplied))
+	suite.Require().NotNil(existingACL.Status.Audit)
+	suite.Assert().Equal(`--- applied/acl-myapp
++++ audit/acl-myapp
+@@ -1,7 +1,7 @@
+ egress:
+ - to:
+   - ipBlock:
+-      cidr: 10.0.0.1/32
++      cidr: 10.1.1.1/32
+ podSelector:
+   matchLabels:
+     tsuru.io/app-name: myapp
+`, existingACL.Status.Audit.Diff)
+
+	auditNetworkPolicy := &netv1.NetworkPolicy{}
+	err = json.Unmarshal(existingACL.Status.Audit.Policy.Raw, auditNetworkPolicy)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("NetworkPolicy", auditNetworkPolicy.Kind)
+	suite.Assert().Equal("acl-myapp", auditNetworkPolicy.Name)
+	suite.Assert().Equal("10.1.1.1/32", auditNetworkPolicy.Spec.Egress[0].To[0].IPBlock.CIDR)
+
+	existingNetworkPolicy := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(appliedNetworkPolicy), existingNetworkPolicy)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(appliedNetworkPolicy.Spec, existingNetworkPolicy.Spec)
+
+	existingACL.Spec.Mode = ""
+	err = reconciler.Client.Update(ctx, existingACL)
+	suite.Require().NoError(err)
+	_, err = reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Nil(existingACL.Status.Audit)
+	suite.Assert().True(meta.IsStatusConditionTrue(existingACL.Status.Conditions, v1alpha1.ConditionPolicyApplied))
+
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(appliedNetworkPolicy), existingNetworkPolicy)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("10.1.1.1/32", existingNetworkPolicy.Spec.Egress[0].To[0].IPBlock.CIDR)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerEnforcedToAuditModeReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.1.1.1/32",
+					},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+	}
+	request := controllerruntime.Request{NamespacedName: client.ObjectKeyFromObject(acl)}
+	_, err := reconciler.Reconcile(ctx, request)
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"acl-myapp"}, existingACL.Status.NetworkPolicies)
+
+	// the fake client does not fill the creation timestamp
+	networkPolicy := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: "acl-myapp"}, networkPolicy)
+	suite.Require().NoError(err)
+	networkPolicy.CreationTimestamp = metav1.Now()
+	err = reconciler.Client.Update(ctx, networkPolicy)
+	suite.Require().NoError(err)
+
+	existingACL.Spec.Mode = v1alpha1.ACLModeAudit
+	existingACL.Spec.Destinations = append(existingACL.Spec.Destinations, v1alpha1.ACLSpecDestination{
+		ExternalIP: &v1alpha1.ACLSpecExternalIP{
+			IP: "10.2.2.2/32",
+		},
+	})
+	err = reconciler.Client.Update(ctx, existingACL)
+	suite.Require().NoError(err)
+
+	_, err = reconciler.Reconcile(ctx, request)
+	suite.Require().NoError(err)
+
+	// the policy last enforced is kept as is, the audit is compared to it
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{"acl-myapp"}, existingACL.Status.NetworkPolicies)
+	suite.Assert().True(meta.IsStatusConditionFalse(existingACL.Status.Conditions, v1alpha1.ConditionPolicyApplied))
+	suite.Require().NotNil(existingACL.Status.Audit)
+	suite.Assert().Contains(existingACL.Status.Audit.Diff, "+      cidr: 10.2.2.2/32\n")
+
+	err = reconciler.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: "acl-myapp"}, networkPolicy)
+	suite.Require().NoError(err)
+	suite.Require().Len(networkPolicy.Spec.Egress, 1)
+	suite.Assert().Equal([]netv1.NetworkPolicyPeer{
+		{IPBlock: &netv1.IPBlock{CIDR: "10.1.1.1/32"}},
+	}, networkPolicy.Spec.Egress[0].To)
+
+	// enforcing it again applies the audited rules
+	existingACL.Spec.Mode = v1alpha1.ACLModeEnforce
+	err = reconciler.Client.Update(ctx, existingACL)
+	suite.Require().NoError(err)
+
+	_, err = reconciler.Reconcile(ctx, request)
+	suite.Require().NoError(err)
+
+	err = reconciler.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: "acl-myapp"}, networkPolicy)
+	suite.Require().NoError(err)
+	suite.Require().Len(networkPolicy.Spec.Egress, 1)
+	suite.Assert().Len(networkPolicy.Spec.Egress[0].To, 2)
+
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Nil(existingACL.Status.Audit)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerShardedAuditModeReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Mode: v1alpha1.ACLModeAudit,
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{ExternalIP: &v1alpha1.ACLSpecExternalIP{IP: "10.1.1.1/32"}},
+				{ExternalIP: &v1alpha1.ACLSpecExternalIP{IP: "10.1.1.2/32"}},
+				{ExternalIP: &v1alpha1.ACLSpecExternalIP{IP: "10.1.1.3/32"}},
+			},
+		},
+		Status: v1alpha1.ACLStatus{
+			NetworkPolicy: "acl-myapp",
+		},
+	}
+
+	appliedNetworkPolicy := &netv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acl-myapp",
+			Namespace: "default",
+		},
+		Spec: netv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"tsuru.io/app-name": "myapp",
+				},
+			},
+			PolicyTypes: []netv1.PolicyType{netv1.PolicyTypeEgress},
+			Egress: []netv1.NetworkPolicyEgressRule{
+				{
+					To: []netv1.NetworkPolicyPeer{
+						{IPBlock: &netv1.IPBlock{CIDR: "10.0.0.1/32"}},
+					},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl, appliedNetworkPolicy).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+
+		MaxPolicyEgressPeers: 2,
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: client.ObjectKeyFromObject(acl),
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(existingACL.Status.Audit)
+
+	auditList := &netv1.NetworkPolicyList{}
+	err = json.Unmarshal(existingACL.Status.Audit.Policy.Raw, auditList)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("List", auditList.Kind)
+	suite.Require().Len(auditList.Items, 2)
+	suite.Assert().Equal("acl-myapp-0", auditList.Items[0].Name)
+	suite.Assert().Len(auditList.Items[0].Spec.Egress[0].To, 2)
+	suite.Assert().Equal("acl-myapp-1", auditList.Items[1].Name)
+	suite.Assert().Equal("10.1.1.3/32", auditList.Items[1].Spec.Egress[0].To[0].IPBlock.CIDR)
+
+	diff := existingACL.Status.Audit.Diff
+	suite.Assert().Contains(diff, "--- applied/acl-myapp-0\n+++ audit/acl-myapp-0\n")
+	suite.Assert().Contains(diff, "+      cidr: 10.1.1.2/32\n")
+	suite.Assert().Contains(diff, "--- applied/acl-myapp-1\n+++ audit/acl-myapp-1\n")
+	suite.Assert().Contains(diff, "+      cidr: 10.1.1.3/32\n")
+	suite.Assert().Contains(diff, "--- applied/acl-myapp\n+++ audit/acl-myapp\n")
+	suite.Assert().Contains(diff, "-      cidr: 10.0.0.1/32\n")
+
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(appliedNetworkPolicy), &netv1.NetworkPolicy{})
+	suite.Require().NoError(err)
+	err = reconciler.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: "acl-myapp-0"}, &netv1.NetworkPolicy{})
+	suite.Assert().True(k8sErrors.IsNotFound(err))
+}
+
+func (suite *ControllerSuite) TestACLReconcilerDefaultAuditModeReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.1.1.1/32",
+					},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:      fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:      scheme.Scheme,
+		Resolver:    &fakeResolver{},
+		TsuruAPI:    &fakeTsuruAPI{},
+		DefaultMode: v1alpha1.ACLModeAudit,
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("", existingACL.Status.NetworkPolicy)
+	suite.Require().NotNil(existingACL.Status.Audit)
+	suite.Assert().Contains(existingACL.Status.Audit.Diff, "+      cidr: 10.1.1.1/32\n")
+
+	networkPolicies := &netv1.NetworkPolicyList{}
+	err = reconciler.Client.List(ctx, networkPolicies)
+	suite.Require().NoError(err)
+	suite.Assert().Len(networkPolicies.Items, 0)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerShardedPolicyReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{ExternalIP: &v1alpha1.ACLSpecExternalIP{IP: "10.0.0.1/32"}},
+				{ExternalIP: &v1alpha1.ACLSpecExternalIP{IP: "10.0.0.2/32"}},
+				{ExternalIP: &v1alpha1.ACLSpecExternalIP{IP: "10.0.0.3/32"}},
+				{ExternalIP: &v1alpha1.ACLSpecExternalIP{IP: "10.0.0.4/32"}},
+				{ExternalIP: &v1alpha1.ACLSpecExternalIP{IP: "10.0.0.5/32"}},
+			},
+			AllowedFrom: []v1alpha1.ACLSpecAllowedFrom{
+				{ExternalIP: &v1alpha1.ACLSpecExternalIP{IP: "192.168.0.0/16"}},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		TsuruAPI: &fakeTsuruAPI{},
+
+		MaxPolicyEgressPeers: 2,
+	}
+	req := controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	}
+	_, err := reconciler.Reconcile(ctx, req)
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, req.NamespacedName, existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("acl-myapp", existingACL.Status.NetworkPolicy)
+	suite.Assert().Equal([]string{"acl-myapp-0", "acl-myapp-1", "acl-myapp-2"}, existingACL.Status.NetworkPolicies)
+
+	expectedEgress := [][]string{
+		{"10.0.0.1/32", "10.0.0.2/32"},
+		{"10.0.0.3/32", "10.0.0.4/32"},
+		{"10.0.0.5/32"},
+	}
+	for i, cidrs := range expectedEgress {
+		existingNP := &netv1.NetworkPolicy{}
+		err = reconciler.Client.Get(ctx, client.ObjectKey{
+			Namespace: "default",
+			Name:      existingACL.Status.NetworkPolicies[i],
+		}, existingNP)
+		suite.Require().NoError(err)
+
+		egressCIDRs := []string{}
+		for _, rule := range existingNP.Spec.Egress {
+			for _, peer := range rule.To {
+				egressCIDRs = append(egressCIDRs, peer.IPBlock.CIDR)
+			}
+		}
+		suite.Assert().Equal(cidrs, egressCIDRs)
+		suite.Assert().Equal(map[string]string{"tsuru.io/app-name": "myapp"}, existingNP.Spec.PodSelector.MatchLabels)
+
+		if i == 0 {
+			suite.Assert().Equal([]netv1.PolicyType{netv1.PolicyTypeEgress, netv1.PolicyTypeIngress}, existingNP.Spec.PolicyTypes)
+			suite.Assert().Len(existingNP.Spec.Ingress, 1)
+		} else {
+			suite.Assert().Equal([]netv1.PolicyType{netv1.PolicyTypeEgress}, existingNP.Spec.PolicyTypes)
+			suite.Assert().Empty(existingNP.Spec.Ingress)
+		}
+	}
+
+	existingACL.Spec.Destinations = existingACL.Spec.Destinations[:1]
+	err = reconciler.Client.Update(ctx, existingACL)
+	suite.Require().NoError(err)
+
+	_, err = reconciler.Reconcile(ctx, req)
+	suite.Require().NoError(err)
+
+	err = reconciler.Client.Get(ctx, req.NamespacedName, existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{"acl-myapp"}, existingACL.Status.NetworkPolicies)
+
+	existingNP := &netv1.NetworkPolicy{}
+	err = reconciler.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: "acl-myapp"}, existingNP)
+	suite.Require().NoError(err)
+	suite.Assert().Len(existingNP.Spec.Egress, 1)
+
+	for _, name := range []string{"acl-myapp-0", "acl-myapp-1", "acl-myapp-2"} {
+		err = reconciler.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, &netv1.NetworkPolicy{})
+		suite.Assert().True(k8sErrors.IsNotFound(err), name)
 	}
 }
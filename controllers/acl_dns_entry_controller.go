@@ -18,13 +18,17 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"reflect"
 	"sort"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -35,6 +39,12 @@ import (
 
 const dayFormat = "2006-01-02"
 
+const (
+	defaultMinResolveInterval = 30 * time.Second
+	defaultIPRetention        = 7 * 24 * time.Hour
+	defaultHistoryLimit       = 10
+)
+
 type ACLDNSResolver interface {
 	LookupIPAddr(context.Context, string) ([]net.IPAddr, error)
 }
@@ -46,6 +56,20 @@ type ACLDNSEntryReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Resolver ACLDNSResolver
+	Recorder record.EventRecorder
+
+	// MinResolveInterval and MaxResolveInterval clamp the TTL of the records
+	// when scheduling the next resolution of a host, records without a known
+	// TTL are resolved again after MaxResolveInterval.
+	MinResolveInterval time.Duration
+	MaxResolveInterval time.Duration
+
+	// Retention is the default retention policy of the addresses, entries
+	// may override it on their spec
+	Retention aclv1alpha1.ACLDNSEntryRetention
+
+	// HistoryLimit is the number of resolution results kept on the status
+	HistoryLimit int
 }
 
 //+kubebuilder:rbac:groups=extensions.tsuru.io,resources=ACLDNSEntrys,verbs=get;list;watch;create;update;patch;delete
@@ -65,14 +89,20 @@ func (r *ACLDNSEntryReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
+	if wait := r.untilNextResolution(dnsEntry); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
 	existingStatus := dnsEntry.Status.DeepCopy()
 
 	err = r.FillStatus(ctx, dnsEntry)
 	if err != nil {
 		l.Error(err, "could not resolve address", "host", dnsEntry.Spec.Host)
+		recordEvent(r.Recorder, dnsEntry, corev1.EventTypeWarning, eventReasonDNSResolutionFailed, fmt.Sprintf("could not resolve %s: %s", dnsEntry.Spec.Host, err.Error()))
 
 		dnsEntry.Status.Ready = false
 		dnsEntry.Status.Reason = err.Error()
+		setDNSEntryConditions(dnsEntry)
 
 		statusErr := r.Client.Status().Update(ctx, dnsEntry)
 		if statusErr != nil {
@@ -85,7 +115,9 @@ func (r *ACLDNSEntryReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}, nil
 	}
 
-	if !reflect.DeepEqual(existingStatus, dnsEntry.Status) {
+	setDNSEntryConditions(dnsEntry)
+
+	if !reflect.DeepEqual(existingStatus, &dnsEntry.Status) {
 		err = r.Client.Status().Update(ctx, dnsEntry)
 		if err != nil {
 			l.Error(err, "could not update status for ACLDNSEntry object")
@@ -93,58 +125,240 @@ func (r *ACLDNSEntryReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: r.untilNextResolution(dnsEntry)}, nil
+}
+
+// untilNextResolution returns how long the entry must wait to be resolved
+// again, zero when it must be resolved now.
+func (r *ACLDNSEntryReconciler) untilNextResolution(dnsEntry *aclv1alpha1.ACLDNSEntry) time.Duration {
+	status := dnsEntry.Status
+	if !status.Ready || status.NextResolution == nil || status.ObservedGeneration != dnsEntry.Generation {
+		return 0
+	}
+
+	wait := time.Until(status.NextResolution.Time)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// resolveInterval clamps the TTL of a resolution between the min and max
+// resolve intervals.
+func (r *ACLDNSEntryReconciler) resolveInterval(ttl time.Duration) time.Duration {
+	minInterval := r.MinResolveInterval
+	if minInterval <= 0 {
+		minInterval = defaultMinResolveInterval
+	}
+	maxInterval := r.MaxResolveInterval
+	if maxInterval <= 0 {
+		maxInterval = requeueAfter
+	}
+	if maxInterval < minInterval {
+		maxInterval = minInterval
+	}
+
+	if ttl <= 0 || ttl > maxInterval {
+		return maxInterval
+	}
+	if ttl < minInterval {
+		return minInterval
+	}
+	return ttl
 }
 
 func (r *ACLDNSEntryReconciler) FillStatus(ctx context.Context, dnsEntry *aclv1alpha1.ACLDNSEntry) error {
 	timoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	ipAddrs, err := r.Resolver.LookupIPAddr(timoutCtx, dnsEntry.Spec.Host)
+	lookup, err := lookupDNS(timoutCtx, r.Resolver, dnsEntry.Spec.Host)
+	now := time.Now().UTC().Truncate(time.Second)
+	r.recordResolution(dnsEntry, lookup, err, now)
 	if err != nil {
 		return err
 	}
 
-	now := time.Now().UTC()
-	validUntil := now.Add(7 * 24 * time.Hour)
+	dnsEntry.Status.CNAMEs = lookup.CNAMEs
+	dnsEntry.Status.Nameserver = lookup.Nameserver
 
-	missingIpAddrs := []net.IPAddr{}
-statusLoop:
-	for _, foundIP := range ipAddrs {
-		for i, existingIP := range dnsEntry.Status.IPs {
-			if existingIP.Address == foundIP.IP.String() {
-				dnsEntry.Status.IPs[i].ValidUntil = validUntil.Format(dayFormat)
-				continue statusLoop
-			}
+	ips := make([]aclv1alpha1.ACLDNSEntryStatusIP, 0, len(dnsEntry.Status.IPs)+len(lookup.Records))
+	ipIndex := map[string]int{}
+	for _, ip := range dnsEntry.Status.IPs {
+		migrateLegacyValidUntil(&ip)
+		ip.MissedResolutions++
+		ipIndex[ip.Address] = len(ips)
+		ips = append(ips, ip)
+	}
+
+	for _, record := range lookup.Records {
+		address := record.IP.String()
+		i, found := ipIndex[address]
+		if !found {
+			i = len(ips)
+			ipIndex[address] = i
+			ips = append(ips, aclv1alpha1.ACLDNSEntryStatusIP{
+				Address:   address,
+				FirstSeen: now.Format(time.RFC3339),
+			})
 		}
 
-		missingIpAddrs = append(missingIpAddrs, foundIP)
+		ips[i].LastSeen = now.Format(time.RFC3339)
+		ips[i].TTL = int32(record.TTL.Seconds())
+		ips[i].MissedResolutions = 0
+	}
+
+	dnsEntry.Status.IPs = applyRetention(ips, r.retentionPolicy(dnsEntry), now)
+
+	ttl := lookup.minTTL()
+	dnsEntry.Status.TTL = int32(ttl.Seconds())
+	nextResolution := metav1.NewTime(now.Add(r.resolveInterval(ttl)))
+	dnsEntry.Status.NextResolution = &nextResolution
+	dnsEntry.Status.Ready = true
+	dnsEntry.Status.Reason = ""
+
+	return nil
+}
+
+// recordResolution prepends the result of a resolution to the history of the
+// entry when it differs from the last recorded one.
+func (r *ACLDNSEntryReconciler) recordResolution(dnsEntry *aclv1alpha1.ACLDNSEntry, lookup *DNSLookup, err error, now time.Time) {
+	resolution := aclv1alpha1.ACLDNSEntryResolution{
+		Time: now.Format(time.RFC3339),
+	}
+	if err != nil {
+		resolution.Error = err.Error()
+	} else {
+		for _, record := range lookup.Records {
+			resolution.IPs = append(resolution.IPs, record.IP.String())
+		}
+		sort.Strings(resolution.IPs)
+		resolution.CNAMEs = lookup.CNAMEs
+		resolution.Nameserver = lookup.Nameserver
 	}
 
-	for _, foundIP := range missingIpAddrs {
-		dnsEntry.Status.IPs = append(dnsEntry.Status.IPs, aclv1alpha1.ACLDNSEntryStatusIP{
-			Address:    foundIP.IP.String(),
-			ValidUntil: validUntil.Format(dayFormat),
+	history := dnsEntry.Status.History
+	if len(history) > 0 {
+		// the nameserver alone does not make a new result, the upstreams
+		// that answer first vary between resolutions
+		last := history[0]
+		last.Time = resolution.Time
+		last.Nameserver = resolution.Nameserver
+		if reflect.DeepEqual(last, resolution) {
+			return
+		}
+	}
+
+	limit := r.HistoryLimit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	history = append([]aclv1alpha1.ACLDNSEntryResolution{resolution}, history...)
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	dnsEntry.Status.History = history
+}
+
+// retentionPolicy returns the retention of the entry, the limits it does not
+// set fall back to the ones of the reconciler.
+func (r *ACLDNSEntryReconciler) retentionPolicy(dnsEntry *aclv1alpha1.ACLDNSEntry) aclv1alpha1.ACLDNSEntryRetention {
+	retention := r.Retention
+	if retention.Duration == nil || retention.Duration.Duration <= 0 {
+		retention.Duration = &metav1.Duration{Duration: defaultIPRetention}
+	}
+
+	override := dnsEntry.Spec.Retention
+	if override == nil {
+		return retention
+	}
+	if override.Duration != nil && override.Duration.Duration > 0 {
+		retention.Duration = override.Duration
+	}
+	if override.MaxIPs > 0 {
+		retention.MaxIPs = override.MaxIPs
+	}
+	if override.KeepResolutions > 0 {
+		retention.KeepResolutions = override.KeepResolutions
+	}
+	return retention
+}
+
+// applyRetention removes the addresses that exceed any limit of the
+// retention, the addresses of the last resolution are always kept. The
+// result is sorted by address.
+func applyRetention(ips []aclv1alpha1.ACLDNSEntryStatusIP, retention aclv1alpha1.ACLDNSEntryRetention, now time.Time) []aclv1alpha1.ACLDNSEntryStatusIP {
+	kept := []aclv1alpha1.ACLDNSEntryStatusIP{}
+	current := 0
+	for _, ip := range ips {
+		// recomputed on every resolution so a shorter retention also
+		// applies to the addresses seen before it was configured
+		if lastSeen, ok := parseStatusTime(ip.LastSeen); ok {
+			ip.ValidUntil = lastSeen.Add(retention.Duration.Duration).Format(time.RFC3339)
+		}
+
+		validUntil, ok := parseStatusTime(ip.ValidUntil)
+		if !ok || now.After(validUntil) {
+			continue
+		}
+		if retention.KeepResolutions > 0 && ip.MissedResolutions >= retention.KeepResolutions {
+			continue
+		}
+
+		if ip.MissedResolutions == 0 {
+			current++
+		}
+		kept = append(kept, ip)
+	}
+
+	if retention.MaxIPs > 0 && len(kept) > int(retention.MaxIPs) {
+		sort.SliceStable(kept, func(i, j int) bool {
+			if kept[i].MissedResolutions != kept[j].MissedResolutions {
+				return kept[i].MissedResolutions < kept[j].MissedResolutions
+			}
+			return kept[i].LastSeen > kept[j].LastSeen
 		})
+
+		n := int(retention.MaxIPs)
+		if current > n {
+			n = current
+		}
+		kept = kept[:n]
 	}
 
-	sort.Slice(dnsEntry.Status.IPs, func(i, j int) bool {
-		return dnsEntry.Status.IPs[i].Address < dnsEntry.Status.IPs[j].Address
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].Address < kept[j].Address
 	})
 
-	n := 0
-	for _, ip := range dnsEntry.Status.IPs {
-		t, _ := time.Parse(dayFormat, ip.ValidUntil)
+	return kept
+}
 
-		if !now.After(t) && !t.IsZero() {
-			dnsEntry.Status.IPs[n] = ip
-			n++
+// migrateLegacyValidUntil moves the day written under the misspelled
+// validUtil key by previous versions to ValidUntil.
+func migrateLegacyValidUntil(ip *aclv1alpha1.ACLDNSEntryStatusIP) {
+	if ip.DeprecatedValidUntil == "" {
+		return
+	}
+	if ip.ValidUntil == "" {
+		if t, err := time.Parse(dayFormat, ip.DeprecatedValidUntil); err == nil {
+			// the address was valid until the end of the day
+			ip.ValidUntil = t.Add(24*time.Hour - time.Nanosecond).Format(time.RFC3339)
+		} else if t, ok := parseStatusTime(ip.DeprecatedValidUntil); ok {
+			ip.ValidUntil = t.Format(time.RFC3339)
 		}
 	}
-	dnsEntry.Status.IPs = dnsEntry.Status.IPs[:n]
-	dnsEntry.Status.Ready = true
-	dnsEntry.Status.Reason = ""
+	ip.DeprecatedValidUntil = ""
+}
 
-	return nil
+// parseStatusTime parses the RFC3339 timestamps of the status, days written
+// by previous versions are also accepted.
+func parseStatusTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(dayFormat, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
 }
 
 // SetupWithManager sets up the controller with the Manager.
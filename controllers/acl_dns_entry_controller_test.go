@@ -4,14 +4,21 @@ import (
 	"context"
 	"errors"
 	"net"
+	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/tsuru/acl-operator/api/scheme"
 	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	controllerruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
 type fakeResolver struct {
@@ -135,6 +142,8 @@ func (suite *ControllerSuite) TestACLDNSEntryReconcilerSimpleReconcileExisting()
 	suite.Assert().Equal("8.8.4.4", existingResolver.Status.IPs[0].Address)
 	suite.Assert().Equal("8.8.8.8", existingResolver.Status.IPs[1].Address)
 	suite.Assert().Equal("9.9.9.9", existingResolver.Status.IPs[2].Address)
+	suite.Assert().True(meta.IsStatusConditionTrue(existingResolver.Status.Conditions, v1alpha1.ConditionReady))
+	suite.Assert().True(meta.IsStatusConditionTrue(existingResolver.Status.Conditions, v1alpha1.ConditionResolved))
 }
 
 func (suite *ControllerSuite) TestACLDNSEntryReconcilerTimeoutReconcile() {
@@ -148,10 +157,12 @@ func (suite *ControllerSuite) TestACLDNSEntryReconcilerTimeoutReconcile() {
 		},
 	}
 
+	recorder := record.NewFakeRecorder(10)
 	reconciler := &ACLDNSEntryReconciler{
 		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(resolver).Build(),
 		Scheme:   scheme.Scheme,
 		Resolver: &fakeResolver{},
+		Recorder: recorder,
 	}
 	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
 		NamespacedName: types.NamespacedName{
@@ -167,4 +178,332 @@ func (suite *ControllerSuite) TestACLDNSEntryReconcilerTimeoutReconcile() {
 	suite.Require().Len(existingResolver.Status.IPs, 0)
 	suite.Assert().False(existingResolver.Status.Ready)
 	suite.Assert().Equal("timeout for host", existingResolver.Status.Reason)
+
+	resolvedCondition := meta.FindStatusCondition(existingResolver.Status.Conditions, v1alpha1.ConditionResolved)
+	suite.Require().NotNil(resolvedCondition)
+	suite.Assert().Equal(v1.ConditionFalse, resolvedCondition.Status)
+	suite.Assert().Equal("timeout for host", resolvedCondition.Message)
+	suite.Assert().True(meta.IsStatusConditionFalse(existingResolver.Status.Conditions, v1alpha1.ConditionReady))
+	suite.Assert().True(meta.IsStatusConditionFalse(existingResolver.Status.Conditions, v1alpha1.ConditionStale))
+
+	suite.Require().Len(recorder.Events, 1)
+	suite.Assert().Equal("Warning DNSResolutionFailed could not resolve timeout.com.br: timeout for host", <-recorder.Events)
+}
+
+type fakeLookupResolver struct {
+	fakeResolver
+	lookups map[string]*DNSLookup
+	calls   int
+}
+
+func (f *fakeLookupResolver) Lookup(ctx context.Context, host string) (*DNSLookup, error) {
+	f.calls++
+	if lookup, ok := f.lookups[host]; ok {
+		return lookup, nil
+	}
+	return nil, errors.New("no mocks for host")
+}
+
+func (suite *ControllerSuite) TestACLDNSEntryReconcilerScheduleFromTTL() {
+	ctx := context.Background()
+	dnsEntry := &v1alpha1.ACLDNSEntry{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "cdn.example.com",
+		},
+		Spec: v1alpha1.ACLDNSEntrySpec{
+			Host: "cdn.example.com",
+		},
+	}
+
+	resolver := &fakeLookupResolver{
+		lookups: map[string]*DNSLookup{
+			"cdn.example.com": {
+				Records: []DNSRecord{
+					{IP: net.ParseIP("10.0.0.2"), TTL: 300 * time.Second},
+					{IP: net.ParseIP("10.0.0.1"), TTL: 120 * time.Second},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLDNSEntryReconciler{
+		Client:             fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(dnsEntry).Build(),
+		Scheme:             scheme.Scheme,
+		Resolver:           resolver,
+		MinResolveInterval: time.Minute,
+		MaxResolveInterval: time.Hour,
+	}
+	request := controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name: "cdn.example.com",
+		},
+	}
+
+	result, err := reconciler.Reconcile(ctx, request)
+	suite.Require().NoError(err)
+	suite.Assert().InDelta(120*time.Second, result.RequeueAfter, float64(2*time.Second))
+
+	existingDNSEntry := &v1alpha1.ACLDNSEntry{}
+	err = reconciler.Get(ctx, client.ObjectKeyFromObject(dnsEntry), existingDNSEntry)
+	suite.Require().NoError(err)
+
+	suite.Assert().True(existingDNSEntry.Status.Ready)
+	suite.Assert().Equal(int32(120), existingDNSEntry.Status.TTL)
+	suite.Require().Len(existingDNSEntry.Status.IPs, 2)
+	suite.Assert().Equal("10.0.0.1", existingDNSEntry.Status.IPs[0].Address)
+	suite.Assert().Equal(int32(120), existingDNSEntry.Status.IPs[0].TTL)
+	suite.Assert().Equal("10.0.0.2", existingDNSEntry.Status.IPs[1].Address)
+	suite.Assert().Equal(int32(300), existingDNSEntry.Status.IPs[1].TTL)
+	suite.Require().NotNil(existingDNSEntry.Status.NextResolution)
+	suite.Assert().WithinDuration(time.Now().Add(120*time.Second), existingDNSEntry.Status.NextResolution.Time, 2*time.Second)
+
+	// the status update triggers a new reconcile, the host is not resolved
+	// again before the next resolution
+	result, err = reconciler.Reconcile(ctx, request)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(1, resolver.calls)
+	suite.Assert().Greater(result.RequeueAfter, time.Duration(0))
+	suite.Assert().LessOrEqual(result.RequeueAfter, 120*time.Second)
+
+	existingDNSEntry.Status.NextResolution = &v1.Time{Time: time.Now().Add(-time.Second)}
+	err = reconciler.Status().Update(ctx, existingDNSEntry)
+	suite.Require().NoError(err)
+
+	_, err = reconciler.Reconcile(ctx, request)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(2, resolver.calls)
+}
+
+func TestACLDNSEntryReconcilerResolveInterval(t *testing.T) {
+	reconciler := &ACLDNSEntryReconciler{
+		MinResolveInterval: time.Minute,
+		MaxResolveInterval: time.Hour,
+	}
+
+	assert.Equal(t, time.Minute, reconciler.resolveInterval(5*time.Second))
+	assert.Equal(t, 5*time.Minute, reconciler.resolveInterval(5*time.Minute))
+	assert.Equal(t, time.Hour, reconciler.resolveInterval(24*time.Hour))
+	assert.Equal(t, time.Hour, reconciler.resolveInterval(0))
+
+	reconciler = &ACLDNSEntryReconciler{}
+	assert.Equal(t, defaultMinResolveInterval, reconciler.resolveInterval(time.Second))
+	assert.Equal(t, requeueAfter, reconciler.resolveInterval(0))
+}
+
+func (suite *ControllerSuite) TestACLDNSEntryReconcilerRetention() {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	seenAt := func(d time.Duration) string {
+		return now.Add(-d).Format(time.RFC3339)
+	}
+
+	dnsEntry := &v1alpha1.ACLDNSEntry{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "www.google.com.br",
+		},
+		Spec: v1alpha1.ACLDNSEntrySpec{
+			Host: "www.google.com.br",
+			Retention: &v1alpha1.ACLDNSEntryRetention{
+				Duration: &v1.Duration{Duration: 6 * time.Hour},
+			},
+		},
+		Status: v1alpha1.ACLDNSEntryStatus{
+			IPs: []v1alpha1.ACLDNSEntryStatusIP{
+				{Address: "1.1.1.1", FirstSeen: seenAt(48 * time.Hour), LastSeen: seenAt(7 * time.Hour), ValidUntil: seenAt(-time.Hour)},
+				{Address: "2.2.2.2", FirstSeen: seenAt(48 * time.Hour), LastSeen: seenAt(time.Hour), MissedResolutions: 3},
+				{Address: "3.3.3.3", FirstSeen: seenAt(48 * time.Hour), LastSeen: seenAt(2 * time.Hour), MissedResolutions: 1},
+				{Address: "8.8.8.8", FirstSeen: seenAt(48 * time.Hour), LastSeen: seenAt(time.Hour)},
+				{Address: "9.9.9.9", DeprecatedValidUntil: "2200-10-02"},
+			},
+		},
+	}
+
+	reconciler := &ACLDNSEntryReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(dnsEntry).Build(),
+		Scheme:   scheme.Scheme,
+		Resolver: &fakeResolver{},
+		Retention: v1alpha1.ACLDNSEntryRetention{
+			Duration:        &v1.Duration{Duration: 24 * time.Hour},
+			KeepResolutions: 4,
+		},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name: "www.google.com.br",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingDNSEntry := &v1alpha1.ACLDNSEntry{}
+	err = reconciler.Get(ctx, client.ObjectKeyFromObject(dnsEntry), existingDNSEntry)
+	suite.Require().NoError(err)
+
+	// 1.1.1.1 was last seen longer than the retention of the entry and
+	// 2.2.2.2 is missing from the last 4 resolutions
+	suite.Assert().Equal([]v1alpha1.ACLDNSEntryStatusIP{
+		{Address: "3.3.3.3", FirstSeen: seenAt(48 * time.Hour), LastSeen: seenAt(2 * time.Hour), ValidUntil: seenAt(-4 * time.Hour), MissedResolutions: 2},
+		{Address: "8.8.4.4", FirstSeen: seenAt(0), LastSeen: seenAt(0), ValidUntil: seenAt(-6 * time.Hour)},
+		{Address: "8.8.8.8", FirstSeen: seenAt(48 * time.Hour), LastSeen: seenAt(0), ValidUntil: seenAt(-6 * time.Hour)},
+		{Address: "9.9.9.9", ValidUntil: "2200-10-02T23:59:59Z", MissedResolutions: 1},
+	}, existingDNSEntry.Status.IPs)
+}
+
+func TestApplyRetentionMaxIPs(t *testing.T) {
+	now := time.Date(2022, 10, 20, 12, 0, 0, 0, time.UTC)
+	retention := v1alpha1.ACLDNSEntryRetention{
+		Duration: &v1.Duration{Duration: 24 * time.Hour},
+		MaxIPs:   3,
+	}
+
+	ips := []v1alpha1.ACLDNSEntryStatusIP{
+		{Address: "10.0.0.1", LastSeen: "2022-10-20T12:00:00Z"},
+		{Address: "10.0.0.2", LastSeen: "2022-10-20T10:00:00Z", MissedResolutions: 2},
+		{Address: "10.0.0.3", LastSeen: "2022-10-20T11:00:00Z", MissedResolutions: 1},
+		{Address: "10.0.0.4", LastSeen: "2022-10-20T12:00:00Z"},
+		{Address: "10.0.0.5", LastSeen: "2022-10-20T09:00:00Z", MissedResolutions: 3},
+	}
+
+	kept := []string{}
+	for _, ip := range applyRetention(ips, retention, now) {
+		kept = append(kept, ip.Address)
+	}
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.3", "10.0.0.4"}, kept)
+
+	// the addresses of the last resolution are kept even above the limit
+	retention.MaxIPs = 1
+	kept = []string{}
+	for _, ip := range applyRetention(ips, retention, now) {
+		kept = append(kept, ip.Address)
+	}
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.4"}, kept)
+}
+
+func TestACLDNSEntryReconcilerResolutionHistory(t *testing.T) {
+	resolver := &fakeLookupResolver{
+		lookups: map[string]*DNSLookup{
+			"cdn.example.com": {
+				Records:    []DNSRecord{{IP: net.ParseIP("10.0.0.2")}, {IP: net.ParseIP("10.0.0.1")}},
+				CNAMEs:     []string{"cdn.example.net", "edge.example.net"},
+				Nameserver: "10.0.0.10:53",
+			},
+		},
+	}
+	reconciler := &ACLDNSEntryReconciler{
+		Resolver:     resolver,
+		HistoryLimit: 2,
+	}
+	dnsEntry := &v1alpha1.ACLDNSEntry{
+		Spec: v1alpha1.ACLDNSEntrySpec{
+			Host: "cdn.example.com",
+		},
+	}
+
+	require.NoError(t, reconciler.FillStatus(context.Background(), dnsEntry))
+	require.NoError(t, reconciler.FillStatus(context.Background(), dnsEntry))
+	assert.Equal(t, []string{"cdn.example.net", "edge.example.net"}, dnsEntry.Status.CNAMEs)
+	assert.Equal(t, "10.0.0.10:53", dnsEntry.Status.Nameserver)
+	require.Len(t, dnsEntry.Status.History, 1)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, dnsEntry.Status.History[0].IPs)
+	assert.Equal(t, []string{"cdn.example.net", "edge.example.net"}, dnsEntry.Status.History[0].CNAMEs)
+	assert.NotEmpty(t, dnsEntry.Status.History[0].Time)
+
+	resolver.lookups["cdn.example.com"] = &DNSLookup{
+		Records:    []DNSRecord{{IP: net.ParseIP("10.0.0.3")}},
+		Nameserver: "10.0.0.10:53",
+	}
+	require.NoError(t, reconciler.FillStatus(context.Background(), dnsEntry))
+	assert.Empty(t, dnsEntry.Status.CNAMEs)
+	require.Len(t, dnsEntry.Status.History, 2)
+	assert.Equal(t, []string{"10.0.0.3"}, dnsEntry.Status.History[0].IPs)
+	assert.Empty(t, dnsEntry.Status.History[0].CNAMEs)
+
+	delete(resolver.lookups, "cdn.example.com")
+	require.Error(t, reconciler.FillStatus(context.Background(), dnsEntry))
+	require.Len(t, dnsEntry.Status.History, 2)
+	assert.Equal(t, "no mocks for host", dnsEntry.Status.History[0].Error)
+	assert.Empty(t, dnsEntry.Status.History[0].IPs)
+	assert.Equal(t, []string{"10.0.0.3"}, dnsEntry.Status.History[1].IPs)
+}
+
+func (suite *ControllerSuite) TestACLReconcilerEnsureDNSEntryUsesDNSEntryReconciler() {
+	ctx := context.Background()
+	resolver := &fakeLookupResolver{
+		lookups: map[string]*DNSLookup{
+			"cdn.example.com": {
+				Records: []DNSRecord{
+					{IP: net.ParseIP("10.0.0.1"), TTL: 120 * time.Second},
+				},
+			},
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	reconciler := &ACLReconciler{
+		Client:   c,
+		Scheme:   scheme.Scheme,
+		Resolver: resolver,
+		TsuruAPI: &fakeTsuruAPI{},
+		DNSEntryReconciler: &ACLDNSEntryReconciler{
+			Client:             c,
+			Scheme:             scheme.Scheme,
+			Resolver:           resolver,
+			MinResolveInterval: 10 * time.Minute,
+			MaxResolveInterval: time.Hour,
+		},
+	}
+
+	dnsEntry, err := reconciler.ensureDNSEntry(ctx, "cdn.example.com")
+	suite.Require().NoError(err)
+	suite.Require().Len(dnsEntry.Status.IPs, 1)
+	suite.Require().NotNil(dnsEntry.Status.NextResolution)
+	suite.Assert().WithinDuration(time.Now().Add(10*time.Minute), dnsEntry.Status.NextResolution.Time, 2*time.Second)
+}
+
+func TestDNSEntryAddressesChanged(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	next := v1.NewTime(now.Add(time.Minute))
+	oldEntry := &v1alpha1.ACLDNSEntry{
+		Status: v1alpha1.ACLDNSEntryStatus{
+			Ready: true,
+			IPs: []v1alpha1.ACLDNSEntryStatusIP{
+				{Address: "10.0.0.1", LastSeen: now.Format(time.RFC3339)},
+			},
+			NextResolution: &next,
+		},
+	}
+
+	rescheduled := oldEntry.DeepCopy()
+	later := v1.NewTime(now.Add(2 * time.Minute))
+	rescheduled.Status.NextResolution = &later
+	rescheduled.Status.IPs[0].LastSeen = now.Add(time.Minute).Format(time.RFC3339)
+	rescheduled.Status.TTL = 60
+	assert.False(t, dnsEntryAddressesChanged.Update(event.UpdateEvent{ObjectOld: oldEntry, ObjectNew: rescheduled}))
+
+	newAddress := rescheduled.DeepCopy()
+	newAddress.Status.IPs = append(newAddress.Status.IPs, v1alpha1.ACLDNSEntryStatusIP{Address: "10.0.0.2"})
+	assert.True(t, dnsEntryAddressesChanged.Update(event.UpdateEvent{ObjectOld: rescheduled, ObjectNew: newAddress}))
+
+	notReady := rescheduled.DeepCopy()
+	notReady.Status.Ready = false
+	assert.True(t, dnsEntryAddressesChanged.Update(event.UpdateEvent{ObjectOld: rescheduled, ObjectNew: notReady}))
+
+	assert.True(t, dnsEntryAddressesChanged.Create(event.CreateEvent{Object: oldEntry}))
+	assert.True(t, dnsEntryAddressesChanged.Delete(event.DeleteEvent{Object: oldEntry}))
+}
+
+func TestMigrateLegacyValidUntil(t *testing.T) {
+	ip := v1alpha1.ACLDNSEntryStatusIP{Address: "10.0.0.1", DeprecatedValidUntil: "2024-03-10"}
+	migrateLegacyValidUntil(&ip)
+	assert.Equal(t, v1alpha1.ACLDNSEntryStatusIP{Address: "10.0.0.1", ValidUntil: "2024-03-10T23:59:59Z"}, ip)
+
+	// an address valid until today is kept during the whole day
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	kept := applyRetention([]v1alpha1.ACLDNSEntryStatusIP{{Address: "10.0.0.1", ValidUntil: ip.ValidUntil}}, v1alpha1.ACLDNSEntryRetention{
+		Duration: &v1.Duration{Duration: time.Hour},
+	}, now)
+	assert.Len(t, kept, 1)
+
+	ip = v1alpha1.ACLDNSEntryStatusIP{Address: "10.0.0.1", ValidUntil: "2024-03-12T00:00:00Z", DeprecatedValidUntil: "2024-03-10"}
+	migrateLegacyValidUntil(&ip)
+	assert.Equal(t, v1alpha1.ACLDNSEntryStatusIP{Address: "10.0.0.1", ValidUntil: "2024-03-12T00:00:00Z"}, ip)
 }
@@ -10,7 +10,10 @@ import (
 	"github.com/tsuru/acl-operator/api/v1alpha1"
 	tsuruv1 "github.com/tsuru/tsuru/provision/kubernetes/pkg/apis/tsuru/v1"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -19,6 +22,9 @@ type ACLGarbageCollector struct {
 	DryRun       bool
 	DryRunOutput io.Writer
 	Logger       logr.Logger
+	Recorder     record.EventRecorder
+
+	PolicyBackend PolicyBackend
 }
 
 type appACLKey struct {
@@ -60,7 +66,7 @@ func (a *ACLGarbageCollector) Loop(ctx context.Context) error {
 		return err
 	}
 	tsuruApps := make(map[string]struct{}, len(allTsuruAppAddress))
-	appACLs := make(map[appACLKey]struct{}, len(allTsuruAppAddress)) // fair aproximation
+	appACLs := make(map[appACLKey][]string, len(allTsuruAppAddress)) // fair aproximation
 	for _, tsuruAppAddress := range allTsuruAppAddress {
 		tsuruApps[tsuruAppAddress.Spec.Name] = struct{}{}
 	}
@@ -85,10 +91,15 @@ func (a *ACLGarbageCollector) Loop(ctx context.Context) error {
 	}
 	for _, acl := range allACLSs {
 		if acl.Spec.Source.TsuruApp != "" {
-			appACLs[appACLKey{
+			key := appACLKey{
 				Namespace: acl.Namespace,
 				App:       acl.Spec.Source.TsuruApp,
-			}] = struct{}{}
+			}
+			aclName := acl.Spec.Source.TsuruApp
+			if acl.Spec.Source.TsuruAppProcess != "" {
+				aclName = acl.Name
+			}
+			appACLs[key] = append(appACLs[key], aclName)
 		}
 
 		if acl.Spec.Source.TsuruJob != "" {
@@ -116,6 +127,30 @@ func (a *ACLGarbageCollector) Loop(ctx context.Context) error {
 				}
 			}
 		}
+
+		for _, allowedFrom := range acl.Spec.AllowedFrom {
+			if allowedFrom.TsuruApp != "" {
+				delete(tsuruApps, allowedFrom.TsuruApp)
+			} else if allowedFrom.RpaasInstance != nil {
+				delete(rpaaInstances, *allowedFrom.RpaasInstance)
+			}
+		}
+	}
+
+	allPoolACLs, err := a.allPoolACLs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, poolACL := range allPoolACLs {
+		for _, destination := range poolACL.Spec.Destinations {
+			if destination.ExternalDNS != nil {
+				delete(dnsEntries, destination.ExternalDNS.Name)
+			} else if destination.TsuruApp != "" {
+				delete(tsuruApps, destination.TsuruApp)
+			} else if destination.RpaasInstance != nil {
+				delete(rpaaInstances, *destination.RpaasInstance)
+			}
+		}
 	}
 
 	allTsuruApps, err := a.allTsuruApps(ctx)
@@ -148,6 +183,25 @@ func (a *ACLGarbageCollector) Loop(ctx context.Context) error {
 		}
 	}
 
+	allTsuruJobRuns, err := a.allTsuruJobRuns(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tsuruJobRun := range allTsuruJobRuns {
+		delete(jobACLs, jobACLKey{
+			Job:       tsuruJobRun.Labels[tsuruJobLabel],
+			Namespace: tsuruJobRun.Namespace,
+		})
+	}
+
+	orphanObjects := []client.Object{}
+	if collector, ok := a.PolicyBackend.(PolicyBackendCollector); ok {
+		orphanObjects, err = collector.OrphanObjects(ctx, a.Client, allACLSs)
+		if err != nil {
+			return err
+		}
+	}
+
 	if a.DryRun {
 		for dnsEntry := range dnsEntries {
 			fmt.Fprintln(a.DryRunOutput, "dnsEntry is marked to delete", dnsEntry)
@@ -160,76 +214,112 @@ func (a *ACLGarbageCollector) Loop(ctx context.Context) error {
 			fmt.Fprintln(a.DryRunOutput, "rpaaInstance is marked to delete", rpaasInstanceName)
 		}
 
-		for appACL := range appACLs {
-			fmt.Fprintln(a.DryRunOutput, "APP ACL is marked to delete", appACL.Namespace, "/", appACL.App)
+		for appACL, aclNames := range appACLs {
+			for _, aclName := range aclNames {
+				fmt.Fprintln(a.DryRunOutput, "APP ACL is marked to delete", appACL.Namespace, "/", aclName)
+			}
 		}
 
 		for jobACL := range jobACLs {
 			fmt.Fprintln(a.DryRunOutput, "Job ACL is marked to delete", jobACL.Namespace, "/", jobACL.Job)
 		}
+
+		for _, obj := range orphanObjects {
+			fmt.Fprintln(a.DryRunOutput, obj.GetObjectKind().GroupVersionKind().Kind, "is marked to delete", obj.GetName())
+		}
 		return nil
 	}
 
 	for dnsEntry := range dnsEntries {
-		err = a.Delete(ctx, &v1alpha1.ACLDNSEntry{
+		obj := &v1alpha1.ACLDNSEntry{
 			ObjectMeta: v1.ObjectMeta{
 				Name: validResourceName(dnsEntry),
 			},
-		})
+		}
+		err = a.Delete(ctx, obj)
 		if err != nil {
 			a.Logger.Error(err, "failed to remove dnsEntry", "dnsEntry", dnsEntry)
+		} else {
+			a.recordGarbageCollected(obj, "no ACL references the host "+dnsEntry)
 		}
 	}
 
 	for tsuruApp := range tsuruApps {
-		err = a.Delete(ctx, &v1alpha1.TsuruAppAddress{
+		obj := &v1alpha1.TsuruAppAddress{
 			ObjectMeta: v1.ObjectMeta{
 				Name: validResourceName(tsuruApp),
 			},
-		})
+		}
+		err = a.Delete(ctx, obj)
 		if err != nil {
 			a.Logger.Error(err, "failed to remove tsuruAppAddress", "tsuruApp", tsuruApp)
+		} else {
+			a.recordGarbageCollected(obj, "no ACL references the tsuru app "+tsuruApp)
 		}
 	}
 
 	for _, rpaasInstanceName := range rpaaInstances {
-		err = a.Delete(ctx, &v1alpha1.RpaasInstanceAddress{
+		obj := &v1alpha1.RpaasInstanceAddress{
 			ObjectMeta: v1.ObjectMeta{
 				Name: rpaasInstanceName,
 			},
-		})
+		}
+		err = a.Delete(ctx, obj)
 		if err != nil {
 			a.Logger.Error(err, "failed to remove rpaasInstanceAddress", "rpaasInstanceAddress", rpaasInstanceName)
+		} else {
+			a.recordGarbageCollected(obj, "no ACL references the rpaas instance "+rpaasInstanceName)
 		}
 	}
 
-	for appACL := range appACLs {
-		err = a.Delete(ctx, &v1alpha1.ACL{
-			ObjectMeta: v1.ObjectMeta{
-				Namespace: appACL.Namespace,
-				Name:      appACL.App,
-			},
-		})
-		if err != nil {
-			a.Logger.Error(err, "failed to remove acl", "namespace", appACL.Namespace, "name", appACL.App)
+	for appACL, aclNames := range appACLs {
+		for _, aclName := range aclNames {
+			obj := &v1alpha1.ACL{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: appACL.Namespace,
+					Name:      aclName,
+				},
+			}
+			err = a.Delete(ctx, obj)
+			if err != nil {
+				a.Logger.Error(err, "failed to remove acl", "namespace", appACL.Namespace, "name", aclName)
+			} else {
+				a.recordGarbageCollected(obj, "the tsuru app "+appACL.App+" no longer exists")
+			}
 		}
 	}
 
 	for jobACL := range jobACLs {
-		err = a.Delete(ctx, &v1alpha1.ACL{
+		obj := &v1alpha1.ACL{
 			ObjectMeta: v1.ObjectMeta{
 				Namespace: jobACL.Namespace,
 				Name:      tsuruJobACLPrefix + jobACL.Job,
 			},
-		})
+		}
+		err = a.Delete(ctx, obj)
 		if err != nil {
 			a.Logger.Error(err, "failed to remove acl", "namespace", jobACL.Namespace, "name", jobACL.Job)
+		} else {
+			a.recordGarbageCollected(obj, "the tsuru job "+jobACL.Job+" no longer exists")
+		}
+	}
+
+	for _, obj := range orphanObjects {
+		err = a.Delete(ctx, obj)
+		if err != nil {
+			a.Logger.Error(err, "failed to remove orphan object", "kind", obj.GetObjectKind().GroupVersionKind().Kind, "name", obj.GetName())
+		} else {
+			a.recordGarbageCollected(obj, "the ACL of the object no longer exists")
 		}
 	}
 
 	return nil
 }
 
+func (a *ACLGarbageCollector) recordGarbageCollected(obj client.Object, message string) {
+	recordEvent(a.Recorder, obj, corev1.EventTypeNormal, eventReasonGarbageCollected, message)
+}
+
 func (a *ACLGarbageCollector) allACLs(ctx context.Context) ([]v1alpha1.ACL, error) {
 	result := []v1alpha1.ACL{}
 
@@ -256,6 +346,35 @@ func (a *ACLGarbageCollector) allACLs(ctx context.Context) ([]v1alpha1.ACL, erro
 	return result, nil
 }
 
+func (a *ACLGarbageCollector) allPoolACLs(ctx context.Context) ([]v1alpha1.PoolACL, error) {
+	result := []v1alpha1.PoolACL{}
+
+	continueToken := ""
+
+	for {
+		allPoolACLs := &v1alpha1.PoolACLList{}
+
+		err := a.List(ctx, allPoolACLs, &client.ListOptions{
+			Continue: continueToken,
+		})
+		if meta.IsNoMatchError(err) {
+			// the PoolACL CRD is not installed
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+		result = append(result, allPoolACLs.Items...)
+
+		if allPoolACLs.Continue == "" {
+			break
+		}
+
+		continueToken = allPoolACLs.Continue
+	}
+
+	return result, nil
+}
+
 func (a *ACLGarbageCollector) allDNSEntries(ctx context.Context) ([]v1alpha1.ACLDNSEntry, error) {
 	result := []v1alpha1.ACLDNSEntry{}
 
@@ -392,3 +511,36 @@ func (a *ACLGarbageCollector) allTsuruJobs(ctx context.Context) ([]batchv1.CronJ
 
 	return result, nil
 }
+
+// allTsuruJobRuns lists the Jobs of one-off tsuru jobs, they have no CronJob
+func (a *ACLGarbageCollector) allTsuruJobRuns(ctx context.Context) ([]batchv1.Job, error) {
+	result := []batchv1.Job{}
+
+	continueToken := ""
+
+	for {
+		allTsuruJobRuns := &batchv1.JobList{}
+
+		err := a.List(ctx, allTsuruJobRuns, &client.ListOptions{
+			Continue: continueToken,
+		}, client.HasLabels{tsuruJobLabel})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, job := range allTsuruJobRuns.Items {
+			if job.Labels[tsuruJobLabel] == "" {
+				continue
+			}
+			result = append(result, job)
+		}
+
+		if allTsuruJobRuns.Continue == "" {
+			break
+		}
+
+		continueToken = allTsuruJobRuns.Continue
+	}
+
+	return result, nil
+}
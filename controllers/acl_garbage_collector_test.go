@@ -10,9 +10,12 @@ import (
 	"github.com/tsuru/acl-operator/api/scheme"
 	"github.com/tsuru/acl-operator/api/v1alpha1"
 	tsuruv1 "github.com/tsuru/tsuru/provision/kubernetes/pkg/apis/tsuru/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
@@ -60,6 +63,37 @@ func TestLoopCleanAppACLDryRun(t *testing.T) {
 	assert.Contains(t, outputString, "APP ACL is marked to delete default / my-app")
 }
 
+func TestLoopCleanAppACLRecordsEvent(t *testing.T) {
+	ctx := context.Background()
+
+	acl := &v1alpha1.ACL{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: "default",
+			Name:      "my-app",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "my-app",
+			},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build()
+	gc := &ACLGarbageCollector{
+		Client:   c,
+		Recorder: recorder,
+	}
+	err := gc.Loop(ctx)
+	require.NoError(t, err)
+
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "my-app"}, &v1alpha1.ACL{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, "Normal GarbageCollected the tsuru app my-app no longer exists", <-recorder.Events)
+}
+
 func TestLoopIgnoreAppACL(t *testing.T) {
 	ctx := context.Background()
 
@@ -590,3 +624,117 @@ func TestLoopCleanJobACL(t *testing.T) {
 	}, existingACL)
 	assert.True(t, k8sErrors.IsNotFound(err))
 }
+
+func TestLoopCleanAppProcessACL(t *testing.T) {
+	ctx := context.Background()
+
+	acl := &v1alpha1.ACL{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: "default",
+			Name:      tsuruAppProcessACLName("my-app", "worker"),
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp:        "my-app",
+				TsuruAppProcess: "worker",
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build()
+	gc := &ACLGarbageCollector{
+		Client: client,
+	}
+	err := gc.Loop(ctx)
+	require.NoError(t, err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = client.Get(ctx, types.NamespacedName{
+		Namespace: acl.Namespace,
+		Name:      acl.Name,
+	}, existingACL)
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
+
+func TestLoopIgnoreOneOffJobACL(t *testing.T) {
+	ctx := context.Background()
+
+	acl := &v1alpha1.ACL{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: "default",
+			Name:      tsuruJobACLPrefix + "my-job",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruJob: "my-job",
+			},
+		},
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: "default",
+			Name:      "my-job-run",
+			Labels: map[string]string{
+				tsuruJobLabel: "my-job",
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl, job).Build()
+	gc := &ACLGarbageCollector{
+		Client: client,
+	}
+	err := gc.Loop(ctx)
+	require.NoError(t, err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = client.Get(ctx, types.NamespacedName{
+		Namespace: acl.Namespace,
+		Name:      acl.Name,
+	}, existingACL)
+	assert.NoError(t, err)
+}
+
+func TestLoopIgnoreDNSEntryOfPoolACLDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	poolACL := &v1alpha1.PoolACL{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "my-pool",
+		},
+		Spec: v1alpha1.PoolACLSpec{
+			Pool: "my-pool",
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name: "logs.example.com",
+					},
+				},
+			},
+		},
+	}
+
+	dnsEntries := []runtime.Object{}
+	for _, host := range []string{"logs.example.com", "unused.example.com"} {
+		dnsEntries = append(dnsEntries, &v1alpha1.ACLDNSEntry{
+			ObjectMeta: v1.ObjectMeta{
+				Name: host,
+			},
+			Spec: v1alpha1.ACLDNSEntrySpec{
+				Host: host,
+			},
+		})
+	}
+
+	output := &bytes.Buffer{}
+	gc := &ACLGarbageCollector{
+		Client:       fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(append(dnsEntries, poolACL)...).Build(),
+		DryRun:       true,
+		DryRunOutput: output,
+	}
+	err := gc.Loop(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, "dnsEntry is marked to delete unused.example.com\n", output.String())
+}
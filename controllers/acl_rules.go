@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/netip"
+	"sort"
+	"strings"
+
+	netv1 "k8s.io/api/networking/v1"
+)
+
+// normalizeEgressRules merges the rules with the same ports into a single
+// rule and removes duplicated peers, rules without peers allow every
+// destination and are kept apart. When aggregateCIDRs is true the IP blocks
+// without exceptions are collapsed into the smallest set of covering CIDRs.
+func normalizeEgressRules(rules []netv1.NetworkPolicyEgressRule, aggregateCIDRs bool) []netv1.NetworkPolicyEgressRule {
+	if len(rules) == 0 {
+		return rules
+	}
+
+	result := []netv1.NetworkPolicyEgressRule{}
+	ruleIndexByKey := map[string]int{}
+	peersByRule := []map[string]struct{}{}
+
+	for _, rule := range rules {
+		key := portsKey(rule.Ports)
+		if len(rule.To) == 0 {
+			key = "all/" + key
+		}
+
+		i, found := ruleIndexByKey[key]
+		if !found {
+			i = len(result)
+			ruleIndexByKey[key] = i
+			peersByRule = append(peersByRule, map[string]struct{}{})
+			result = append(result, netv1.NetworkPolicyEgressRule{
+				Ports: rule.Ports,
+			})
+		}
+
+		for _, peer := range rule.To {
+			peerJSON, _ := json.Marshal(peer)
+			if _, found := peersByRule[i][string(peerJSON)]; found {
+				continue
+			}
+			peersByRule[i][string(peerJSON)] = struct{}{}
+			result[i].To = append(result[i].To, peer)
+		}
+	}
+
+	if aggregateCIDRs {
+		for i := range result {
+			result[i].To = aggregatePeerCIDRs(result[i].To)
+		}
+	}
+
+	return result
+}
+
+// portsKey identifies a set of ports regardless of their order, the ports
+// of the rule are left untouched.
+func portsKey(ports []netv1.NetworkPolicyPort) string {
+	keys := make([]string, 0, len(ports))
+	for _, port := range ports {
+		portJSON, _ := json.Marshal(port)
+		keys = append(keys, string(portJSON))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// aggregatePeerCIDRs collapses adjacent and overlapping IP blocks into their
+// covering CIDRs, the allowed addresses are never widened. Peers that are not
+// IP blocks, or that have exceptions, are kept as they are.
+func aggregatePeerCIDRs(peers []netv1.NetworkPolicyPeer) []netv1.NetworkPolicyPeer {
+	if len(peers) == 0 {
+		return peers
+	}
+
+	result := make([]netv1.NetworkPolicyPeer, 0, len(peers))
+	prefixes := []netip.Prefix{}
+
+	for _, peer := range peers {
+		if peer.IPBlock == nil || len(peer.IPBlock.Except) > 0 {
+			result = append(result, peer)
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(peer.IPBlock.CIDR)
+		if err != nil {
+			result = append(result, peer)
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	for _, prefix := range aggregatePrefixes(prefixes) {
+		result = append(result, netv1.NetworkPolicyPeer{
+			IPBlock: &netv1.IPBlock{
+				CIDR: prefix.String(),
+			},
+		})
+	}
+
+	return result
+}
+
+func aggregatePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	sort.Slice(prefixes, func(i, j int) bool {
+		if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return prefixes[i].Bits() < prefixes[j].Bits()
+	})
+
+	result := []netip.Prefix{}
+	for _, prefix := range prefixes {
+		if len(result) > 0 && result[len(result)-1].Overlaps(prefix) {
+			continue // sorted by address, the previous prefix contains this one
+		}
+		result = append(result, prefix)
+
+		for len(result) > 1 {
+			last, previous := result[len(result)-1], result[len(result)-2]
+			if previous.Bits() != last.Bits() || previous.Bits() == 0 {
+				break
+			}
+
+			parent := netip.PrefixFrom(previous.Addr(), previous.Bits()-1).Masked()
+			if parent.Addr() != previous.Addr() || !parent.Contains(last.Addr()) {
+				break
+			}
+
+			result = append(result[:len(result)-2], parent)
+		}
+	}
+
+	return result
+}
+
+// subtractCIDRs returns the smallest set of CIDRs covering the addresses of
+// cidr that are not in except. An invalid cidr is returned as it is and
+// invalid excepts are ignored.
+func subtractCIDRs(cidr string, except []string) []string {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return []string{cidr}
+	}
+
+	exceptPrefixes := []netip.Prefix{}
+	for _, exceptCIDR := range except {
+		exceptPrefix, err := netip.ParsePrefix(exceptCIDR)
+		if err != nil {
+			continue
+		}
+		exceptPrefixes = append(exceptPrefixes, exceptPrefix.Masked())
+	}
+
+	result := []string{}
+	for _, remaining := range subtractPrefixes(prefix.Masked(), exceptPrefixes) {
+		result = append(result, remaining.String())
+	}
+	return result
+}
+
+func subtractPrefixes(prefix netip.Prefix, except []netip.Prefix) []netip.Prefix {
+	overlaps := false
+	for _, exceptPrefix := range except {
+		if !exceptPrefix.Overlaps(prefix) {
+			continue
+		}
+		if exceptPrefix.Bits() <= prefix.Bits() {
+			return nil // the except contains the whole prefix
+		}
+		overlaps = true
+	}
+	if !overlaps {
+		return []netip.Prefix{prefix}
+	}
+
+	// split the prefix in halves until they are either inside an except or
+	// apart from all of them
+	addr := prefix.Addr().AsSlice()
+	addr[prefix.Bits()/8] |= 0x80 >> (prefix.Bits() % 8)
+	upper, _ := netip.AddrFromSlice(addr)
+
+	return append(
+		subtractPrefixes(netip.PrefixFrom(prefix.Addr(), prefix.Bits()+1), except),
+		subtractPrefixes(netip.PrefixFrom(upper, prefix.Bits()+1), except)...,
+	)
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func ipBlockPeer(cidr string) netv1.NetworkPolicyPeer {
+	return netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{CIDR: cidr}}
+}
+
+func TestNormalizeEgressRules(t *testing.T) {
+	tcp := corev1.ProtocolTCP
+	httpsPorts := []netv1.NetworkPolicyPort{{Protocol: &tcp, Port: &intstr.IntOrString{IntVal: 443}}}
+	appPeer := netv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tsuru.io/app-name": "router"}},
+	}
+
+	rules := []netv1.NetworkPolicyEgressRule{
+		{To: []netv1.NetworkPolicyPeer{ipBlockPeer("10.0.0.1/32"), appPeer}},
+		{Ports: httpsPorts, To: []netv1.NetworkPolicyPeer{ipBlockPeer("10.0.0.1/32")}},
+		{To: []netv1.NetworkPolicyPeer{appPeer, ipBlockPeer("10.0.0.2/32")}},
+		{Ports: httpsPorts},
+		{Ports: httpsPorts, To: []netv1.NetworkPolicyPeer{ipBlockPeer("10.0.0.1/32"), ipBlockPeer("10.0.0.3/32")}},
+	}
+
+	assert.Equal(t, []netv1.NetworkPolicyEgressRule{
+		{To: []netv1.NetworkPolicyPeer{ipBlockPeer("10.0.0.1/32"), appPeer, ipBlockPeer("10.0.0.2/32")}},
+		{Ports: httpsPorts, To: []netv1.NetworkPolicyPeer{ipBlockPeer("10.0.0.1/32"), ipBlockPeer("10.0.0.3/32")}},
+		{Ports: httpsPorts},
+	}, normalizeEgressRules(rules, false))
+
+	assert.Equal(t, []netv1.NetworkPolicyEgressRule{
+		{To: []netv1.NetworkPolicyPeer{appPeer, ipBlockPeer("10.0.0.1/32"), ipBlockPeer("10.0.0.2/32")}},
+		{Ports: httpsPorts, To: []netv1.NetworkPolicyPeer{ipBlockPeer("10.0.0.1/32"), ipBlockPeer("10.0.0.3/32")}},
+		{Ports: httpsPorts},
+	}, normalizeEgressRules(rules, true))
+}
+
+func TestNormalizeEgressRulesPortsOrder(t *testing.T) {
+	tcp := corev1.ProtocolTCP
+	httpPort := netv1.NetworkPolicyPort{Protocol: &tcp, Port: &intstr.IntOrString{IntVal: 80}}
+	httpsPort := netv1.NetworkPolicyPort{Protocol: &tcp, Port: &intstr.IntOrString{IntVal: 443}}
+
+	rules := []netv1.NetworkPolicyEgressRule{
+		{Ports: []netv1.NetworkPolicyPort{httpPort, httpsPort}, To: []netv1.NetworkPolicyPeer{ipBlockPeer("10.0.0.1/32")}},
+		{Ports: []netv1.NetworkPolicyPort{httpsPort, httpPort}, To: []netv1.NetworkPolicyPeer{ipBlockPeer("10.0.0.2/32")}},
+	}
+
+	assert.Equal(t, []netv1.NetworkPolicyEgressRule{
+		{
+			Ports: []netv1.NetworkPolicyPort{httpPort, httpsPort},
+			To:    []netv1.NetworkPolicyPeer{ipBlockPeer("10.0.0.1/32"), ipBlockPeer("10.0.0.2/32")},
+		},
+	}, normalizeEgressRules(rules, false))
+	assert.Equal(t, []netv1.NetworkPolicyPort{httpsPort, httpPort}, rules[1].Ports)
+}
+
+func TestAggregatePeerCIDRs(t *testing.T) {
+	exceptPeer := netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}}
+
+	peers := []netv1.NetworkPolicyPeer{
+		ipBlockPeer("10.0.0.3/32"),
+		ipBlockPeer("10.0.0.0/32"),
+		exceptPeer,
+		ipBlockPeer("10.0.0.1/32"),
+		ipBlockPeer("10.0.0.2/32"),
+		ipBlockPeer("10.0.0.5/32"),
+		ipBlockPeer("192.168.0.0/24"),
+		ipBlockPeer("192.168.0.10/32"),
+		ipBlockPeer("192.168.1.0/24"),
+		ipBlockPeer("2001:db8::/128"),
+		ipBlockPeer("2001:db8::1/128"),
+	}
+
+	assert.Equal(t, []netv1.NetworkPolicyPeer{
+		exceptPeer,
+		ipBlockPeer("10.0.0.0/30"),
+		ipBlockPeer("10.0.0.5/32"),
+		ipBlockPeer("192.168.0.0/23"),
+		ipBlockPeer("2001:db8::/127"),
+	}, aggregatePeerCIDRs(peers))
+}
+
+func TestSubtractCIDRs(t *testing.T) {
+	assert.Equal(t, []string{
+		"10.0.0.0/16",
+		"10.1.0.0/24",
+		"10.1.1.0/27",
+		"10.1.1.64/26",
+		"10.1.1.128/25",
+		"10.1.2.0/23",
+		"10.1.4.0/22",
+		"10.1.8.0/21",
+		"10.1.16.0/20",
+		"10.1.32.0/19",
+		"10.1.64.0/18",
+		"10.1.128.0/17",
+		"10.2.0.0/15",
+	}, subtractCIDRs("10.0.0.0/14", []string{"10.1.1.32/27", "192.168.0.0/16", "2001:db8::/32"}))
+	assert.Equal(t, []string{}, subtractCIDRs("10.1.1.0/24", []string{"10.0.0.0/8"}))
+	assert.Equal(t, []string{"2001:db8::/128"}, subtractCIDRs("2001:db8::/127", []string{"2001:db8::1/128"}))
+	assert.Equal(t, []string{"invalid"}, subtractCIDRs("invalid", []string{"10.0.0.0/8"}))
+}
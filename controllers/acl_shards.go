@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	netv1 "k8s.io/api/networking/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// shardPolicy splits the egress rules of the policy across multiple policy
+// objects named <policy>-0..N, each one with at most maxPeers egress peers. The
+// first shard keeps the deny, ingress and native rules, the others only allow
+// egress to the same pods. Rules with more peers than maxPeers are split.
+func shardPolicy(policy *ACLPolicy, maxPeers int) []*ACLPolicy {
+	if maxPeers <= 0 || egressPeers(policy.Egress) <= maxPeers {
+		return []*ACLPolicy{policy}
+	}
+
+	chunks := [][]netv1.NetworkPolicyEgressRule{}
+	chunk := []netv1.NetworkPolicyEgressRule{}
+	chunkPeers := 0
+	for _, rule := range splitEgressRules(policy.Egress, maxPeers) {
+		rulePeers := egressPeers([]netv1.NetworkPolicyEgressRule{rule})
+		if len(chunk) > 0 && chunkPeers+rulePeers > maxPeers {
+			chunks = append(chunks, chunk)
+			chunk = []netv1.NetworkPolicyEgressRule{}
+			chunkPeers = 0
+		}
+		chunk = append(chunk, rule)
+		chunkPeers += rulePeers
+	}
+	chunks = append(chunks, chunk)
+
+	shards := make([]*ACLPolicy, 0, len(chunks))
+	for i, egress := range chunks {
+		shard := &ACLPolicy{
+			Name:        policyShardName(policy.Name, i),
+			PodSelector: policy.PodSelector,
+			PolicyTypes: []netv1.PolicyType{netv1.PolicyTypeEgress},
+			Egress:      egress,
+		}
+		if i == 0 {
+			shard.PolicyTypes = policy.PolicyTypes
+			shard.EgressDeny = policy.EgressDeny
+			shard.Ingress = policy.Ingress
+			shard.NativeDestinations = policy.NativeDestinations
+			shard.NativeDestinationPorts = policy.NativeDestinationPorts
+		}
+		shards = append(shards, shard)
+	}
+
+	return shards
+}
+
+// splitEgressRules splits the rules with more than maxPeers peers into rules
+// with the same ports.
+func splitEgressRules(rules []netv1.NetworkPolicyEgressRule, maxPeers int) []netv1.NetworkPolicyEgressRule {
+	result := make([]netv1.NetworkPolicyEgressRule, 0, len(rules))
+	for _, rule := range rules {
+		for len(rule.To) > maxPeers {
+			result = append(result, netv1.NetworkPolicyEgressRule{
+				Ports: rule.Ports,
+				To:    rule.To[:maxPeers],
+			})
+			rule.To = rule.To[maxPeers:]
+		}
+		result = append(result, rule)
+	}
+	return result
+}
+
+func policyShardName(policyName string, i int) string {
+	return policyName + "-" + strconv.Itoa(i)
+}
+
+// egressPeers counts the peers of the rules, rules without peers allow every
+// destination and count as one.
+func egressPeers(rules []netv1.NetworkPolicyEgressRule) int {
+	peers := 0
+	for _, rule := range rules {
+		if len(rule.To) == 0 {
+			peers++
+			continue
+		}
+		peers += len(rule.To)
+	}
+	return peers
+}
+
+// previousPolicyNames returns the policy objects applied by the last
+// reconcile of the ACL.
+func previousPolicyNames(acl *v1alpha1.ACL) []string {
+	if len(acl.Status.NetworkPolicies) == 0 && acl.Status.NetworkPolicy != "" {
+		return []string{acl.Status.NetworkPolicy} // ACLs reconciled before the sharding
+	}
+	return acl.Status.NetworkPolicies
+}
+
+// stalePolicyNames returns the previous policy objects that are no longer
+// generated, like shards left behind when the rules shrink.
+func stalePolicyNames(previous, current []string) []string {
+	currentNames := make(map[string]struct{}, len(current))
+	for _, name := range current {
+		currentNames[name] = struct{}{}
+	}
+
+	stale := []string{}
+	for _, name := range previous {
+		if _, found := currentNames[name]; !found {
+			stale = append(stale, name)
+		}
+	}
+	return stale
+}
+
+// removeStalePolicies deletes the policy objects of previous reconciles that
+// are no longer generated.
+func removeStalePolicies(ctx context.Context, c client.Client, backend PolicyBackend, acl *v1alpha1.ACL, previous, current []string) ([]string, error) {
+	removed := []string{}
+	for _, name := range stalePolicyNames(previous, current) {
+		obj := backend.NewObject()
+		obj.SetNamespace(acl.Namespace)
+		obj.SetName(name)
+		err := c.Delete(ctx, obj)
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return removed, fmt.Errorf("could not remove policy object %s: %w", name, err)
+		}
+
+		if remover, ok := backend.(PolicyBackendDependentsRemover); ok {
+			err = remover.RemovePolicyDependents(ctx, c, acl, name)
+			if err != nil {
+				return removed, fmt.Errorf("could not remove objects of policy object %s: %w", name, err)
+			}
+		}
+		removed = append(removed, name)
+	}
+
+	return removed, nil
+}
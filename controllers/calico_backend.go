@@ -0,0 +1,600 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	netv1 "k8s.io/api/networking/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+var (
+	calicoNetworkPolicyGVK = schema.GroupVersionKind{
+		Group:   "projectcalico.org",
+		Version: "v3",
+		Kind:    "NetworkPolicy",
+	}
+	calicoGlobalNetworkSetGVK = schema.GroupVersionKind{
+		Group:   "projectcalico.org",
+		Version: "v3",
+		Kind:    "GlobalNetworkSet",
+	}
+)
+
+const (
+	calicoACLNamespaceLabel = "extensions.tsuru.io/acl-namespace"
+	calicoACLNameLabel      = "extensions.tsuru.io/acl-name"
+	calicoNetworkSetLabel   = "extensions.tsuru.io/network-set"
+	calicoPolicyLabel       = "extensions.tsuru.io/acl-policy"
+
+	// DefaultCalicoPolicyOrder is the order of the calico policies, calico
+	// evaluates the policies with lower orders first and Kubernetes
+	// NetworkPolicies get the order 1000, so the deny rules of the ACLs are
+	// reached regardless of the allows of other policies.
+	DefaultCalicoPolicyOrder = 100
+
+	// calicoNetworkSetMinNets is the amount of networks of a rule from which
+	// they are moved to a GlobalNetworkSet instead of being inlined.
+	calicoNetworkSetMinNets = 20
+)
+
+// CalicoBackend enforces ACLs using projectcalico.org/v3 NetworkPolicy, large
+// lists of networks are stored on GlobalNetworkSet objects. ExternalDNS
+// destinations are allowed by their resolved addresses, as Calico OSS does
+// not support domains on the rules.
+var CalicoBackend PolicyBackend = NewCalicoBackend(DefaultCalicoPolicyOrder, false)
+
+// NewCalicoBackend returns a CalicoBackend whose policies have the given
+// order. With enterprise the ExternalDNS destinations are rendered as
+// destination.domains, which is only supported by Calico Enterprise.
+func NewCalicoBackend(order int64, enterprise bool) PolicyBackend {
+	return &calicoBackend{order: order, enterprise: enterprise}
+}
+
+type calicoPolicySpec struct {
+	Order    *int64       `json:"order,omitempty"`
+	Selector string       `json:"selector"`
+	Types    []string     `json:"types"`
+	Egress   []calicoRule `json:"egress,omitempty"`
+	Ingress  []calicoRule `json:"ingress,omitempty"`
+}
+
+type calicoRule struct {
+	Action      string            `json:"action"`
+	Protocol    string            `json:"protocol,omitempty"`
+	Source      *calicoEntityRule `json:"source,omitempty"`
+	Destination *calicoEntityRule `json:"destination,omitempty"`
+}
+
+type calicoEntityRule struct {
+	Nets              []string             `json:"nets,omitempty"`
+	NotNets           []string             `json:"notNets,omitempty"`
+	Selector          string               `json:"selector,omitempty"`
+	NamespaceSelector string               `json:"namespaceSelector,omitempty"`
+	Domains           []string             `json:"domains,omitempty"`
+	Ports             []intstr.IntOrString `json:"ports,omitempty"`
+}
+
+type calicoNetworkSetSpec struct {
+	Nets []string `json:"nets"`
+}
+
+// calicoPorts groups the ports by protocol, calico rules have a single
+// protocol.
+type calicoPorts struct {
+	protocols []string
+	ports     map[string][]intstr.IntOrString
+}
+
+type calicoBackend struct {
+	order      int64
+	enterprise bool
+}
+
+func (b *calicoBackend) Name() string {
+	return "calico"
+}
+
+func (b *calicoBackend) ValidateDestination(destination v1alpha1.ACLSpecDestination) error {
+	if destination.ExternalDNS == nil {
+		return nil
+	}
+
+	if !b.enterprise {
+		if isWildCard(destination.ExternalDNS.Name) {
+			return fmt.Errorf("wildcard DNS %q is only supported by the %s policy backend on Calico Enterprise", destination.ExternalDNS.Name, b.Name())
+		}
+		return nil
+	}
+
+	if destination.Action == v1alpha1.ACLActionDeny {
+		return fmt.Errorf("deny rules for externalDNS are not supported by the %s policy backend", b.Name())
+	}
+
+	return nil
+}
+
+func (b *calicoBackend) IsNativeDestination(destination v1alpha1.ACLSpecDestination) bool {
+	return b.enterprise && destination.ExternalDNS != nil
+}
+
+func (b *calicoBackend) NewObject() client.Object {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(calicoNetworkPolicyGVK)
+	return obj
+}
+
+// Render returns only the calico NetworkPolicy, the GlobalNetworkSets it
+// references are not part of the result.
+func (b *calicoBackend) Render(acl *v1alpha1.ACL, policy *ACLPolicy) (client.Object, error) {
+	renderer := &calicoRenderer{
+		acl:    acl,
+		policy: policy.Name,
+	}
+	return b.renderPolicy(acl, policy, renderer)
+}
+
+func (b *calicoBackend) renderPolicy(acl *v1alpha1.ACL, policy *ACLPolicy, renderer *calicoRenderer) (*unstructured.Unstructured, error) {
+	policySpec := renderer.policySpec(policy)
+	policySpec.Order = &b.order
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(policySpec)
+	if err != nil {
+		return nil, err
+	}
+
+	calicoPolicy := b.NewObject().(*unstructured.Unstructured)
+	calicoPolicy.SetNamespace(acl.Namespace)
+	calicoPolicy.SetName(policy.Name)
+	calicoPolicy.SetOwnerReferences([]metav1.OwnerReference{
+		*metav1.NewControllerRef(acl, acl.GroupVersionKind()),
+	})
+	calicoPolicy.Object["spec"] = spec
+
+	return calicoPolicy, nil
+}
+
+func (b *calicoBackend) Ensure(ctx context.Context, c client.Client, acl *v1alpha1.ACL, policy *ACLPolicy) (controllerutil.OperationResult, error) {
+	renderer := &calicoRenderer{
+		acl:    acl,
+		policy: policy.Name,
+	}
+	calicoPolicy, err := b.renderPolicy(acl, policy, renderer)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	result := controllerutil.OperationResultNone
+	desiredNetworkSets := map[string]struct{}{}
+	for _, networkSet := range renderer.networkSets {
+		desiredNetworkSets[networkSet.GetName()] = struct{}{}
+
+		networkSetResult, err := ensureUnstructured(ctx, c, networkSet)
+		if err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+		if networkSetResult != controllerutil.OperationResultNone {
+			result = controllerutil.OperationResultUpdated
+		}
+	}
+
+	policyResult, err := ensureUnstructured(ctx, c, calicoPolicy)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	if policyResult != controllerutil.OperationResultNone {
+		result = policyResult
+	}
+
+	// network sets are removed only after the policy stops referencing them,
+	// the ones of other shards of the ACL are left alone. Sets created before
+	// they were labeled by policy are removed by any of the shards.
+	existingNetworkSets, err := calicoNetworkSets(ctx, c, client.MatchingLabels{
+		calicoACLNamespaceLabel: acl.Namespace,
+		calicoACLNameLabel:      acl.Name,
+	})
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	for i := range existingNetworkSets {
+		if _, found := desiredNetworkSets[existingNetworkSets[i].GetName()]; found {
+			continue
+		}
+		shard, labeled := existingNetworkSets[i].GetLabels()[calicoPolicyLabel]
+		if labeled && shard != calicoLabelValue(policy.Name) {
+			continue
+		}
+
+		err = c.Delete(ctx, &existingNetworkSets[i])
+		if err != nil {
+			return controllerutil.OperationResultNone, fmt.Errorf("could not delete GlobalNetworkSet object: %w", err)
+		}
+		if result == controllerutil.OperationResultNone {
+			result = controllerutil.OperationResultUpdated
+		}
+	}
+
+	return result, nil
+}
+
+// RemovePolicyDependents removes the GlobalNetworkSets of a policy object that
+// is no longer generated, like a shard left behind when the rules shrink.
+func (b *calicoBackend) RemovePolicyDependents(ctx context.Context, c client.Client, acl *v1alpha1.ACL, policyName string) error {
+	networkSets, err := calicoNetworkSets(ctx, c, client.MatchingLabels{
+		calicoACLNamespaceLabel: acl.Namespace,
+		calicoACLNameLabel:      acl.Name,
+		calicoPolicyLabel:       calicoLabelValue(policyName),
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range networkSets {
+		err = c.Delete(ctx, &networkSets[i])
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return fmt.Errorf("could not delete GlobalNetworkSet object: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// OrphanObjects returns the GlobalNetworkSets of ACLs that no longer exist.
+func (b *calicoBackend) OrphanObjects(ctx context.Context, c client.Client, acls []v1alpha1.ACL) ([]client.Object, error) {
+	existingACLs := map[string]struct{}{}
+	for _, acl := range acls {
+		existingACLs[acl.Namespace+"/"+acl.Name] = struct{}{}
+	}
+
+	networkSets, err := calicoNetworkSets(ctx, c, client.HasLabels{calicoACLNameLabel})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []client.Object{}
+	for i := range networkSets {
+		labels := networkSets[i].GetLabels()
+		if _, found := existingACLs[labels[calicoACLNamespaceLabel]+"/"+labels[calicoACLNameLabel]]; found {
+			continue
+		}
+		result = append(result, &networkSets[i])
+	}
+
+	return result, nil
+}
+
+func calicoNetworkSets(ctx context.Context, c client.Client, opts ...client.ListOption) ([]unstructured.Unstructured, error) {
+	result := []unstructured.Unstructured{}
+
+	continueToken := ""
+
+	for {
+		networkSets := &unstructured.UnstructuredList{}
+		networkSets.SetGroupVersionKind(calicoGlobalNetworkSetGVK.GroupVersion().WithKind(calicoGlobalNetworkSetGVK.Kind + "List"))
+
+		err := c.List(ctx, networkSets, append(opts, client.Continue(continueToken))...)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, networkSets.Items...)
+
+		if networkSets.GetContinue() == "" {
+			break
+		}
+
+		continueToken = networkSets.GetContinue()
+	}
+
+	return result, nil
+}
+
+type calicoRenderer struct {
+	acl *v1alpha1.ACL
+	// policy is the name of the rendered policy object, every shard of the
+	// ACL has its own network sets
+	policy      string
+	networkSets []*unstructured.Unstructured
+}
+
+func (r *calicoRenderer) policySpec(policy *ACLPolicy) *calicoPolicySpec {
+	spec := &calicoPolicySpec{
+		Selector: calicoSelector(&policy.PodSelector),
+		Types:    []string{},
+	}
+
+	for _, policyType := range policy.PolicyTypes {
+		spec.Types = append(spec.Types, string(policyType))
+
+		if policyType == netv1.PolicyTypeEgress {
+			spec.Egress = r.egressRules(policy)
+		} else if policyType == netv1.PolicyTypeIngress {
+			spec.Ingress = r.ingressRules(policy.Ingress)
+		}
+	}
+
+	return spec
+}
+
+// egressRules renders the deny rules first, calico evaluates the rules in
+// order and stops on the first match. The order of the policy puts it before
+// the other policies of the pods.
+func (r *calicoRenderer) egressRules(policy *ACLPolicy) []calicoRule {
+	result := r.egressPeerRules("Deny", policy.EgressDeny)
+
+	for _, destination := range policy.NativeDestinations {
+		if destination.ExternalDNS == nil {
+			continue
+		}
+
+		domain := destination.ExternalDNS.Name
+		if isWildCard(domain) {
+			domain = "*" + domain
+		}
+
+		ports := calicoProtoPorts(destination.ExternalDNS.Ports)
+		for _, protocol := range ports.protocols {
+			result = append(result, calicoRule{
+				Action:   "Allow",
+				Protocol: protocol,
+				Destination: &calicoEntityRule{
+					Domains: []string{domain},
+					Ports:   ports.ports[protocol],
+				},
+			})
+		}
+	}
+
+	return append(result, r.egressPeerRules("Allow", policy.Egress)...)
+}
+
+func (r *calicoRenderer) egressPeerRules(action string, egressRules []netv1.NetworkPolicyEgressRule) []calicoRule {
+	result := []calicoRule{}
+
+	for _, egress := range egressRules {
+		ports := calicoNetworkPolicyPorts(egress.Ports)
+		for _, entity := range r.entities(egress.To) {
+			for _, protocol := range ports.protocols {
+				destination := entity
+				destination.Ports = ports.ports[protocol]
+
+				result = append(result, calicoRule{
+					Action:      action,
+					Protocol:    protocol,
+					Destination: &destination,
+				})
+			}
+		}
+	}
+
+	return result
+}
+
+func (r *calicoRenderer) ingressRules(ingressRules []netv1.NetworkPolicyIngressRule) []calicoRule {
+	result := []calicoRule{}
+
+	for _, ingress := range ingressRules {
+		ports := calicoNetworkPolicyPorts(ingress.Ports)
+		for _, entity := range r.entities(ingress.From) {
+			for _, protocol := range ports.protocols {
+				source := entity
+				rule := calicoRule{
+					Action:   "Allow",
+					Protocol: protocol,
+					Source:   &source,
+				}
+				if len(ports.ports[protocol]) > 0 {
+					rule.Destination = &calicoEntityRule{
+						Ports: ports.ports[protocol],
+					}
+				}
+
+				result = append(result, rule)
+			}
+		}
+	}
+
+	return result
+}
+
+// entities converts the peers of a rule, plain networks are grouped in a
+// single entity or moved to a GlobalNetworkSet when there are too many.
+func (r *calicoRenderer) entities(peers []netv1.NetworkPolicyPeer) []calicoEntityRule {
+	if len(peers) == 0 {
+		return []calicoEntityRule{{}}
+	}
+
+	result := []calicoEntityRule{}
+	nets := []string{}
+
+	for _, peer := range peers {
+		if peer.IPBlock != nil && len(peer.IPBlock.Except) == 0 {
+			nets = append(nets, peer.IPBlock.CIDR)
+		} else if peer.IPBlock != nil {
+			result = append(result, calicoEntityRule{
+				Nets:    []string{peer.IPBlock.CIDR},
+				NotNets: peer.IPBlock.Except,
+			})
+		} else {
+			entity := calicoEntityRule{}
+			if peer.PodSelector != nil {
+				entity.Selector = calicoSelector(peer.PodSelector)
+			}
+			if peer.NamespaceSelector != nil {
+				entity.NamespaceSelector = calicoSelector(peer.NamespaceSelector)
+			}
+			result = append(result, entity)
+		}
+	}
+
+	if len(nets) >= calicoNetworkSetMinNets {
+		networkSetName := r.addNetworkSet(nets)
+		result = append(result, calicoEntityRule{
+			Selector:          fmt.Sprintf("%s == '%s'", calicoNetworkSetLabel, networkSetName),
+			NamespaceSelector: "global()",
+		})
+	} else if len(nets) > 0 {
+		result = append(result, calicoEntityRule{
+			Nets: nets,
+		})
+	}
+
+	return result
+}
+
+func (r *calicoRenderer) addNetworkSet(nets []string) string {
+	name := calicoNetworkSetName(r.acl, r.policy, len(r.networkSets))
+
+	spec, _ := runtime.DefaultUnstructuredConverter.ToUnstructured(&calicoNetworkSetSpec{Nets: nets})
+
+	networkSet := &unstructured.Unstructured{}
+	networkSet.SetGroupVersionKind(calicoGlobalNetworkSetGVK)
+	networkSet.SetName(name)
+	networkSet.SetLabels(map[string]string{
+		calicoACLNamespaceLabel: r.acl.Namespace,
+		calicoACLNameLabel:      r.acl.Name,
+		calicoNetworkSetLabel:   name,
+		calicoPolicyLabel:       calicoLabelValue(r.policy),
+	})
+	networkSet.Object["spec"] = spec
+
+	r.networkSets = append(r.networkSets, networkSet)
+
+	return name
+}
+
+// calicoNetworkSetName returns the name of the i-th GlobalNetworkSet of the
+// policy object of the ACL. Network sets are cluster scoped, the namespace and
+// name are hashed so ACLs like tsuru-prod/api and tsuru/prod-api never share a
+// name.
+func calicoNetworkSetName(acl *v1alpha1.ACL, policyName string, i int) string {
+	return validResourceName(fmt.Sprintf("acl-%s-%s-%d", sha256String(acl.Namespace + "/" + acl.Name)[:16], policyName, i))
+}
+
+// calicoLabelValue returns the value when it fits a label, otherwise its
+// hash.
+func calicoLabelValue(value string) string {
+	if errs := validation.IsValidLabelValue(value); len(errs) == 0 {
+		return value
+	}
+	return sha256String(value)[:16]
+}
+
+// calicoSelector converts a label selector to the calico selector syntax.
+func calicoSelector(selector *metav1.LabelSelector) string {
+	expressions := []string{}
+
+	keys := make([]string, 0, len(selector.MatchLabels))
+	for key := range selector.MatchLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		expressions = append(expressions, fmt.Sprintf("%s == '%s'", key, selector.MatchLabels[key]))
+	}
+
+	for _, requirement := range selector.MatchExpressions {
+		values := make([]string, 0, len(requirement.Values))
+		for _, value := range requirement.Values {
+			values = append(values, "'"+value+"'")
+		}
+
+		switch requirement.Operator {
+		case metav1.LabelSelectorOpIn:
+			expressions = append(expressions, fmt.Sprintf("%s in {%s}", requirement.Key, strings.Join(values, ", ")))
+		case metav1.LabelSelectorOpNotIn:
+			expressions = append(expressions, fmt.Sprintf("%s not in {%s}", requirement.Key, strings.Join(values, ", ")))
+		case metav1.LabelSelectorOpExists:
+			expressions = append(expressions, fmt.Sprintf("has(%s)", requirement.Key))
+		case metav1.LabelSelectorOpDoesNotExist:
+			expressions = append(expressions, fmt.Sprintf("!has(%s)", requirement.Key))
+		}
+	}
+
+	if len(expressions) == 0 {
+		return "all()"
+	}
+
+	return strings.Join(expressions, " && ")
+}
+
+func (p *calicoPorts) add(protocol string, port *intstr.IntOrString) {
+	if p.ports == nil {
+		p.ports = map[string][]intstr.IntOrString{}
+	}
+
+	if _, found := p.ports[protocol]; !found {
+		p.protocols = append(p.protocols, protocol)
+		p.ports[protocol] = nil
+	}
+
+	if port != nil {
+		p.ports[protocol] = append(p.ports[protocol], *port)
+	}
+}
+
+func calicoNetworkPolicyPorts(ports []netv1.NetworkPolicyPort) *calicoPorts {
+	result := &calicoPorts{}
+
+	if len(ports) == 0 {
+		result.add("", nil)
+		return result
+	}
+
+	for _, port := range ports {
+		protocol := "TCP"
+		if port.Protocol != nil {
+			protocol = string(*port.Protocol)
+		}
+
+		if port.Port == nil {
+			result.add(protocol, nil)
+			continue
+		}
+
+		portValue := *port.Port
+		if port.EndPort != nil {
+			portValue = intstr.FromString(port.Port.String() + ":" + strconv.Itoa(int(*port.EndPort)))
+		}
+		result.add(protocol, &portValue)
+	}
+
+	return result
+}
+
+func calicoProtoPorts(ports v1alpha1.ACLSpecProtoPorts) *calicoPorts {
+	result := &calicoPorts{}
+
+	if len(ports) == 0 {
+		result.add("", nil)
+		return result
+	}
+
+	for _, port := range ports {
+		protocol := "TCP"
+		if port.Protocol != "" {
+			protocol = strings.ToUpper(port.Protocol)
+		}
+
+		portValue := intstr.FromInt(int(port.Number))
+		if port.Name != "" {
+			portValue = intstr.FromString(port.Name)
+		} else if port.EndPort > port.Number {
+			portValue = intstr.FromString(strconv.Itoa(int(port.Number)) + ":" + strconv.Itoa(int(port.EndPort)))
+		}
+		result.add(protocol, &portValue)
+	}
+
+	return result
+}
@@ -0,0 +1,528 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/tsuru/acl-operator/api/scheme"
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func (suite *ControllerSuite) TestACLReconcilerCalicoEnterpriseBackendReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name: "www.example.com",
+						Ports: v1alpha1.ACLSpecProtoPorts{
+							{Protocol: "tcp", Number: 443},
+							{Protocol: "udp", Number: 443},
+						},
+					},
+				},
+				{
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name: ".example.org",
+					},
+				},
+				{
+					TsuruAppPool: "my-pool",
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:        scheme.Scheme,
+		Resolver:      &fakeResolver{},
+		TsuruAPI:      &fakeTsuruAPI{},
+		PolicyBackend: NewCalicoBackend(DefaultCalicoPolicyOrder, true),
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().True(existingACL.Status.Ready)
+
+	dnsEntries := &v1alpha1.ACLDNSEntryList{}
+	err = reconciler.Client.List(ctx, dnsEntries)
+	suite.Require().NoError(err)
+	suite.Assert().Len(dnsEntries.Items, 0)
+
+	calicoPolicy := CalicoBackend.NewObject().(*unstructured.Unstructured)
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: existingACL.Namespace,
+		Name:      existingACL.Status.NetworkPolicy,
+	}, calicoPolicy)
+	suite.Require().NoError(err)
+	suite.Require().Len(calicoPolicy.GetOwnerReferences(), 1)
+
+	suite.Assert().Equal(map[string]interface{}{
+		"order":    int64(DefaultCalicoPolicyOrder),
+		"selector": "tsuru.io/app-name == 'myapp'",
+		"types":    []interface{}{"Egress"},
+		"egress": []interface{}{
+			map[string]interface{}{
+				"action":   "Allow",
+				"protocol": "TCP",
+				"destination": map[string]interface{}{
+					"domains": []interface{}{"www.example.com"},
+					"ports":   []interface{}{int64(443)},
+				},
+			},
+			map[string]interface{}{
+				"action":   "Allow",
+				"protocol": "UDP",
+				"destination": map[string]interface{}{
+					"domains": []interface{}{"www.example.com"},
+					"ports":   []interface{}{int64(443)},
+				},
+			},
+			map[string]interface{}{
+				"action": "Allow",
+				"destination": map[string]interface{}{
+					"domains": []interface{}{"*.example.org"},
+				},
+			},
+			map[string]interface{}{
+				"action": "Allow",
+				"destination": map[string]interface{}{
+					"selector": "tsuru.io/app-pool == 'my-pool'",
+				},
+			},
+			map[string]interface{}{
+				"action": "Allow",
+				"destination": map[string]interface{}{
+					"selector":          "tsuru.io/app-pool == 'my-pool'",
+					"namespaceSelector": "name == 'tsuru-my-pool'",
+				},
+			},
+		},
+	}, calicoPolicy.Object["spec"])
+}
+
+func (suite *ControllerSuite) TestACLReconcilerCalicoBackendExternalDNSReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name: "www.example.com",
+					},
+				},
+				{
+					RuleID: "wildcard",
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name: ".example.org",
+					},
+				},
+			},
+		},
+	}
+
+	dnsEntry := &v1alpha1.ACLDNSEntry{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "www.example.com",
+		},
+		Spec: v1alpha1.ACLDNSEntrySpec{
+			Host: "www.example.com",
+		},
+		Status: v1alpha1.ACLDNSEntryStatus{
+			Ready: true,
+			IPs: []v1alpha1.ACLDNSEntryStatusIP{
+				{
+					Address:    "1.1.1.1",
+					ValidUntil: time.Now().Format(time.RFC3339),
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl, dnsEntry).Build(),
+		Scheme:        scheme.Scheme,
+		Resolver:      &fakeResolver{},
+		TsuruAPI:      &fakeTsuruAPI{},
+		PolicyBackend: CalicoBackend,
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	// calico OSS has no domains, wildcards can't be resolved to addresses
+	suite.Assert().Equal([]v1alpha1.ACLStatusRuleError{
+		{
+			RuleID: "wildcard",
+			Error:  `wildcard DNS ".example.org" is only supported by the calico policy backend on Calico Enterprise`,
+		},
+	}, existingACL.Status.RuleErrors)
+
+	calicoPolicy := CalicoBackend.NewObject().(*unstructured.Unstructured)
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "acl-myapp",
+	}, calicoPolicy)
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal([]interface{}{
+		map[string]interface{}{
+			"action": "Allow",
+			"destination": map[string]interface{}{
+				"nets": []interface{}{"1.1.1.1/32"},
+			},
+		},
+	}, calicoPolicy.Object["spec"].(map[string]interface{})["egress"])
+}
+
+func (suite *ControllerSuite) TestACLReconcilerCalicoBackendDenyReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.0.0.0/8",
+					},
+				},
+				{
+					Action: v1alpha1.ACLActionDeny,
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.100.0.0/16",
+						Ports: v1alpha1.ACLSpecProtoPorts{
+							{Protocol: "tcp", Number: 22},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:        scheme.Scheme,
+		Resolver:      &fakeResolver{},
+		TsuruAPI:      &fakeTsuruAPI{},
+		PolicyBackend: NewCalicoBackend(50, false),
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	calicoPolicy := CalicoBackend.NewObject().(*unstructured.Unstructured)
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "acl-myapp",
+	}, calicoPolicy)
+	suite.Require().NoError(err)
+
+	// evaluated before the Kubernetes NetworkPolicies, which get the order 1000
+	suite.Assert().Equal(int64(50), calicoPolicy.Object["spec"].(map[string]interface{})["order"])
+
+	suite.Assert().Equal([]interface{}{
+		map[string]interface{}{
+			"action":   "Deny",
+			"protocol": "TCP",
+			"destination": map[string]interface{}{
+				"nets":  []interface{}{"10.100.0.0/16"},
+				"ports": []interface{}{int64(22)},
+			},
+		},
+		map[string]interface{}{
+			"action": "Allow",
+			"destination": map[string]interface{}{
+				"nets": []interface{}{"10.0.0.0/8"},
+			},
+		},
+	}, calicoPolicy.Object["spec"].(map[string]interface{})["egress"])
+}
+
+func (suite *ControllerSuite) TestCalicoBackendGlobalNetworkSets() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	}
+
+	to := []netv1.NetworkPolicyPeer{}
+	nets := []interface{}{}
+	for i := 0; i < calicoNetworkSetMinNets; i++ {
+		cidr := fmt.Sprintf("10.0.%d.0/24", i)
+		to = append(to, netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{CIDR: cidr}})
+		nets = append(nets, cidr)
+	}
+	tcp := corev1.ProtocolTCP
+	port := intstr.FromInt(443)
+
+	policy := &ACLPolicy{
+		Name:        "acl-myapp",
+		PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tsuru.io/app-name": "myapp"}},
+		PolicyTypes: []netv1.PolicyType{netv1.PolicyTypeEgress},
+		Egress: []netv1.NetworkPolicyEgressRule{
+			{
+				To:    to,
+				Ports: []netv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port}},
+			},
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build()
+	result, err := CalicoBackend.Ensure(ctx, c, acl, policy)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(controllerutil.OperationResultCreated, result)
+
+	networkSets, err := calicoNetworkSets(ctx, c)
+	suite.Require().NoError(err)
+	suite.Require().Len(networkSets, 1)
+	networkSetName := calicoNetworkSetName(acl, "acl-myapp", 0)
+	suite.Assert().Equal(networkSetName, networkSets[0].GetName())
+	suite.Assert().Equal(map[string]string{
+		"extensions.tsuru.io/acl-namespace": "default",
+		"extensions.tsuru.io/acl-name":      "myapp",
+		"extensions.tsuru.io/network-set":   networkSetName,
+		"extensions.tsuru.io/acl-policy":    "acl-myapp",
+	}, networkSets[0].GetLabels())
+	suite.Assert().Equal(map[string]interface{}{"nets": nets}, networkSets[0].Object["spec"])
+
+	calicoPolicy := CalicoBackend.NewObject().(*unstructured.Unstructured)
+	err = c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "acl-myapp"}, calicoPolicy)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]interface{}{
+		map[string]interface{}{
+			"action":   "Allow",
+			"protocol": "TCP",
+			"destination": map[string]interface{}{
+				"selector":          "extensions.tsuru.io/network-set == '" + networkSetName + "'",
+				"namespaceSelector": "global()",
+				"ports":             []interface{}{int64(443)},
+			},
+		},
+	}, calicoPolicy.Object["spec"].(map[string]interface{})["egress"])
+
+	result, err = CalicoBackend.Ensure(ctx, c, acl, policy)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(controllerutil.OperationResultNone, result)
+
+	policy.Egress[0].To = to[:2]
+	result, err = CalicoBackend.Ensure(ctx, c, acl, policy)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(controllerutil.OperationResultUpdated, result)
+
+	networkSets, err = calicoNetworkSets(ctx, c)
+	suite.Require().NoError(err)
+	suite.Assert().Len(networkSets, 0)
+}
+
+func (suite *ControllerSuite) TestCalicoBackendNetworkSetsOfCollidingACLs() {
+	ctx := context.Background()
+	acls := []*v1alpha1.ACL{
+		{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "tsuru-prod"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "prod-api", Namespace: "tsuru"}},
+	}
+
+	policyForNets := func(firstOctet int) *ACLPolicy {
+		to := []netv1.NetworkPolicyPeer{}
+		for i := 0; i < calicoNetworkSetMinNets; i++ {
+			to = append(to, netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{CIDR: fmt.Sprintf("%d.0.%d.0/24", firstOctet, i)}})
+		}
+		return &ACLPolicy{
+			Name:        "acl-api",
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tsuru.io/app-name": "api"}},
+			PolicyTypes: []netv1.PolicyType{netv1.PolicyTypeEgress},
+			Egress:      []netv1.NetworkPolicyEgressRule{{To: to}},
+		}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acls[0], acls[1]).Build()
+	_, err := CalicoBackend.Ensure(ctx, c, acls[0], policyForNets(10))
+	suite.Require().NoError(err)
+	_, err = CalicoBackend.Ensure(ctx, c, acls[1], policyForNets(172))
+	suite.Require().NoError(err)
+
+	// a reconcile of the first ACL keeps the network set of the second one
+	_, err = CalicoBackend.Ensure(ctx, c, acls[0], policyForNets(10))
+	suite.Require().NoError(err)
+
+	networkSets, err := calicoNetworkSets(ctx, c)
+	suite.Require().NoError(err)
+	suite.Require().Len(networkSets, 2)
+	suite.Assert().NotEqual(calicoNetworkSetName(acls[0], "acl-api", 0), calicoNetworkSetName(acls[1], "acl-api", 0))
+
+	for i, acl := range acls {
+		networkSet := &unstructured.Unstructured{}
+		networkSet.SetGroupVersionKind(calicoGlobalNetworkSetGVK)
+		err = c.Get(ctx, client.ObjectKey{Name: calicoNetworkSetName(acl, "acl-api", 0)}, networkSet)
+		suite.Require().NoError(err)
+		suite.Assert().Equal(acl.Namespace, networkSet.GetLabels()[calicoACLNamespaceLabel])
+		suite.Assert().Equal(acl.Name, networkSet.GetLabels()[calicoACLNameLabel])
+
+		nets, _, _ := unstructured.NestedStringSlice(networkSet.Object, "spec", "nets")
+		suite.Require().NotEmpty(nets)
+		suite.Assert().Equal(fmt.Sprintf("%d.0.0.0/24", []int{10, 172}[i]), nets[0])
+	}
+}
+
+func (suite *ControllerSuite) TestCalicoBackendShardedNetworkSets() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	}
+
+	egress := []netv1.NetworkPolicyEgressRule{}
+	for i := 0; i < 2; i++ {
+		to := []netv1.NetworkPolicyPeer{}
+		for j := 0; j < calicoNetworkSetMinNets; j++ {
+			to = append(to, netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{CIDR: fmt.Sprintf("10.%d.%d.0/24", i, j)}})
+		}
+		egress = append(egress, netv1.NetworkPolicyEgressRule{To: to})
+	}
+	policy := &ACLPolicy{
+		Name:        "acl-myapp",
+		PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tsuru.io/app-name": "myapp"}},
+		PolicyTypes: []netv1.PolicyType{netv1.PolicyTypeEgress},
+		Egress:      egress,
+	}
+	shards := shardPolicy(policy, calicoNetworkSetMinNets)
+	suite.Require().Len(shards, 2)
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build()
+	for _, shard := range shards {
+		_, err := CalicoBackend.Ensure(ctx, c, acl, shard)
+		suite.Require().NoError(err)
+	}
+
+	// a reconcile of the first shard keeps the network set of the second one
+	_, err := CalicoBackend.Ensure(ctx, c, acl, shards[0])
+	suite.Require().NoError(err)
+
+	networkSets, err := calicoNetworkSets(ctx, c)
+	suite.Require().NoError(err)
+	suite.Require().Len(networkSets, 2)
+
+	for i, shard := range shards {
+		networkSetName := calicoNetworkSetName(acl, shard.Name, 0)
+
+		networkSet := &unstructured.Unstructured{}
+		networkSet.SetGroupVersionKind(calicoGlobalNetworkSetGVK)
+		err = c.Get(ctx, client.ObjectKey{Name: networkSetName}, networkSet)
+		suite.Require().NoError(err)
+		suite.Assert().Equal(shard.Name, networkSet.GetLabels()[calicoPolicyLabel])
+
+		nets, _, _ := unstructured.NestedStringSlice(networkSet.Object, "spec", "nets")
+		suite.Require().Len(nets, calicoNetworkSetMinNets)
+		suite.Assert().Equal(fmt.Sprintf("10.%d.0.0/24", i), nets[0])
+
+		calicoPolicy := CalicoBackend.NewObject().(*unstructured.Unstructured)
+		err = c.Get(ctx, client.ObjectKey{Namespace: "default", Name: shard.Name}, calicoPolicy)
+		suite.Require().NoError(err)
+		selector, _, _ := unstructured.NestedString(calicoPolicy.Object["spec"].(map[string]interface{})["egress"].([]interface{})[0].(map[string]interface{}), "destination", "selector")
+		suite.Assert().Equal("extensions.tsuru.io/network-set == '"+networkSetName+"'", selector)
+	}
+
+	// the network sets of a removed shard go away with its policy
+	removed, err := removeStalePolicies(ctx, c, CalicoBackend, acl, []string{shards[0].Name, shards[1].Name}, []string{shards[0].Name})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{shards[1].Name}, removed)
+
+	networkSets, err = calicoNetworkSets(ctx, c)
+	suite.Require().NoError(err)
+	suite.Require().Len(networkSets, 1)
+	suite.Assert().Equal(calicoNetworkSetName(acl, shards[0].Name, 0), networkSets[0].GetName())
+}
+
+func (suite *ControllerSuite) TestACLGarbageCollectorCalicoOrphanNetworkSets() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	}
+
+	networkSets := []client.Object{}
+	for _, aclName := range []string{"myapp", "removed-app"} {
+		networkSet := &unstructured.Unstructured{}
+		networkSet.SetGroupVersionKind(calicoGlobalNetworkSetGVK)
+		networkSet.SetName("acl-default-" + aclName + "-0")
+		networkSet.SetLabels(map[string]string{
+			calicoACLNamespaceLabel: "default",
+			calicoACLNameLabel:      aclName,
+		})
+		networkSets = append(networkSets, networkSet)
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).WithObjects(networkSets...).Build()
+	gc := &ACLGarbageCollector{
+		Client:        c,
+		Logger:        logr.Discard(),
+		DryRunOutput:  &bytes.Buffer{},
+		PolicyBackend: CalicoBackend,
+	}
+	err := gc.Loop(ctx)
+	suite.Require().NoError(err)
+
+	remaining, err := calicoNetworkSets(ctx, c)
+	suite.Require().NoError(err)
+	suite.Require().Len(remaining, 1)
+	suite.Assert().Equal("acl-default-myapp-0", remaining[0].GetName())
+}
@@ -0,0 +1,443 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+var ciliumNetworkPolicyGVK = schema.GroupVersionKind{
+	Group:   "cilium.io",
+	Version: "v2",
+	Kind:    "CiliumNetworkPolicy",
+}
+
+const (
+	ciliumNamespaceLabel       = "k8s:io.kubernetes.pod.namespace"
+	ciliumNamespaceLabelPrefix = "k8s:io.cilium.k8s.namespace.labels."
+)
+
+// CiliumBackend enforces ACLs using cilium.io/v2 CiliumNetworkPolicy,
+// ExternalDNS destinations are rendered as toFQDNs and resolved by the cilium
+// DNS proxy, so no ACLDNSEntry is needed.
+var CiliumBackend PolicyBackend = &ciliumBackend{}
+
+// ciliumRule mirrors the subset of the cilium api.Rule used by the operator,
+// the cilium module is not imported to avoid its huge dependency tree.
+type ciliumRule struct {
+	EndpointSelector metav1.LabelSelector `json:"endpointSelector"`
+	Egress           []ciliumEgressRule   `json:"egress,omitempty"`
+	EgressDeny       []ciliumEgressRule   `json:"egressDeny,omitempty"`
+	Ingress          []ciliumIngressRule  `json:"ingress,omitempty"`
+}
+
+type ciliumEgressRule struct {
+	ToEndpoints []metav1.LabelSelector `json:"toEndpoints,omitempty"`
+	ToCIDRSet   []ciliumCIDRRule       `json:"toCIDRSet,omitempty"`
+	ToEntities  []string               `json:"toEntities,omitempty"`
+	ToServices  []ciliumService        `json:"toServices,omitempty"`
+	ToFQDNs     []ciliumFQDNSelector   `json:"toFQDNs,omitempty"`
+	ToPorts     []ciliumPortRule       `json:"toPorts,omitempty"`
+}
+
+type ciliumIngressRule struct {
+	FromEndpoints []metav1.LabelSelector `json:"fromEndpoints,omitempty"`
+	FromCIDRSet   []ciliumCIDRRule       `json:"fromCIDRSet,omitempty"`
+	FromEntities  []string               `json:"fromEntities,omitempty"`
+	ToPorts       []ciliumPortRule       `json:"toPorts,omitempty"`
+}
+
+type ciliumCIDRRule struct {
+	CIDR   string   `json:"cidr"`
+	Except []string `json:"except,omitempty"`
+}
+
+type ciliumService struct {
+	K8sService *ciliumK8sServiceNamespace `json:"k8sService,omitempty"`
+}
+
+type ciliumK8sServiceNamespace struct {
+	ServiceName string `json:"serviceName"`
+	Namespace   string `json:"namespace"`
+}
+
+type ciliumFQDNSelector struct {
+	MatchName    string `json:"matchName,omitempty"`
+	MatchPattern string `json:"matchPattern,omitempty"`
+}
+
+type ciliumPortRule struct {
+	Ports []ciliumPortProtocol `json:"ports,omitempty"`
+	Rules *ciliumL7Rules       `json:"rules,omitempty"`
+}
+
+type ciliumPortProtocol struct {
+	Port     string `json:"port"`
+	EndPort  int32  `json:"endPort,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+type ciliumL7Rules struct {
+	DNS []ciliumFQDNSelector `json:"dns,omitempty"`
+}
+
+type ciliumBackend struct{}
+
+func (b *ciliumBackend) Name() string {
+	return "cilium"
+}
+
+func (b *ciliumBackend) ValidateDestination(destination v1alpha1.ACLSpecDestination) error {
+	if destination.Action == v1alpha1.ACLActionDeny && destination.ExternalDNS != nil {
+		return fmt.Errorf("deny rules for externalDNS are not supported by the %s policy backend", b.Name())
+	}
+
+	return nil
+}
+
+func (b *ciliumBackend) IsNativeDestination(destination v1alpha1.ACLSpecDestination) bool {
+	return destination.ExternalDNS != nil || destination.KubernetesService != nil
+}
+
+func (b *ciliumBackend) NewObject() client.Object {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(ciliumNetworkPolicyGVK)
+	return obj
+}
+
+func (b *ciliumBackend) Render(acl *v1alpha1.ACL, policy *ACLPolicy) (client.Object, error) {
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(ciliumRuleForPolicy(policy))
+	if err != nil {
+		return nil, err
+	}
+
+	ciliumPolicy := b.NewObject().(*unstructured.Unstructured)
+	ciliumPolicy.SetNamespace(acl.Namespace)
+	ciliumPolicy.SetName(policy.Name)
+	ciliumPolicy.SetOwnerReferences([]metav1.OwnerReference{
+		*metav1.NewControllerRef(acl, acl.GroupVersionKind()),
+	})
+	ciliumPolicy.Object["spec"] = spec
+
+	return ciliumPolicy, nil
+}
+
+func (b *ciliumBackend) Ensure(ctx context.Context, c client.Client, acl *v1alpha1.ACL, policy *ACLPolicy) (controllerutil.OperationResult, error) {
+	ciliumPolicy, err := b.Render(acl, policy)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	return ensureUnstructured(ctx, c, ciliumPolicy.(*unstructured.Unstructured))
+}
+
+func ciliumRuleForPolicy(policy *ACLPolicy) *ciliumRule {
+	rule := &ciliumRule{
+		EndpointSelector: policy.PodSelector,
+	}
+
+	for _, policyType := range policy.PolicyTypes {
+		if policyType == netv1.PolicyTypeEgress {
+			rule.Egress = ciliumEgressRules(policy)
+			rule.EgressDeny = ciliumEgressDenyRules(policy)
+		} else if policyType == netv1.PolicyTypeIngress {
+			rule.Ingress = ciliumIngressRules(policy.Ingress)
+		}
+	}
+
+	return rule
+}
+
+func ciliumEgressRules(policy *ACLPolicy) []ciliumEgressRule {
+	result := []ciliumEgressRule{}
+	hasFQDNs := false
+
+	for _, destination := range policy.NativeDestinations {
+		if destination.Action == v1alpha1.ACLActionDeny {
+			continue
+		}
+
+		if destination.ExternalDNS != nil {
+			hasFQDNs = true
+			result = append(result, ciliumEgressRule{
+				ToFQDNs: []ciliumFQDNSelector{ciliumFQDNSelectorForName(destination.ExternalDNS.Name)},
+				ToPorts: ciliumProtoPorts(destination.ExternalDNS.Ports),
+			})
+		} else if rule, ok := ciliumNativeEgressRule(policy, destination); ok {
+			result = append(result, rule)
+		}
+	}
+
+	if hasFQDNs {
+		// toFQDNs only works when the DNS requests are seen by the cilium DNS
+		// proxy
+		result = append(result, ciliumEgressRule{
+			ToEndpoints: []metav1.LabelSelector{
+				{
+					MatchLabels: map[string]string{
+						ciliumNamespaceLabel: "kube-system",
+						"k8s:k8s-app":        "kube-dns",
+					},
+				},
+			},
+			ToPorts: []ciliumPortRule{
+				{
+					Ports: []ciliumPortProtocol{
+						{Port: "53", Protocol: "ANY"},
+					},
+					Rules: &ciliumL7Rules{
+						DNS: []ciliumFQDNSelector{{MatchPattern: "*"}},
+					},
+				},
+			},
+		})
+	}
+
+	return append(result, ciliumEgressPeerRules(policy.Egress)...)
+}
+
+// ciliumEgressDenyRules renders the destinations with the Deny action, toFQDNs
+// is not supported by cilium deny rules.
+func ciliumEgressDenyRules(policy *ACLPolicy) []ciliumEgressRule {
+	result := []ciliumEgressRule{}
+
+	for _, destination := range policy.NativeDestinations {
+		if destination.Action != v1alpha1.ACLActionDeny {
+			continue
+		}
+
+		if rule, ok := ciliumNativeEgressRule(policy, destination); ok {
+			result = append(result, rule)
+		}
+	}
+
+	return append(result, ciliumEgressPeerRules(policy.EgressDeny)...)
+}
+
+func ciliumNativeEgressRule(policy *ACLPolicy, destination v1alpha1.ACLSpecDestination) (ciliumEgressRule, bool) {
+	if destination.KubernetesService != nil {
+		return ciliumEgressRule{
+			ToServices: []ciliumService{
+				{
+					K8sService: &ciliumK8sServiceNamespace{
+						ServiceName: destination.KubernetesService.Name,
+						Namespace:   destination.KubernetesService.Namespace,
+					},
+				},
+			},
+			ToPorts: ciliumPorts(policy.NativeDestinationPorts[ruleIDForDestination(destination)]),
+		}, true
+	}
+
+	return ciliumEgressRule{}, false
+}
+
+func ciliumEgressPeerRules(egressRules []netv1.NetworkPolicyEgressRule) []ciliumEgressRule {
+	result := []ciliumEgressRule{}
+
+	for _, egress := range egressRules {
+		endpoints, cidrs := ciliumPeers(egress.To)
+		ports := ciliumPorts(egress.Ports)
+
+		if len(egress.To) == 0 {
+			result = append(result, ciliumEgressRule{ToEntities: []string{"all"}, ToPorts: ports})
+		}
+		cidrs, world := ciliumWorldCIDRs(cidrs)
+		if world {
+			result = append(result, ciliumEgressRule{ToEntities: []string{"world"}, ToPorts: ports})
+		}
+		// cilium does not support different kinds of peers on the same rule
+		if len(endpoints) > 0 {
+			result = append(result, ciliumEgressRule{ToEndpoints: endpoints, ToPorts: ports})
+		}
+		if len(cidrs) > 0 {
+			result = append(result, ciliumEgressRule{ToCIDRSet: cidrs, ToPorts: ports})
+		}
+	}
+
+	return result
+}
+
+func ciliumIngressRules(ingressRules []netv1.NetworkPolicyIngressRule) []ciliumIngressRule {
+	result := []ciliumIngressRule{}
+
+	for _, ingress := range ingressRules {
+		endpoints, cidrs := ciliumPeers(ingress.From)
+		ports := ciliumPorts(ingress.Ports)
+
+		if len(ingress.From) == 0 {
+			result = append(result, ciliumIngressRule{FromEntities: []string{"all"}, ToPorts: ports})
+		}
+		if len(endpoints) > 0 {
+			result = append(result, ciliumIngressRule{FromEndpoints: endpoints, ToPorts: ports})
+		}
+		if len(cidrs) > 0 {
+			result = append(result, ciliumIngressRule{FromCIDRSet: cidrs, ToPorts: ports})
+		}
+	}
+
+	return result
+}
+
+func ciliumPeers(peers []netv1.NetworkPolicyPeer) ([]metav1.LabelSelector, []ciliumCIDRRule) {
+	endpoints := []metav1.LabelSelector{}
+	cidrs := []ciliumCIDRRule{}
+
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			cidrs = append(cidrs, ciliumCIDRRule{
+				CIDR:   peer.IPBlock.CIDR,
+				Except: peer.IPBlock.Except,
+			})
+			continue
+		}
+
+		endpoints = append(endpoints, ciliumEndpointSelector(peer))
+	}
+
+	return endpoints, cidrs
+}
+
+// ciliumEndpointSelector merges the pod and namespace selectors of the peer,
+// cilium exposes the namespace labels as labels of the endpoints.
+func ciliumEndpointSelector(peer netv1.NetworkPolicyPeer) metav1.LabelSelector {
+	selector := metav1.LabelSelector{}
+
+	if peer.PodSelector != nil {
+		for key, value := range peer.PodSelector.MatchLabels {
+			if selector.MatchLabels == nil {
+				selector.MatchLabels = map[string]string{}
+			}
+			selector.MatchLabels[key] = value
+		}
+		selector.MatchExpressions = append(selector.MatchExpressions, peer.PodSelector.MatchExpressions...)
+	}
+
+	if peer.NamespaceSelector == nil {
+		return selector
+	}
+
+	if len(peer.NamespaceSelector.MatchLabels) == 0 && len(peer.NamespaceSelector.MatchExpressions) == 0 {
+		// an empty namespaceSelector selects all namespaces
+		selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      ciliumNamespaceLabel,
+			Operator: metav1.LabelSelectorOpExists,
+		})
+		return selector
+	}
+
+	for key, value := range peer.NamespaceSelector.MatchLabels {
+		if selector.MatchLabels == nil {
+			selector.MatchLabels = map[string]string{}
+		}
+		selector.MatchLabels[ciliumNamespaceLabelPrefix+key] = value
+	}
+	for _, expression := range peer.NamespaceSelector.MatchExpressions {
+		expression.Key = ciliumNamespaceLabelPrefix + expression.Key
+		selector.MatchExpressions = append(selector.MatchExpressions, expression)
+	}
+
+	return selector
+}
+
+func ciliumFQDNSelectorForName(name string) ciliumFQDNSelector {
+	if isWildCard(name) {
+		return ciliumFQDNSelector{MatchPattern: "*" + name}
+	}
+
+	return ciliumFQDNSelector{MatchName: name}
+}
+
+func ciliumPorts(ports []netv1.NetworkPolicyPort) []ciliumPortRule {
+	if len(ports) == 0 {
+		return nil
+	}
+
+	portProtocols := []ciliumPortProtocol{}
+	for _, port := range ports {
+		portProtocol := ciliumPortProtocol{
+			Port:     "0",
+			Protocol: "ANY",
+		}
+		if port.Port != nil {
+			portProtocol.Port = port.Port.String()
+		}
+		if port.EndPort != nil {
+			portProtocol.EndPort = *port.EndPort
+		}
+		if port.Protocol != nil {
+			portProtocol.Protocol = strings.ToUpper(string(*port.Protocol))
+		}
+		portProtocols = append(portProtocols, portProtocol)
+	}
+
+	return []ciliumPortRule{{Ports: portProtocols}}
+}
+
+func ciliumProtoPorts(ports v1alpha1.ACLSpecProtoPorts) []ciliumPortRule {
+	if len(ports) == 0 {
+		return nil
+	}
+
+	portProtocols := []ciliumPortProtocol{}
+	for _, port := range ports {
+		protocol := "ANY"
+		if port.Protocol != "" {
+			protocol = strings.ToUpper(port.Protocol)
+		}
+		portProtocol := ciliumPortProtocol{
+			Port:     strconv.Itoa(int(port.Number)),
+			Protocol: protocol,
+		}
+		if port.Name != "" {
+			portProtocol.Port = port.Name
+		} else if port.EndPort > port.Number {
+			portProtocol.EndPort = int32(port.EndPort)
+		}
+		portProtocols = append(portProtocols, portProtocol)
+	}
+
+	return []ciliumPortRule{{Ports: portProtocols}}
+}
+
+// ciliumWorldCIDRs removes 0.0.0.0/0 and ::/0 from the cidrs when both are
+// present, they are the same as the world entity. A single one of them is
+// kept as a CIDR, as the world entity would allow the other IP family too.
+func ciliumWorldCIDRs(cidrs []ciliumCIDRRule) ([]ciliumCIDRRule, bool) {
+	var ipv4, ipv6 bool
+	for _, cidr := range cidrs {
+		if len(cidr.Except) > 0 {
+			continue
+		}
+		switch cidr.CIDR {
+		case "0.0.0.0/0":
+			ipv4 = true
+		case "::/0":
+			ipv6 = true
+		}
+	}
+
+	if !ipv4 || !ipv6 {
+		return cidrs, false
+	}
+
+	result := []ciliumCIDRRule{}
+	for _, cidr := range cidrs {
+		if len(cidr.Except) == 0 && (cidr.CIDR == "0.0.0.0/0" || cidr.CIDR == "::/0") {
+			continue
+		}
+		result = append(result, cidr)
+	}
+
+	return result, true
+}
@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/acl-operator/api/scheme"
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func (suite *ControllerSuite) TestACLReconcilerCiliumBackendDenyReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "0.0.0.0/0",
+					},
+				},
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "::/0",
+					},
+				},
+				{
+					RuleID: "metadata",
+					Action: v1alpha1.ACLActionDeny,
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "169.254.169.254",
+					},
+				},
+				{
+					RuleID: "mining-pool",
+					Action: v1alpha1.ACLActionDeny,
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name: "pool.mining.example",
+					},
+				},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl).Build(),
+		Scheme:        scheme.Scheme,
+		Resolver:      &fakeResolver{},
+		TsuruAPI:      &fakeTsuruAPI{},
+		PolicyBackend: CiliumBackend,
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]v1alpha1.ACLStatusRuleError{
+		{
+			RuleID: "mining-pool",
+			Error:  "deny rules for externalDNS are not supported by the cilium policy backend",
+		},
+	}, existingACL.Status.RuleErrors)
+
+	ciliumPolicy := CiliumBackend.NewObject().(*unstructured.Unstructured)
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: "default",
+		Name:      "acl-myapp",
+	}, ciliumPolicy)
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal([]interface{}{
+		map[string]interface{}{
+			"toEntities": []interface{}{"world"},
+		},
+	}, ciliumPolicy.Object["spec"].(map[string]interface{})["egress"])
+	suite.Assert().Equal([]interface{}{
+		map[string]interface{}{
+			"toCIDRSet": []interface{}{
+				map[string]interface{}{
+					"cidr": "169.254.169.254/32",
+				},
+			},
+		},
+	}, ciliumPolicy.Object["spec"].(map[string]interface{})["egressDeny"])
+}
+
+func (suite *ControllerSuite) TestACLReconcilerCiliumBackendReconcile() {
+	ctx := context.Background()
+	acl := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp: "myapp",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name: "www.example.com",
+						Ports: v1alpha1.ACLSpecProtoPorts{
+							{Protocol: "tcp", Number: 443},
+						},
+					},
+				},
+				{
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name: ".example.org",
+					},
+				},
+				{
+					KubernetesService: &v1alpha1.ACLSpecKubernetesService{
+						Namespace: "kube-system",
+						Name:      "metrics",
+					},
+				},
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.1.1.1/32",
+					},
+				},
+				{
+					TsuruAppPool: "my-pool",
+				},
+			},
+		},
+	}
+
+	metricsService := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "metrics",
+			Namespace: "kube-system",
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"k8s-app": "metrics"},
+			Ports: []corev1.ServicePort{
+				{Protocol: corev1.ProtocolTCP, Port: 443, TargetPort: intstr.FromInt(8443)},
+				{Protocol: corev1.ProtocolUDP, Port: 9090, TargetPort: intstr.FromString("telemetry")},
+			},
+		},
+	}
+
+	reconciler := &ACLReconciler{
+		Client:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(acl, metricsService).Build(),
+		Scheme:        scheme.Scheme,
+		Resolver:      &fakeResolver{},
+		TsuruAPI:      &fakeTsuruAPI{},
+		PolicyBackend: CiliumBackend,
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "myapp",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Client.Get(ctx, client.ObjectKeyFromObject(acl), existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().True(existingACL.Status.Ready)
+	suite.Assert().Len(existingACL.Status.RuleErrors, 0)
+	suite.Assert().Equal("acl-myapp", existingACL.Status.NetworkPolicy)
+
+	dnsEntries := &v1alpha1.ACLDNSEntryList{}
+	err = reconciler.Client.List(ctx, dnsEntries)
+	suite.Require().NoError(err)
+	suite.Assert().Len(dnsEntries.Items, 0)
+
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: existingACL.Namespace,
+		Name:      existingACL.Status.NetworkPolicy,
+	}, &netv1.NetworkPolicy{})
+	suite.Require().True(k8sErrors.IsNotFound(err))
+
+	ciliumPolicy := CiliumBackend.NewObject().(*unstructured.Unstructured)
+	err = reconciler.Client.Get(ctx, client.ObjectKey{
+		Namespace: existingACL.Namespace,
+		Name:      existingACL.Status.NetworkPolicy,
+	}, ciliumPolicy)
+	suite.Require().NoError(err)
+	suite.Require().Len(ciliumPolicy.GetOwnerReferences(), 1)
+	suite.Assert().Equal("myapp", ciliumPolicy.GetOwnerReferences()[0].Name)
+
+	suite.Assert().Equal(map[string]interface{}{
+		"endpointSelector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{
+				"tsuru.io/app-name": "myapp",
+			},
+		},
+		"egress": []interface{}{
+			map[string]interface{}{
+				"toFQDNs": []interface{}{
+					map[string]interface{}{"matchName": "www.example.com"},
+				},
+				"toPorts": []interface{}{
+					map[string]interface{}{
+						"ports": []interface{}{
+							map[string]interface{}{"port": "443", "protocol": "TCP"},
+						},
+					},
+				},
+			},
+			map[string]interface{}{
+				"toFQDNs": []interface{}{
+					map[string]interface{}{"matchPattern": "*.example.org"},
+				},
+			},
+			map[string]interface{}{
+				"toServices": []interface{}{
+					map[string]interface{}{
+						"k8sService": map[string]interface{}{
+							"serviceName": "metrics",
+							"namespace":   "kube-system",
+						},
+					},
+				},
+				"toPorts": []interface{}{
+					map[string]interface{}{
+						"ports": []interface{}{
+							map[string]interface{}{"port": "8443", "protocol": "TCP"},
+							map[string]interface{}{"port": "telemetry", "protocol": "UDP"},
+						},
+					},
+				},
+			},
+			map[string]interface{}{
+				"toEndpoints": []interface{}{
+					map[string]interface{}{
+						"matchLabels": map[string]interface{}{
+							"k8s:io.kubernetes.pod.namespace": "kube-system",
+							"k8s:k8s-app":                     "kube-dns",
+						},
+					},
+				},
+				"toPorts": []interface{}{
+					map[string]interface{}{
+						"ports": []interface{}{
+							map[string]interface{}{"port": "53", "protocol": "ANY"},
+						},
+						"rules": map[string]interface{}{
+							"dns": []interface{}{
+								map[string]interface{}{"matchPattern": "*"},
+							},
+						},
+					},
+				},
+			},
+			map[string]interface{}{
+				"toEndpoints": []interface{}{
+					map[string]interface{}{
+						"matchLabels": map[string]interface{}{
+							"tsuru.io/app-pool": "my-pool",
+						},
+					},
+					map[string]interface{}{
+						"matchLabels": map[string]interface{}{
+							"tsuru.io/app-pool":                       "my-pool",
+							"k8s:io.cilium.k8s.namespace.labels.name": "tsuru-my-pool",
+						},
+					},
+				},
+			},
+			map[string]interface{}{
+				"toCIDRSet": []interface{}{
+					map[string]interface{}{"cidr": "10.1.1.1/32"},
+				},
+			},
+		},
+	}, ciliumPolicy.Object["spec"])
+}
+
+func TestCiliumEgressPeerRulesWorld(t *testing.T) {
+	tcp := corev1.ProtocolTCP
+	ports := []netv1.NetworkPolicyPort{{Protocol: &tcp, Port: &intstr.IntOrString{IntVal: 443}}}
+
+	assert.Equal(t, []ciliumEgressRule{
+		{ToCIDRSet: []ciliumCIDRRule{{CIDR: "0.0.0.0/0"}}, ToPorts: ciliumPorts(ports)},
+	}, ciliumEgressPeerRules([]netv1.NetworkPolicyEgressRule{
+		{Ports: ports, To: []netv1.NetworkPolicyPeer{ipBlockPeer("0.0.0.0/0")}},
+	}))
+
+	assert.Equal(t, []ciliumEgressRule{
+		{ToEntities: []string{"world"}, ToPorts: ciliumPorts(ports)},
+		{ToCIDRSet: []ciliumCIDRRule{{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}}, ToPorts: ciliumPorts(ports)},
+	}, ciliumEgressPeerRules([]netv1.NetworkPolicyEgressRule{
+		{Ports: ports, To: []netv1.NetworkPolicyPeer{
+			ipBlockPeer("0.0.0.0/0"),
+			{IPBlock: &netv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}},
+			ipBlockPeer("::/0"),
+		}},
+	}))
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setCondition adds or updates a condition, the transition time is only
+// changed when the status of the condition changes.
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, status bool, reason, message string) {
+	conditionStatus := metav1.ConditionFalse
+	if status {
+		conditionStatus = metav1.ConditionTrue
+	}
+
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+func setReadyCondition(conditions *[]metav1.Condition, generation int64, ready bool, notReadyReason, message string) {
+	if ready {
+		setCondition(conditions, generation, v1alpha1.ConditionReady, true, "Ready", "")
+		return
+	}
+
+	setCondition(conditions, generation, v1alpha1.ConditionReady, false, notReadyReason, message)
+}
+
+// setACLConditions derives the conditions of an ACL from its status, the
+// PolicyApplied condition is set by the reconciler.
+func setACLConditions(acl *v1alpha1.ACL) {
+	generation := acl.Generation
+	acl.Status.ObservedGeneration = generation
+
+	conditions := &acl.Status.Conditions
+	if acl.Status.Reason != "" {
+		setReadyCondition(conditions, generation, acl.Status.Ready, "ReconcileFailed", acl.Status.Reason)
+	} else {
+		setReadyCondition(conditions, generation, acl.Status.Ready, "RuleErrors", ruleErrorsMessage(acl.Status.RuleErrors))
+	}
+
+	setCondition(conditions, generation, v1alpha1.ConditionDegraded, len(acl.Status.RuleErrors) > 0, degradedReason(acl.Status.RuleErrors), ruleErrorsMessage(acl.Status.RuleErrors))
+
+	staleRuleIDs := map[string]bool{}
+	for _, stale := range acl.Status.Stale {
+		staleRuleIDs[stale.RuleID] = len(stale.Rules) > 0
+	}
+	for _, stale := range acl.Status.IngressStale {
+		staleRuleIDs[stale.RuleID] = len(stale.Rules) > 0
+	}
+
+	staleRules := []string{}
+	for _, ruleError := range acl.Status.RuleErrors {
+		if staleRuleIDs[ruleError.RuleID] {
+			staleRules = append(staleRules, ruleError.RuleID)
+		}
+	}
+
+	if len(staleRules) > 0 {
+		setCondition(conditions, generation, v1alpha1.ConditionStale, true, "StaleRules", "rules generated by previous reconciles: "+strings.Join(staleRules, ", "))
+	} else {
+		setCondition(conditions, generation, v1alpha1.ConditionStale, false, "UpToDate", "")
+	}
+}
+
+// setPoolACLConditions derives the conditions of a PoolACL from its status,
+// the PolicyApplied condition is set by the reconciler.
+func setPoolACLConditions(poolACL *v1alpha1.PoolACL) {
+	generation := poolACL.Generation
+	poolACL.Status.ObservedGeneration = generation
+
+	conditions := &poolACL.Status.Conditions
+	if poolACL.Status.Reason != "" {
+		setReadyCondition(conditions, generation, poolACL.Status.Ready, "ReconcileFailed", poolACL.Status.Reason)
+	} else {
+		setReadyCondition(conditions, generation, poolACL.Status.Ready, "RuleErrors", ruleErrorsMessage(poolACL.Status.RuleErrors))
+	}
+
+	setCondition(conditions, generation, v1alpha1.ConditionDegraded, len(poolACL.Status.RuleErrors) > 0, degradedReason(poolACL.Status.RuleErrors), ruleErrorsMessage(poolACL.Status.RuleErrors))
+}
+
+// setDNSEntryConditions derives the conditions of an ACLDNSEntry, the
+// addresses of previous resolutions are kept when the resolution fails.
+func setDNSEntryConditions(dnsEntry *v1alpha1.ACLDNSEntry) {
+	generation := dnsEntry.Generation
+	dnsEntry.Status.ObservedGeneration = generation
+
+	conditions := &dnsEntry.Status.Conditions
+	setReadyCondition(conditions, generation, dnsEntry.Status.Ready, "ResolutionFailed", dnsEntry.Status.Reason)
+	setResolvedCondition(conditions, generation, dnsEntry.Status.Ready, dnsEntry.Status.Reason)
+
+	stale := !dnsEntry.Status.Ready && len(dnsEntry.Status.IPs) > 0
+	if stale {
+		setCondition(conditions, generation, v1alpha1.ConditionStale, true, "ResolutionFailed", "addresses resolved by previous reconciles are kept")
+	} else {
+		setCondition(conditions, generation, v1alpha1.ConditionStale, false, "UpToDate", "")
+	}
+}
+
+// setResourceAddressConditions derives the conditions of TsuruAppAddress and
+// RpaasInstanceAddress objects.
+func setResourceAddressConditions(status *v1alpha1.ResourceAddressStatus, generation int64) {
+	status.ObservedGeneration = generation
+
+	setReadyCondition(&status.Conditions, generation, status.Ready, "ResolutionFailed", status.Reason)
+	setResolvedCondition(&status.Conditions, generation, status.Ready, status.Reason)
+}
+
+func setResolvedCondition(conditions *[]metav1.Condition, generation int64, resolved bool, message string) {
+	if resolved {
+		setCondition(conditions, generation, v1alpha1.ConditionResolved, true, "Resolved", "")
+		return
+	}
+
+	setCondition(conditions, generation, v1alpha1.ConditionResolved, false, "ResolutionFailed", message)
+}
+
+func degradedReason(ruleErrors []v1alpha1.ACLStatusRuleError) string {
+	if len(ruleErrors) > 0 {
+		return "RuleErrors"
+	}
+	return "AllRulesGenerated"
+}
+
+func ruleErrorsMessage(ruleErrors []v1alpha1.ACLStatusRuleError) string {
+	if len(ruleErrors) == 0 {
+		return ""
+	}
+
+	ruleIDs := make([]string, 0, len(ruleErrors))
+	for _, ruleError := range ruleErrors {
+		ruleIDs = append(ruleIDs, ruleError.RuleID)
+	}
+	sort.Strings(ruleIDs)
+
+	return fmt.Sprintf("%d rules with errors: %s", len(ruleIDs), strings.Join(ruleIDs, ", "))
+}
@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	maxUDPMessageSize = 4096
+
+	// dnsDatagramAttempts is the number of times a query is sent over UDP,
+	// datagrams may be lost on the way.
+	dnsDatagramAttempts = 3
+)
+
+// dnsDatagramTimeout is how long the answer of a query sent over UDP is
+// awaited before the query is sent again.
+var dnsDatagramTimeout = 2 * time.Second
+
+// DNSRecord is an address resolved for a host, TTL is zero when the resolver
+// does not know it.
+type DNSRecord struct {
+	IP  net.IP
+	TTL time.Duration
+}
+
+// DNSLookup is the result of the resolution of a host.
+type DNSLookup struct {
+	Records []DNSRecord
+
+	// CNAMEs is the chain of canonical names followed from the host
+	CNAMEs []string
+	// Nameserver is the server that answered, empty for the system resolver
+	Nameserver string
+}
+
+// ACLDNSLookupResolver is implemented by resolvers that return the records of
+// a host with their TTLs.
+type ACLDNSLookupResolver interface {
+	Lookup(context.Context, string) (*DNSLookup, error)
+}
+
+// lookupDNS resolves the host using the records of the resolver when
+// supported, otherwise the addresses are returned with an unknown TTL.
+func lookupDNS(ctx context.Context, resolver ACLDNSResolver, host string) (*DNSLookup, error) {
+	if lookupResolver, ok := resolver.(ACLDNSLookupResolver); ok {
+		return lookupResolver.Lookup(ctx, host)
+	}
+
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := &DNSLookup{}
+	for _, addr := range addrs {
+		lookup.Records = append(lookup.Records, DNSRecord{IP: addr.IP})
+	}
+
+	// the system resolver only tells the canonical name, not the whole chain
+	if cnameResolver, ok := resolver.(interface {
+		LookupCNAME(context.Context, string) (string, error)
+	}); ok {
+		cname, err := cnameResolver.LookupCNAME(ctx, host)
+		if err == nil && !strings.EqualFold(fqdn(cname), fqdn(host)) {
+			lookup.CNAMEs = []string{strings.TrimSuffix(cname, ".")}
+		}
+	}
+
+	return lookup, nil
+}
+
+// minTTL returns the lowest known TTL of the records, zero when no TTL is
+// known.
+func (l *DNSLookup) minTTL() time.Duration {
+	var ttl time.Duration
+	for _, record := range l.Records {
+		if record.TTL > 0 && (ttl == 0 || record.TTL < ttl) {
+			ttl = record.TTL
+		}
+	}
+	return ttl
+}
+
+func (l *DNSLookup) ipAddrs() []net.IPAddr {
+	addrs := make([]net.IPAddr, 0, len(l.Records))
+	for _, record := range l.Records {
+		addrs = append(addrs, net.IPAddr{IP: record.IP})
+	}
+	return addrs
+}
+
+// DNSClient queries a nameserver directly, unlike net.Resolver it keeps the
+// TTL of the records. Without a transport queries are sent over UDP and
+// retried over TCP when the answer is truncated.
+type DNSClient struct {
+	// Server is the host:port of the nameserver, or the URL of the endpoint
+	// for DNS over HTTPS
+	Server    string
+	Transport DNSTransport
+}
+
+var _ ACLDNSLookupResolver = &DNSClient{}
+
+func (c *DNSClient) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	lookup, err := c.Lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return lookup.ipAddrs(), nil
+}
+
+func (c *DNSClient) Lookup(ctx context.Context, host string) (*DNSLookup, error) {
+	name, err := dnsmessage.NewName(fqdn(host))
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host, Server: c.Server}
+	}
+
+	types := []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	results := make([]*DNSLookup, len(types))
+	errs := make([]error, len(types))
+
+	wg := sync.WaitGroup{}
+	for i, qtype := range types {
+		wg.Add(1)
+		go func(i int, qtype dnsmessage.Type) {
+			defer wg.Done()
+			results[i], errs[i] = c.query(ctx, name, qtype)
+		}(i, qtype)
+	}
+	wg.Wait()
+
+	// hosts without AAAA records are common, a failure of one of the
+	// queries is only reported when no address is found
+	lookup := &DNSLookup{Nameserver: c.Server}
+	var lookupErr error
+	for i := range types {
+		if errs[i] != nil {
+			if lookupErr == nil {
+				lookupErr = errs[i]
+			}
+			continue
+		}
+		lookup.Records = append(lookup.Records, results[i].Records...)
+		if len(lookup.CNAMEs) == 0 {
+			lookup.CNAMEs = results[i].CNAMEs
+		}
+	}
+
+	if len(lookup.Records) == 0 {
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, Server: c.Server, IsNotFound: true}
+	}
+
+	return lookup, nil
+}
+
+func (c *DNSClient) query(ctx context.Context, name dnsmessage.Name, qtype dnsmessage.Type) (*DNSLookup, error) {
+	id, err := newDNSMessageID()
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name.String(), Server: c.Server}
+	}
+
+	query := &dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: qtype, Class: dnsmessage.ClassINET},
+		},
+	}
+
+	transport := c.Transport
+	if transport == nil {
+		transport = plainTransport{}
+	}
+
+	response, err := transport.Exchange(ctx, c.Server, query)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name.String(), Server: c.Server, IsTimeout: isTimeout(err)}
+	}
+
+	if response.Header.ID != id {
+		return nil, &net.DNSError{Err: "mismatched response ID", Name: name.String(), Server: c.Server}
+	}
+
+	return parseDNSResponse(response, name.String(), c.Server)
+}
+
+// newDNSMessageID returns an unpredictable ID for a query, answers forged
+// off-path must guess it.
+func newDNSMessageID() (uint16, error) {
+	buf := make([]byte, 2)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(buf), nil
+}
+
+// exchangeDatagram sends the query over UDP, it's sent again when no answer
+// arrives in time, until the deadline.
+func exchangeDatagram(conn net.Conn, query []byte, deadline time.Time) ([]byte, error) {
+	buf := make([]byte, maxUDPMessageSize)
+
+	var err error
+	for attempt := 0; attempt < dnsDatagramAttempts; attempt++ {
+		_, err = conn.Write(query)
+		if err != nil {
+			return nil, err
+		}
+
+		attemptDeadline := time.Now().Add(dnsDatagramTimeout)
+		if !deadline.IsZero() && deadline.Before(attemptDeadline) {
+			attemptDeadline = deadline
+		}
+		conn.SetReadDeadline(attemptDeadline)
+
+		var response []byte
+		response, err = readDatagram(conn, buf, query)
+		if err == nil {
+			return response, nil
+		}
+		if !isTimeout(err) || (!deadline.IsZero() && !time.Now().Before(deadline)) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// readDatagram reads until a datagram with the ID of the query arrives, the
+// other datagrams are stale or forged answers.
+func readDatagram(conn net.Conn, buf, query []byte) ([]byte, error) {
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n >= 2 && buf[0] == query[0] && buf[1] == query[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+// exchangeStream sends the query prefixed by its length, as DNS over TCP and
+// DNS over TLS do.
+func exchangeStream(conn io.ReadWriter, query []byte) ([]byte, error) {
+	buf := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(buf, uint16(len(query)))
+	copy(buf[2:], query)
+	_, err := conn.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	length := make([]byte, 2)
+	_, err = io.ReadFull(conn, length)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, binary.BigEndian.Uint16(length))
+	_, err = io.ReadFull(conn, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// parseDNSResponse returns the addresses of the answer, CNAME records are
+// followed from the queried name.
+func parseDNSResponse(response *dnsmessage.Message, name, server string) (*DNSLookup, error) {
+	switch response.Header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, &net.DNSError{Err: "no such host", Name: name, Server: server, IsNotFound: true}
+	default:
+		return nil, &net.DNSError{Err: fmt.Sprintf("server answered %s", response.Header.RCode), Name: name, Server: server}
+	}
+
+	cnames := map[string]string{}
+	for _, answer := range response.Answers {
+		if cname, ok := answer.Body.(*dnsmessage.CNAMEResource); ok {
+			cnames[strings.ToLower(answer.Header.Name.String())] = strings.ToLower(cname.CNAME.String())
+		}
+	}
+
+	lookup := &DNSLookup{}
+	target := strings.ToLower(name)
+	for i := 0; i < len(cnames); i++ {
+		next, found := cnames[target]
+		if !found {
+			break
+		}
+		target = next
+		lookup.CNAMEs = append(lookup.CNAMEs, strings.TrimSuffix(target, "."))
+	}
+
+	for _, answer := range response.Answers {
+		if strings.ToLower(answer.Header.Name.String()) != target {
+			continue
+		}
+
+		ttl := time.Duration(answer.Header.TTL) * time.Second
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			lookup.Records = append(lookup.Records, DNSRecord{IP: net.IP(body.A[:]), TTL: ttl})
+		case *dnsmessage.AAAAResource:
+			lookup.Records = append(lookup.Records, DNSRecord{IP: net.IP(body.AAAA[:]), TTL: ttl})
+		}
+	}
+
+	return lookup, nil
+}
+
+func fqdn(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNSServer answers the queries sent over UDP with the given resources,
+// the response is truncated when truncateUDP is set so the client retries
+// over TCP on the same address. dropUDP ignores the first datagram of each
+// question and forgeUDP sends an answer with another ID before the real one.
+type fakeDNSServer struct {
+	answers     map[string][]dnsmessage.Resource
+	truncateUDP bool
+	dropUDP     bool
+	forgeUDP    bool
+
+	mu      sync.Mutex
+	dropped map[string]bool
+}
+
+// drop returns true for the first datagram of each question when dropUDP is
+// set.
+func (f *fakeDNSServer) drop(t *testing.T, query []byte) bool {
+	if !f.dropUDP {
+		return false
+	}
+
+	message := &dnsmessage.Message{}
+	require.NoError(t, message.Unpack(query))
+	key := message.Questions[0].GoString()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dropped == nil {
+		f.dropped = map[string]bool{}
+	}
+	if f.dropped[key] {
+		return false
+	}
+	f.dropped[key] = true
+	return true
+}
+
+func (f *fakeDNSServer) start(t *testing.T) string {
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { udpConn.Close() })
+
+	tcpListener, err := net.Listen("tcp", udpConn.LocalAddr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { tcpListener.Close() })
+
+	go func() {
+		buf := make([]byte, maxUDPMessageSize)
+		for {
+			n, addr, err := udpConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if f.drop(t, buf[:n]) {
+				continue
+			}
+			response := f.answer(t, buf[:n], f.truncateUDP)
+			if f.forgeUDP {
+				forged := append([]byte{response[0] ^ 0xff, response[1]}, response[2:]...)
+				udpConn.WriteTo(forged, addr)
+			}
+			udpConn.WriteTo(response, addr)
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := tcpListener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serveStream(t, conn)
+		}
+	}()
+
+	return udpConn.LocalAddr().String()
+}
+
+// serveStream answers a query prefixed by its length, as sent over TCP and
+// TLS.
+func (f *fakeDNSServer) serveStream(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return
+	}
+	query := make([]byte, int(buf[0])<<8|int(buf[1]))
+	if _, err := io.ReadFull(conn, query); err != nil {
+		return
+	}
+	response := f.answer(t, query, false)
+	conn.Write(append([]byte{byte(len(response) >> 8), byte(len(response))}, response...))
+}
+
+func (f *fakeDNSServer) answer(t *testing.T, query []byte, truncate bool) []byte {
+	message := &dnsmessage.Message{}
+	require.NoError(t, message.Unpack(query))
+
+	question := message.Questions[0]
+	message.Header.Response = true
+
+	answers, found := f.answers[question.Name.String()]
+	if !found {
+		message.Header.RCode = dnsmessage.RCodeNameError
+	}
+
+	if truncate {
+		message.Header.Truncated = true
+	} else {
+		for _, answer := range answers {
+			_, isCNAME := answer.Body.(*dnsmessage.CNAMEResource)
+			if isCNAME || answer.Header.Type == question.Type {
+				message.Answers = append(message.Answers, answer)
+			}
+		}
+	}
+
+	response, err := message.Pack()
+	require.NoError(t, err)
+	return response
+}
+
+func aResource(name string, ttl uint32, ip string) dnsmessage.Resource {
+	body := &dnsmessage.AResource{}
+	copy(body.A[:], net.ParseIP(ip).To4())
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   body,
+	}
+}
+
+func aaaaResource(name string, ttl uint32, ip string) dnsmessage.Resource {
+	body := &dnsmessage.AAAAResource{}
+	copy(body.AAAA[:], net.ParseIP(ip).To16())
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   body,
+	}
+}
+
+func cnameResource(name string, ttl uint32, target string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target)},
+	}
+}
+
+func TestDNSClientLookup(t *testing.T) {
+	server := &fakeDNSServer{
+		answers: map[string][]dnsmessage.Resource{
+			"cdn.example.com.": {
+				cnameResource("cdn.example.com.", 3600, "edge.cdn.example.net."),
+				aResource("edge.cdn.example.net.", 60, "10.0.0.1"),
+				aResource("edge.cdn.example.net.", 30, "10.0.0.2"),
+				aResource("other.example.net.", 30, "10.0.0.3"),
+				aaaaResource("edge.cdn.example.net.", 90, "2001:db8::1"),
+			},
+		},
+	}
+	client := &DNSClient{Server: server.start(t)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lookup, err := client.Lookup(ctx, "cdn.example.com")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []DNSRecord{
+		{IP: net.ParseIP("10.0.0.1").To4(), TTL: 60 * time.Second},
+		{IP: net.ParseIP("10.0.0.2").To4(), TTL: 30 * time.Second},
+		{IP: net.ParseIP("2001:db8::1"), TTL: 90 * time.Second},
+	}, lookup.Records)
+	assert.Equal(t, 30*time.Second, lookup.minTTL())
+	assert.Equal(t, []string{"edge.cdn.example.net"}, lookup.CNAMEs)
+	assert.Equal(t, client.Server, lookup.Nameserver)
+}
+
+func TestDNSClientLookupTruncated(t *testing.T) {
+	server := &fakeDNSServer{
+		answers: map[string][]dnsmessage.Resource{
+			"api.example.com.": {
+				aResource("api.example.com.", 60, "10.0.0.1"),
+			},
+		},
+		truncateUDP: true,
+	}
+	client := &DNSClient{Server: server.start(t)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := client.LookupIPAddr(ctx, "api.example.com")
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	assert.Equal(t, "10.0.0.1", addrs[0].IP.String())
+}
+
+func TestDNSClientLookupIgnoresMismatchedID(t *testing.T) {
+	server := &fakeDNSServer{
+		answers: map[string][]dnsmessage.Resource{
+			"api.example.com.": {
+				aResource("api.example.com.", 60, "10.0.0.1"),
+			},
+		},
+		forgeUDP: true,
+	}
+	client := &DNSClient{Server: server.start(t)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := client.LookupIPAddr(ctx, "api.example.com")
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	assert.Equal(t, "10.0.0.1", addrs[0].IP.String())
+}
+
+func TestDNSClientLookupRetransmits(t *testing.T) {
+	timeout := dnsDatagramTimeout
+	dnsDatagramTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { dnsDatagramTimeout = timeout })
+
+	server := &fakeDNSServer{
+		answers: map[string][]dnsmessage.Resource{
+			"api.example.com.": {
+				aResource("api.example.com.", 60, "10.0.0.1"),
+			},
+		},
+		dropUDP: true,
+	}
+	client := &DNSClient{Server: server.start(t)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := client.LookupIPAddr(ctx, "api.example.com")
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	assert.Equal(t, "10.0.0.1", addrs[0].IP.String())
+}
+
+func TestDNSClientLookupNotFound(t *testing.T) {
+	server := &fakeDNSServer{}
+	client := &DNSClient{Server: server.start(t)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := client.Lookup(ctx, "missing.example.com")
+	require.Error(t, err)
+
+	var dnsErr *net.DNSError
+	require.True(t, errors.As(err, &dnsErr))
+	assert.True(t, dnsErr.IsNotFound)
+}
+
+func TestMultiResolverLookupKeepsLowestTTL(t *testing.T) {
+	resolver := &MultiResolver{
+		Resolvers: []ACLDNSResolver{
+			&fakeLookupResolver{lookups: map[string]*DNSLookup{
+				"api.example.com": {Records: []DNSRecord{{IP: net.ParseIP("10.0.0.1"), TTL: time.Minute}}, Nameserver: "10.0.0.10:53"},
+			}},
+			&fakeLookupResolver{lookups: map[string]*DNSLookup{
+				"api.example.com": {Records: []DNSRecord{{IP: net.ParseIP("10.0.0.1"), TTL: 20 * time.Second}}, Nameserver: "10.0.0.11:53"},
+			}},
+			&fakeResolver{hosts: map[string][]string{"api.example.com": {"10.0.0.2"}}},
+		},
+	}
+
+	lookup, err := resolver.Lookup(context.Background(), "api.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []DNSRecord{
+		{IP: net.ParseIP("10.0.0.1"), TTL: 20 * time.Second},
+		{IP: net.ParseIP("10.0.0.2")},
+	}, lookup.Records)
+	assert.Equal(t, "10.0.0.10:53,10.0.0.11:53", lookup.Nameserver)
+}
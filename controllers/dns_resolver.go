@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDNSPort    = "53"
+	defaultDNSTLSPort = "853"
+
+	dnsTLSScheme   = "tls://"
+	dnsHTTPSScheme = "https://"
+
+	dnsHTTPSTimeout = 10 * time.Second
+)
+
+// MultiResolver queries all its resolvers in parallel and returns the union
+// of their answers, the lookup only fails when every resolver fails.
+type MultiResolver struct {
+	Resolvers []ACLDNSResolver
+}
+
+var _ ACLDNSLookupResolver = &MultiResolver{}
+
+func (m *MultiResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	lookup, err := m.Lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return lookup.ipAddrs(), nil
+}
+
+// Lookup merges the records of all resolvers, the lowest TTL is kept for
+// addresses answered by more than one resolver. The nameservers that answered
+// are joined by commas.
+func (m *MultiResolver) Lookup(ctx context.Context, host string) (*DNSLookup, error) {
+	type lookupResult struct {
+		lookup *DNSLookup
+		err    error
+	}
+
+	results := make([]lookupResult, len(m.Resolvers))
+	wg := sync.WaitGroup{}
+	for i, resolver := range m.Resolvers {
+		wg.Add(1)
+		go func(i int, resolver ACLDNSResolver) {
+			defer wg.Done()
+			lookup, err := lookupDNS(ctx, resolver, host)
+			results[i] = lookupResult{lookup: lookup, err: err}
+		}(i, resolver)
+	}
+	wg.Wait()
+
+	lookup := &DNSLookup{}
+	recordIndex := map[string]int{}
+	nameservers := []string{}
+	errs := []error{}
+	for _, result := range results {
+		if result.err != nil {
+			errs = append(errs, result.err)
+			continue
+		}
+
+		if result.lookup.Nameserver != "" {
+			nameservers = append(nameservers, result.lookup.Nameserver)
+		}
+		if len(lookup.CNAMEs) == 0 {
+			lookup.CNAMEs = result.lookup.CNAMEs
+		}
+
+		for _, record := range result.lookup.Records {
+			i, found := recordIndex[record.IP.String()]
+			if !found {
+				recordIndex[record.IP.String()] = len(lookup.Records)
+				lookup.Records = append(lookup.Records, record)
+				continue
+			}
+
+			existing := &lookup.Records[i]
+			if record.TTL > 0 && (existing.TTL == 0 || record.TTL < existing.TTL) {
+				existing.TTL = record.TTL
+			}
+		}
+	}
+
+	if len(errs) == len(results) {
+		if len(errs) == 0 {
+			return nil, fmt.Errorf("no resolvers to lookup %s", host)
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	lookup.Nameserver = strings.Join(nameservers, ",")
+	return lookup, nil
+}
+
+// NewUpstreamResolver returns a resolver that sends the queries to the given
+// nameservers instead of the ones of resolv.conf, the answers of all servers
+// are merged. Nameservers prefixed by tls:// are queried over DNS over TLS and
+// https:// URLs over DNS over HTTPS, both verify the server certificate with
+// tlsConfig, nil uses the system roots. Without servers DefaultResolver is
+// returned.
+func NewUpstreamResolver(servers []string, tlsConfig *tls.Config) (ACLDNSResolver, error) {
+	if len(servers) == 0 {
+		return DefaultResolver, nil
+	}
+
+	var httpClient *http.Client
+	resolvers := make([]ACLDNSResolver, 0, len(servers))
+	for _, server := range servers {
+		switch {
+		case strings.HasPrefix(server, dnsHTTPSScheme):
+			endpoint, err := url.Parse(server)
+			if err != nil || endpoint.Host == "" {
+				return nil, fmt.Errorf("invalid nameserver %q: must be a DNS over HTTPS URL", server)
+			}
+			if httpClient == nil {
+				httpClient = newDNSHTTPClient(tlsConfig)
+			}
+			resolvers = append(resolvers, &DNSClient{Server: server, Transport: &HTTPSTransport{Client: httpClient}})
+
+		case strings.HasPrefix(server, dnsTLSScheme):
+			address, err := tlsNameserverAddress(strings.TrimPrefix(server, dnsTLSScheme))
+			if err != nil {
+				return nil, err
+			}
+			resolvers = append(resolvers, &DNSClient{Server: address, Transport: &TLSTransport{Config: tlsConfig}})
+
+		default:
+			address, err := nameserverAddress(server)
+			if err != nil {
+				return nil, err
+			}
+			resolvers = append(resolvers, &DNSClient{Server: address})
+		}
+	}
+
+	if len(resolvers) == 1 {
+		return resolvers[0], nil
+	}
+
+	return &MultiResolver{Resolvers: resolvers}, nil
+}
+
+// ParseNameservers splits a comma separated list of nameservers.
+func ParseNameservers(value string) []string {
+	servers := []string{}
+	for _, server := range strings.Split(value, ",") {
+		server = strings.TrimSpace(server)
+		if server != "" {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+// nameserverAddress returns the host:port of a nameserver, the port defaults
+// to 53.
+func nameserverAddress(server string) (string, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host, port = strings.Trim(server, "[]"), defaultDNSPort
+	}
+
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("invalid nameserver %q: must be an IP address", server)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// tlsNameserverAddress returns the host:port of a DNS over TLS nameserver,
+// the port defaults to 853. Unlike plain nameservers the host may be a name,
+// it is used to verify the certificate of the server.
+func tlsNameserverAddress(server string) (string, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host, port = strings.Trim(server, "[]"), defaultDNSTLSPort
+	}
+
+	if host == "" {
+		return "", fmt.Errorf("invalid nameserver %q: missing host", dnsTLSScheme+server)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+func newDNSHTTPClient(tlsConfig *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{
+		Transport: transport,
+		Timeout:   dnsHTTPSTimeout,
+	}
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiResolverUnionAnswers(t *testing.T) {
+	resolver := &MultiResolver{
+		Resolvers: []ACLDNSResolver{
+			&fakeResolver{hosts: map[string][]string{"api.example.com": {"10.0.0.1", "10.0.0.2"}}},
+			&fakeResolver{hosts: map[string][]string{"api.example.com": {"10.0.0.2", "10.0.0.3"}}},
+			&fakeResolver{errors: map[string]error{"api.example.com": errors.New("server misbehaving")}},
+		},
+	}
+
+	addrs, err := resolver.LookupIPAddr(context.Background(), "api.example.com")
+	require.NoError(t, err)
+
+	ips := []string{}
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP.String())
+	}
+	assert.ElementsMatch(t, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, ips)
+}
+
+func TestMultiResolverAllUpstreamsFail(t *testing.T) {
+	resolver := &MultiResolver{
+		Resolvers: []ACLDNSResolver{
+			&fakeResolver{errors: map[string]error{"api.example.com": errors.New("timeout")}},
+			&fakeResolver{errors: map[string]error{"api.example.com": &net.DNSError{Err: "no such host", Name: "api.example.com", IsNotFound: true}}},
+		},
+	}
+
+	_, err := resolver.LookupIPAddr(context.Background(), "api.example.com")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout")
+	assert.Contains(t, err.Error(), "no such host")
+}
+
+func TestNewUpstreamResolver(t *testing.T) {
+	resolver, err := NewUpstreamResolver(nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultResolver, resolver)
+
+	resolver, err = NewUpstreamResolver([]string{"10.0.0.10"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &DNSClient{Server: "10.0.0.10:53"}, resolver)
+
+	resolver, err = NewUpstreamResolver(ParseNameservers("10.0.0.10, 10.0.0.11:5353,"), nil)
+	require.NoError(t, err)
+	require.IsType(t, &MultiResolver{}, resolver)
+	assert.Len(t, resolver.(*MultiResolver).Resolvers, 2)
+
+	_, err = NewUpstreamResolver([]string{"dns.example.com"}, nil)
+	assert.EqualError(t, err, `invalid nameserver "dns.example.com": must be an IP address`)
+}
+
+func TestNewUpstreamResolverEncrypted(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "dns.example.com"}
+
+	resolver, err := NewUpstreamResolver([]string{"tls://dns.example.com"}, tlsConfig)
+	require.NoError(t, err)
+	assert.Equal(t, &DNSClient{Server: "dns.example.com:853", Transport: &TLSTransport{Config: tlsConfig}}, resolver)
+
+	resolver, err = NewUpstreamResolver([]string{"tls://10.0.0.10:8853"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &DNSClient{Server: "10.0.0.10:8853", Transport: &TLSTransport{}}, resolver)
+
+	resolver, err = NewUpstreamResolver([]string{"https://doh.example.com/dns-query"}, tlsConfig)
+	require.NoError(t, err)
+	require.IsType(t, &DNSClient{}, resolver)
+	assert.Equal(t, "https://doh.example.com/dns-query", resolver.(*DNSClient).Server)
+	require.IsType(t, &HTTPSTransport{}, resolver.(*DNSClient).Transport)
+	httpTransport := resolver.(*DNSClient).Transport.(*HTTPSTransport).Client.Transport.(*http.Transport)
+	assert.Equal(t, tlsConfig, httpTransport.TLSClientConfig)
+
+	_, err = NewUpstreamResolver([]string{"https:///dns-query"}, nil)
+	assert.EqualError(t, err, `invalid nameserver "https:///dns-query": must be a DNS over HTTPS URL`)
+
+	_, err = NewUpstreamResolver([]string{"tls://:853"}, nil)
+	assert.EqualError(t, err, `invalid nameserver "tls://:853": missing host`)
+}
+
+func TestNameserverAddress(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.10":          "10.0.0.10:53",
+		"10.0.0.10:5353":     "10.0.0.10:5353",
+		"2001:db8::1":        "[2001:db8::1]:53",
+		"[2001:db8::1]":      "[2001:db8::1]:53",
+		"[2001:db8::1]:5353": "[2001:db8::1]:5353",
+	}
+
+	for server, expected := range tests {
+		address, err := nameserverAddress(server)
+		require.NoError(t, err, server)
+		assert.Equal(t, expected, address, server)
+	}
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dnsMessageContentType = "application/dns-message"
+	maxDNSMessageSize     = 65535
+)
+
+// DNSTransport sends a query to a nameserver and returns its response.
+type DNSTransport interface {
+	Exchange(ctx context.Context, server string, query *dnsmessage.Message) (*dnsmessage.Message, error)
+}
+
+// plainTransport sends the queries over UDP and retries over TCP when the
+// answer is truncated.
+type plainTransport struct{}
+
+func (plainTransport) Exchange(ctx context.Context, server string, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{}
+	response, err := exchangeConn(ctx, dialer, "udp", server, packed)
+	if err == nil && response.Header.Truncated {
+		response, err = exchangeConn(ctx, dialer, "tcp", server, packed)
+	}
+	return response, err
+}
+
+// TLSTransport sends the queries over DNS over TLS (RFC 7858), the server
+// certificate is verified against the host of the nameserver address.
+type TLSTransport struct {
+	// Config is the TLS configuration, nil uses the system roots
+	Config *tls.Config
+}
+
+func (t *TLSTransport) Exchange(ctx context.Context, server string, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	return exchangeConn(ctx, &tls.Dialer{Config: t.Config}, "tcp", server, packed)
+}
+
+// HTTPSTransport sends the queries over DNS over HTTPS (RFC 8484), the
+// server is the URL of the DoH endpoint.
+type HTTPSTransport struct {
+	Client *http.Client
+}
+
+func (t *HTTPSTransport) Exchange(ctx context.Context, server string, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	// RFC 8484 recommends the ID 0 so the responses can be cached
+	id := query.Header.ID
+	httpQuery := *query
+	httpQuery.Header.ID = 0
+	packed, err := httpQuery.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dnsMessageContentType)
+	req.Header.Set("Accept", dnsMessageContentType)
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server answered HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDNSMessageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	response := &dnsmessage.Message{}
+	err = response.Unpack(body)
+	if err != nil {
+		return nil, err
+	}
+	response.Header.ID = id
+	return response, nil
+}
+
+type contextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+func exchangeConn(ctx context.Context, dialer contextDialer, network, server string, query []byte) (*dnsmessage.Message, error) {
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var response []byte
+	if network == "udp" {
+		response, err = exchangeDatagram(conn, query, deadline)
+	} else {
+		response, err = exchangeStream(conn, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	message := &dnsmessage.Message{}
+	err = message.Unpack(response)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newTestCertificate returns a self signed certificate for localhost and
+// 127.0.0.1 and a pool that trusts it.
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// startTLS answers the queries sent over DNS over TLS.
+func (f *fakeDNSServer) startTLS(t *testing.T, cert tls.Certificate) string {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serveStream(t, conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// handler answers the queries sent over DNS over HTTPS, responses keep the
+// ID of the query.
+func (f *fakeDNSServer) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dnsMessageContentType {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		query, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Zero(t, int(query[0])<<8|int(query[1]), "DNS over HTTPS queries must use the ID 0")
+
+		w.Header().Set("Content-Type", dnsMessageContentType)
+		w.Write(f.answer(t, query, false))
+	})
+}
+
+func TestDNSClientLookupOverTLS(t *testing.T) {
+	cert, pool := newTestCertificate(t)
+	server := &fakeDNSServer{
+		answers: map[string][]dnsmessage.Resource{
+			"internal.example.com.": {
+				aResource("internal.example.com.", 60, "10.0.0.1"),
+			},
+		},
+	}
+	client := &DNSClient{
+		Server:    server.startTLS(t, cert),
+		Transport: &TLSTransport{Config: &tls.Config{RootCAs: pool}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lookup, err := client.Lookup(ctx, "internal.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []DNSRecord{{IP: net.ParseIP("10.0.0.1").To4(), TTL: time.Minute}}, lookup.Records)
+
+	// the certificate of the server is verified
+	client.Transport = &TLSTransport{}
+	_, err = client.Lookup(ctx, "internal.example.com")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "certificate")
+}
+
+func TestDNSClientLookupOverHTTPS(t *testing.T) {
+	server := &fakeDNSServer{
+		answers: map[string][]dnsmessage.Resource{
+			"internal.example.com.": {
+				cnameResource("internal.example.com.", 300, "lb.internal.example.com."),
+				aResource("lb.internal.example.com.", 60, "10.0.0.1"),
+				aaaaResource("lb.internal.example.com.", 30, "2001:db8::1"),
+			},
+		},
+	}
+	httpServer := httptest.NewTLSServer(server.handler(t))
+	defer httpServer.Close()
+
+	resolver, err := NewUpstreamResolver([]string{httpServer.URL + "/dns-query"}, &tls.Config{RootCAs: httpServer.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lookup, err := resolver.(*DNSClient).Lookup(ctx, "internal.example.com")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []DNSRecord{
+		{IP: net.ParseIP("10.0.0.1").To4(), TTL: time.Minute},
+		{IP: net.ParseIP("2001:db8::1"), TTL: 30 * time.Second},
+	}, lookup.Records)
+	assert.Equal(t, []string{"lb.internal.example.com"}, lookup.CNAMEs)
+	assert.Equal(t, httpServer.URL+"/dns-query", lookup.Nameserver)
+
+	_, err = resolver.(*DNSClient).Lookup(ctx, "missing.example.com")
+	require.Error(t, err)
+	assert.True(t, err.(*net.DNSError).IsNotFound)
+}
+
+func TestHTTPSTransportErrorStatus(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer httpServer.Close()
+
+	client := &DNSClient{Server: httpServer.URL, Transport: &HTTPSTransport{}}
+	_, err := client.LookupIPAddr(context.Background(), "internal.example.com")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server answered HTTP 502")
+}
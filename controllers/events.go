@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the events emitted by the controllers.
+const (
+	eventReasonPolicyCreated           = "PolicyCreated"
+	eventReasonPolicyUpdated           = "PolicyUpdated"
+	eventReasonPolicyRemoved           = "PolicyRemoved"
+	eventReasonReconcileFailed         = "ReconcileFailed"
+	eventReasonUnsupportedDestination  = "UnsupportedDestination"
+	eventReasonRuleFailed              = "RuleFailed"
+	eventReasonRuleFallbackToStale     = "RuleFallbackToStale"
+	eventReasonDNSResolutionFailed     = "DNSResolutionFailed"
+	eventReasonAddressResolutionFailed = "AddressResolutionFailed"
+	eventReasonGarbageCollected        = "GarbageCollected"
+)
+
+// recordEvent emits an event about the object, controllers without a
+// recorder, like the ones built by tests, do not emit events.
+func recordEvent(recorder record.EventRecorder, obj runtime.Object, eventType, reason, message string) {
+	if recorder == nil {
+		return
+	}
+
+	recorder.Event(obj, eventType, reason, message)
+}
@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	netv1 "k8s.io/api/networking/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// ACLPolicy holds the rules generated for an ACL, the PolicyBackend renders it
+// into the objects enforced by the cluster.
+type ACLPolicy struct {
+	Name        string
+	PodSelector metav1.LabelSelector
+	PolicyTypes []netv1.PolicyType
+	Egress      []netv1.NetworkPolicyEgressRule
+	Ingress     []netv1.NetworkPolicyIngressRule
+
+	// EgressDeny holds the rules of the destinations with the Deny action,
+	// they take precedence over the Egress rules.
+	EgressDeny []netv1.NetworkPolicyEgressRule
+
+	// NativeDestinations are rendered directly by the backend, no egress
+	// rules are generated for them.
+	NativeDestinations []v1alpha1.ACLSpecDestination
+
+	// NativeDestinationPorts holds the ports resolved for the native
+	// destinations, by the rule ID of the destination.
+	NativeDestinationPorts map[string][]netv1.NetworkPolicyPort
+}
+
+// PolicyBackend describes the policy objects used to enforce the ACLs,
+// backends differ on which destinations they are able to express.
+type PolicyBackend interface {
+	// Name is the name of the backend, used on logs and rule errors.
+	Name() string
+
+	// ValidateDestination returns an error when the backend has no way to
+	// express the destination.
+	ValidateDestination(destination v1alpha1.ACLSpecDestination) error
+
+	// IsNativeDestination returns true when the backend renders the
+	// destination by itself instead of using the generated egress rules.
+	IsNativeDestination(destination v1alpha1.ACLSpecDestination) bool
+
+	// NewObject returns an empty object of the kind managed by the backend.
+	NewObject() client.Object
+
+	// Render returns the policy object of the ACL without applying it.
+	Render(acl *v1alpha1.ACL, policy *ACLPolicy) (client.Object, error)
+
+	// Ensure creates or updates the policy object of the ACL.
+	Ensure(ctx context.Context, c client.Client, acl *v1alpha1.ACL, policy *ACLPolicy) (controllerutil.OperationResult, error)
+}
+
+// PolicyBackendCollector is implemented by backends that create objects that
+// can not be owned by the ACL, like cluster scoped ones, which are removed by
+// the ACLGarbageCollector.
+type PolicyBackendCollector interface {
+	OrphanObjects(ctx context.Context, c client.Client, acls []v1alpha1.ACL) ([]client.Object, error)
+}
+
+// PolicyBackendDependentsRemover is implemented by backends that create other
+// objects along with each policy object, they are removed when the policy
+// object stops being generated.
+type PolicyBackendDependentsRemover interface {
+	RemovePolicyDependents(ctx context.Context, c client.Client, acl *v1alpha1.ACL, policyName string) error
+}
+
+// NetworkPolicyBackend enforces ACLs using networking.k8s.io/v1 NetworkPolicy,
+// which is only able to allow IP blocks and pod selectors.
+var NetworkPolicyBackend PolicyBackend = &networkPolicyBackend{}
+
+type networkPolicyBackend struct{}
+
+func (b *networkPolicyBackend) Name() string {
+	return "networkpolicy"
+}
+
+func (b *networkPolicyBackend) ValidateDestination(destination v1alpha1.ACLSpecDestination) error {
+	if destination.Action == v1alpha1.ACLActionDeny {
+		return fmt.Errorf("deny rules are not supported by the %s policy backend", b.Name())
+	}
+
+	return b.validatePeers(destination)
+}
+
+// validatePeers checks if the destination can be expressed by IP blocks and
+// pod selectors, regardless of its action.
+func (b *networkPolicyBackend) validatePeers(destination v1alpha1.ACLSpecDestination) error {
+	if destination.ExternalDNS != nil && isWildCard(destination.ExternalDNS.Name) {
+		return fmt.Errorf("wildcard DNS %q is not supported by the %s policy backend", destination.ExternalDNS.Name, b.Name())
+	}
+
+	return nil
+}
+
+func (b *networkPolicyBackend) IsNativeDestination(destination v1alpha1.ACLSpecDestination) bool {
+	return false
+}
+
+func (b *networkPolicyBackend) NewObject() client.Object {
+	return &netv1.NetworkPolicy{}
+}
+
+func (b *networkPolicyBackend) Render(acl *v1alpha1.ACL, policy *ACLPolicy) (client.Object, error) {
+	return &netv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: netv1.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: acl.Namespace,
+			Name:      policy.Name,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(acl, acl.GroupVersionKind()),
+			},
+		},
+		Spec: netv1.NetworkPolicySpec{
+			PodSelector: policy.PodSelector,
+			PolicyTypes: policy.PolicyTypes,
+			Egress:      policy.Egress,
+			Ingress:     policy.Ingress,
+		},
+	}, nil
+}
+
+func (b *networkPolicyBackend) Ensure(ctx context.Context, c client.Client, acl *v1alpha1.ACL, policy *ACLPolicy) (controllerutil.OperationResult, error) {
+	networkPolicy := &netv1.NetworkPolicy{}
+	err := c.Get(ctx, client.ObjectKey{
+		Namespace: acl.Namespace,
+		Name:      policy.Name,
+	}, networkPolicy)
+
+	if k8sErrors.IsNotFound(err) {
+	} else if err != nil {
+		return controllerutil.OperationResultNone, fmt.Errorf("could not get NetworkPolicy object: %w", err)
+	}
+
+	networkPolicyHasChanges := false
+	networkPolicy.Namespace = acl.Namespace
+	networkPolicy.Name = policy.Name
+
+	if len(networkPolicy.OwnerReferences) == 0 {
+		networkPolicy.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(acl, acl.GroupVersionKind()),
+		}
+
+		networkPolicyHasChanges = true
+	}
+
+	if !reflect.DeepEqual(networkPolicy.Spec.PolicyTypes, policy.PolicyTypes) {
+		networkPolicy.Spec.PolicyTypes = policy.PolicyTypes
+		networkPolicyHasChanges = true
+	}
+
+	if !reflect.DeepEqual(networkPolicy.Spec.PodSelector, policy.PodSelector) {
+		networkPolicy.Spec.PodSelector = policy.PodSelector
+		networkPolicyHasChanges = true
+	}
+
+	if !reflect.DeepEqual(networkPolicy.Spec.Egress, policy.Egress) {
+		networkPolicy.Spec.Egress = policy.Egress
+		networkPolicyHasChanges = true
+	}
+
+	if !reflect.DeepEqual(networkPolicy.Spec.Ingress, policy.Ingress) {
+		networkPolicy.Spec.Ingress = policy.Ingress
+		networkPolicyHasChanges = true
+	}
+
+	if networkPolicy.CreationTimestamp.IsZero() {
+		err = c.Create(ctx, networkPolicy)
+		if err != nil {
+			return controllerutil.OperationResultNone, fmt.Errorf("could not create NetworkPolicy object: %w", err)
+		}
+		return controllerutil.OperationResultCreated, nil
+	}
+
+	if !networkPolicyHasChanges {
+		return controllerutil.OperationResultNone, nil
+	}
+
+	err = c.Update(ctx, networkPolicy)
+	if err != nil {
+		return controllerutil.OperationResultNone, fmt.Errorf("could not update NetworkPolicy object: %w", err)
+	}
+	return controllerutil.OperationResultUpdated, nil
+}
+
+// ensureUnstructured creates or updates an object of a kind that is not
+// registered on the scheme, only the labels, owner references and spec of
+// existing objects are managed.
+func ensureUnstructured(ctx context.Context, c client.Client, desired *unstructured.Unstructured) (controllerutil.OperationResult, error) {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(desired.GroupVersionKind())
+	err := c.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+
+	if k8sErrors.IsNotFound(err) {
+		err = c.Create(ctx, desired)
+		if err != nil {
+			return controllerutil.OperationResultNone, fmt.Errorf("could not create %s object: %w", desired.GetKind(), err)
+		}
+		return controllerutil.OperationResultCreated, nil
+	} else if err != nil {
+		return controllerutil.OperationResultNone, fmt.Errorf("could not get %s object: %w", desired.GetKind(), err)
+	}
+
+	hasChanges := false
+
+	if len(existing.GetOwnerReferences()) == 0 && len(desired.GetOwnerReferences()) > 0 {
+		existing.SetOwnerReferences(desired.GetOwnerReferences())
+		hasChanges = true
+	}
+
+	labels := existing.GetLabels()
+	for key, value := range desired.GetLabels() {
+		if labels[key] != value {
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[key] = value
+			hasChanges = true
+		}
+	}
+	existing.SetLabels(labels)
+
+	if !reflect.DeepEqual(existing.Object["spec"], desired.Object["spec"]) {
+		existing.Object["spec"] = desired.Object["spec"]
+		hasChanges = true
+	}
+
+	if !hasChanges {
+		return controllerutil.OperationResultNone, nil
+	}
+
+	err = c.Update(ctx, existing)
+	if err != nil {
+		return controllerutil.OperationResultNone, fmt.Errorf("could not update %s object: %w", desired.GetKind(), err)
+	}
+	return controllerutil.OperationResultUpdated, nil
+}
+
+// PolicyBackendByName returns the backend selected by the --policy-backend
+// flag, an empty name selects NetworkPolicyBackend.
+func PolicyBackendByName(name string) (PolicyBackend, error) {
+	switch name {
+	case "", NetworkPolicyBackend.Name():
+		return NetworkPolicyBackend, nil
+	case CiliumBackend.Name():
+		return CiliumBackend, nil
+	case CalicoBackend.Name():
+		return CalicoBackend, nil
+	}
+
+	return nil, fmt.Errorf("unknown policy backend %q", name)
+}
+
+// ruleIDForDestination returns the ruleID used to report errors of a
+// destination, destinations without ruleID get an ID derived from its content.
+func ruleIDForDestination(destination v1alpha1.ACLSpecDestination) string {
+	if destination.RuleID != "" {
+		return destination.RuleID
+	}
+
+	if destination.ExternalDNS != nil {
+		return "externalDNS/" + destination.ExternalDNS.Name
+	}
+
+	destinationJSON, _ := json.Marshal(destination)
+	return string(destinationJSON)
+}
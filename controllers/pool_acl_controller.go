@@ -0,0 +1,744 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var (
+	adminNetworkPolicyGVK = schema.GroupVersionKind{
+		Group:   "policy.networking.k8s.io",
+		Version: "v1alpha1",
+		Kind:    "AdminNetworkPolicy",
+	}
+	baselineAdminNetworkPolicyGVK = schema.GroupVersionKind{
+		Group:   "policy.networking.k8s.io",
+		Version: "v1alpha1",
+		Kind:    "BaselineAdminNetworkPolicy",
+	}
+)
+
+const (
+	// baselineAdminNetworkPolicyName is the only name accepted for the
+	// BaselineAdminNetworkPolicy, which is a cluster singleton.
+	baselineAdminNetworkPolicyName = "default"
+
+	adminNetworkPolicyMaxRules = 100
+
+	// defaultAdminNetworkPolicyPriority is the first priority given to
+	// PoolACLs without one, after the priorities usually set explicitly.
+	defaultAdminNetworkPolicyPriority = 500
+	adminNetworkPolicyMaxPriority     = 1000
+)
+
+type adminNetworkPolicySpec struct {
+	Priority *int32                    `json:"priority,omitempty"`
+	Subject  adminNetworkPolicySubject `json:"subject"`
+	Egress   []adminNetworkPolicyRule  `json:"egress,omitempty"`
+}
+
+type adminNetworkPolicySubject struct {
+	Pods *adminNetworkPolicyPods `json:"pods,omitempty"`
+}
+
+type adminNetworkPolicyPods struct {
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+	PodSelector       metav1.LabelSelector `json:"podSelector"`
+}
+
+type adminNetworkPolicyRule struct {
+	Name   string                   `json:"name"`
+	Action string                   `json:"action"`
+	To     []adminNetworkPolicyPeer `json:"to"`
+	Ports  []adminNetworkPolicyPort `json:"ports,omitempty"`
+}
+
+type adminNetworkPolicyPeer struct {
+	Namespaces *metav1.LabelSelector   `json:"namespaces,omitempty"`
+	Pods       *adminNetworkPolicyPods `json:"pods,omitempty"`
+	Networks   []string                `json:"networks,omitempty"`
+}
+
+type adminNetworkPolicyPort struct {
+	PortNumber *adminNetworkPolicyPortNumber `json:"portNumber,omitempty"`
+	NamedPort  *string                       `json:"namedPort,omitempty"`
+	PortRange  *adminNetworkPolicyPortRange  `json:"portRange,omitempty"`
+}
+
+type adminNetworkPolicyPortNumber struct {
+	Protocol string `json:"protocol"`
+	Port     int32  `json:"port"`
+}
+
+type adminNetworkPolicyPortRange struct {
+	Protocol string `json:"protocol"`
+	Start    int32  `json:"start"`
+	End      int32  `json:"end"`
+}
+
+// PoolACLReconciler reconciles a PoolACL object
+type PoolACLReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// ACLReconciler generates the egress rules of the destinations, the same
+	// way they are generated for ACLs.
+	ACLReconciler *ACLReconciler
+}
+
+//+kubebuilder:rbac:groups=extensions.tsuru.io,resources=poolacls,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=extensions.tsuru.io,resources=poolacls/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=extensions.tsuru.io,resources=poolacls/finalizers,verbs=update
+//+kubebuilder:rbac:groups=policy.networking.k8s.io,resources=adminnetworkpolicies;baselineadminnetworkpolicies,verbs=get;list;watch;create;update;patch;delete
+
+func (r *PoolACLReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	poolACL := &v1alpha1.PoolACL{}
+	err := r.Get(ctx, req.NamespacedName, poolACL)
+	if k8sErrors.IsNotFound(err) {
+		// the removed PoolACL may be merged into the baseline
+		_, err = r.ensureBaselineAdminNetworkPolicy(ctx, nil)
+		if err != nil {
+			l.Error(err, "could not ensure BaselineAdminNetworkPolicy object")
+		}
+		return ctrl.Result{}, err
+	} else if err != nil {
+		l.Error(err, "could not get PoolACL object")
+		return ctrl.Result{}, err
+	}
+
+	oldStatus := poolACL.Status.DeepCopy()
+
+	if poolACL.Spec.Pool == "" {
+		err = r.setUnreadyStatus(ctx, poolACL, "spec.pool is required")
+		return ctrl.Result{}, err
+	}
+
+	egress, egressDeny, ruleErrors, err := r.egressRules(ctx, poolACL)
+	if err != nil {
+		l.Error(err, "could not generate egress rule based on kubernetes selector")
+		err = r.setUnreadyStatus(ctx, poolACL, "could not generate egress rule based on kubernetes selector, err: "+err.Error())
+		return ctrl.Result{}, err
+	}
+
+	poolACL.Status.Egress = egress
+	poolACL.Status.EgressDeny = egressDeny
+	poolACL.Status.RuleErrors = ruleErrors
+	poolACL.Status.Ready = len(ruleErrors) == 0
+	poolACL.Status.Reason = ""
+
+	if len(egress) == 0 && len(egressDeny) == 0 {
+		err = r.setUnreadyStatus(ctx, poolACL, "No egress generated by spec.destinations")
+		return ctrl.Result{}, err
+	}
+
+	if poolACL.Spec.Baseline {
+		poolACL.Status.AdminNetworkPolicy = baselineAdminNetworkPolicyName
+		poolACL.Status.Priority = nil
+		var baselinePool string
+		baselinePool, err = r.ensureBaselineAdminNetworkPolicy(ctx, poolACL)
+		if err == nil && oldStatus.AdminNetworkPolicy != "" && oldStatus.AdminNetworkPolicy != baselineAdminNetworkPolicyName {
+			// the PoolACL was rendered into its own AdminNetworkPolicy before
+			err = r.deleteAdminNetworkPolicy(ctx, oldStatus.AdminNetworkPolicy)
+		}
+		if err == nil && baselinePool != poolACL.Spec.Pool {
+			reason := fmt.Sprintf("the BaselineAdminNetworkPolicy already applies to the pool %s, only one pool may have baseline PoolACLs", baselinePool)
+			poolACL.Status.AdminNetworkPolicy = ""
+			setCondition(&poolACL.Status.Conditions, poolACL.Generation, v1alpha1.ConditionPolicyApplied, false, "BaselinePoolConflict", reason)
+			err = r.setUnreadyStatus(ctx, poolACL, reason)
+			return ctrl.Result{
+				Requeue:      true,
+				RequeueAfter: requeueAfter,
+			}, err
+		}
+	} else {
+		poolACL.Status.AdminNetworkPolicy = adminNetworkPolicyName(poolACL)
+		err = r.ensureAdminNetworkPolicy(ctx, poolACL)
+		if err == nil && oldStatus.AdminNetworkPolicy == baselineAdminNetworkPolicyName {
+			// the PoolACL is no longer part of the baseline
+			_, err = r.ensureBaselineAdminNetworkPolicy(ctx, poolACL)
+		}
+	}
+	if err != nil {
+		l.Error(err, "could not ensure admin network policy object")
+		setCondition(&poolACL.Status.Conditions, poolACL.Generation, v1alpha1.ConditionPolicyApplied, false, "ApplyFailed", err.Error())
+		statusErr := r.setUnreadyStatus(ctx, poolACL, "could not ensure admin network policy object, err: "+err.Error())
+		if statusErr != nil {
+			l.Error(statusErr, "could not update status")
+		}
+		return ctrl.Result{}, err
+	}
+
+	setCondition(&poolACL.Status.Conditions, poolACL.Generation, v1alpha1.ConditionPolicyApplied, true, "PolicyApplied", "")
+	setPoolACLConditions(poolACL)
+
+	if !reflect.DeepEqual(oldStatus, &poolACL.Status) {
+		err = r.Status().Update(ctx, poolACL)
+		if err != nil {
+			l.Error(err, "could not update status for PoolACL object")
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{
+		Requeue:      true,
+		RequeueAfter: requeueAfter,
+	}, nil
+}
+
+func (r *PoolACLReconciler) setUnreadyStatus(ctx context.Context, poolACL *v1alpha1.PoolACL, reason string) error {
+	l := log.FromContext(ctx)
+
+	poolACL.Status.Ready = false
+	poolACL.Status.Reason = reason
+	setPoolACLConditions(poolACL)
+
+	err := r.Status().Update(ctx, poolACL)
+	if err != nil {
+		l.Error(err, "could not update poolACL status")
+	}
+	return err
+}
+
+// egressRules generates the allow and deny rules of the destinations using
+// the ACLReconciler, admin network policies only allow IP based destinations,
+// as NetworkPolicies do.
+func (r *PoolACLReconciler) egressRules(ctx context.Context, poolACL *v1alpha1.PoolACL) ([]netv1.NetworkPolicyEgressRule, []netv1.NetworkPolicyEgressRule, []v1alpha1.ACLStatusRuleError, error) {
+	egress := []netv1.NetworkPolicyEgressRule{}
+	egressDeny := []netv1.NetworkPolicyEgressRule{}
+	ruleErrors := []v1alpha1.ACLStatusRuleError{}
+
+	for _, destination := range poolACL.Spec.Destinations {
+		err := (&networkPolicyBackend{}).validatePeers(destination)
+		if err == nil {
+			var egressRules []netv1.NetworkPolicyEgressRule
+			egressRules, err = r.ACLReconciler.egressRulesForDestination(ctx, destination)
+			if destination.Action == v1alpha1.ACLActionDeny {
+				egressDeny = append(egressDeny, egressRules...)
+			} else {
+				egress = append(egress, egressRules...)
+			}
+		}
+
+		if err != nil {
+			ruleErrors = append(ruleErrors, v1alpha1.ACLStatusRuleError{
+				RuleID: ruleIDForDestination(destination),
+				Error:  err.Error(),
+			})
+		}
+	}
+
+	sort.Slice(ruleErrors, func(i, j int) bool {
+		return ruleErrors[i].RuleID < ruleErrors[j].RuleID
+	})
+
+	egress, err := r.ACLReconciler.fillPodSelectorByCIDR(ctx, egress)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	egressDeny, err = r.ACLReconciler.fillPodSelectorByCIDR(ctx, egressDeny)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(egress) == 0 {
+		egress = nil
+	}
+	if len(egressDeny) == 0 {
+		egressDeny = nil
+	}
+	if len(ruleErrors) == 0 {
+		ruleErrors = nil
+	}
+
+	return egress, egressDeny, ruleErrors, nil
+}
+
+func (r *PoolACLReconciler) ensureAdminNetworkPolicy(ctx context.Context, poolACL *v1alpha1.PoolACL) error {
+	egress := adminNetworkPolicyRules("", poolACL.Spec.Pool, poolACL.Status.EgressDeny, "Deny", "Pass")
+	egress = append(egress, adminNetworkPolicyRules("", poolACL.Spec.Pool, poolACL.Status.Egress, "Allow", "Pass")...)
+	if len(egress) > adminNetworkPolicyMaxRules {
+		return fmt.Errorf("%d egress rules generated, AdminNetworkPolicy supports up to %d", len(egress), adminNetworkPolicyMaxRules)
+	}
+
+	priority, err := r.adminNetworkPolicyPriority(ctx, poolACL)
+	if err != nil {
+		return err
+	}
+
+	poolACL.Status.Priority = &priority
+
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&adminNetworkPolicySpec{
+		Priority: &priority,
+		Subject:  adminNetworkPolicySubjectForPool(poolACL.Spec.Pool),
+		Egress:   egress,
+	})
+	if err != nil {
+		return err
+	}
+
+	adminNetworkPolicy := &unstructured.Unstructured{}
+	adminNetworkPolicy.SetGroupVersionKind(adminNetworkPolicyGVK)
+	adminNetworkPolicy.SetName(adminNetworkPolicyName(poolACL))
+	adminNetworkPolicy.SetOwnerReferences([]metav1.OwnerReference{
+		*metav1.NewControllerRef(poolACL, v1alpha1.GroupVersion.WithKind("PoolACL")),
+	})
+	adminNetworkPolicy.Object["spec"] = spec
+
+	_, err = ensureUnstructured(ctx, r.Client, adminNetworkPolicy)
+	return err
+}
+
+// adminNetworkPolicyPriority returns the priority of the AdminNetworkPolicy
+// of the PoolACL. Tied priorities leave the order of the policies undefined,
+// so the PoolACLs without a priority get the lowest one not taken by other
+// PoolACLs. The given priority is kept in the status, so it doesn't shift when
+// other PoolACLs are created or removed.
+func (r *PoolACLReconciler) adminNetworkPolicyPriority(ctx context.Context, poolACL *v1alpha1.PoolACL) (int32, error) {
+	if poolACL.Spec.Priority != nil {
+		return *poolACL.Spec.Priority, nil
+	}
+
+	list := &v1alpha1.PoolACLList{}
+	err := r.List(ctx, list)
+	if err != nil {
+		return 0, err
+	}
+
+	current := poolACL.Status.Priority
+	unavailable := map[int32]bool{}
+	taken := map[int32]bool{}
+	for _, item := range list.Items {
+		if item.Spec.Baseline || item.Name == poolACL.Name {
+			continue
+		}
+		if item.Spec.Priority != nil {
+			unavailable[*item.Spec.Priority] = true
+			taken[*item.Spec.Priority] = true
+			continue
+		}
+		if item.Status.Priority == nil {
+			continue
+		}
+		taken[*item.Status.Priority] = true
+
+		if current != nil && *current == *item.Status.Priority && poolACLCreatedBefore(&item, poolACL) {
+			// both were given the same priority, the older PoolACL keeps it
+			unavailable[*current] = true
+		}
+	}
+
+	if current != nil && !unavailable[*current] {
+		return *current, nil
+	}
+
+	priority := int32(defaultAdminNetworkPolicyPriority)
+	for taken[priority] {
+		priority++
+	}
+
+	if priority > adminNetworkPolicyMaxPriority {
+		return 0, fmt.Errorf("no AdminNetworkPolicy priority left for PoolACLs without spec.priority, the maximum is %d", adminNetworkPolicyMaxPriority)
+	}
+	return priority, nil
+}
+
+func poolACLCreatedBefore(a, b *v1alpha1.PoolACL) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+func (r *PoolACLReconciler) deleteAdminNetworkPolicy(ctx context.Context, name string) error {
+	adminNetworkPolicy := &unstructured.Unstructured{}
+	adminNetworkPolicy.SetGroupVersionKind(adminNetworkPolicyGVK)
+	adminNetworkPolicy.SetName(name)
+
+	err := r.Delete(ctx, adminNetworkPolicy)
+	if k8sErrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// ensureBaselineAdminNetworkPolicy merges the rules of the baseline PoolACLs
+// into the BaselineAdminNetworkPolicy and returns the pool it applies to.
+// Its single subject would share the rules of every PoolACL with all the
+// pools, so only the PoolACLs of the pool of the oldest baseline PoolACL are
+// rendered. current replaces the listed PoolACL of the same name, the cache
+// may not have its new status yet.
+func (r *PoolACLReconciler) ensureBaselineAdminNetworkPolicy(ctx context.Context, current *v1alpha1.PoolACL) (string, error) {
+	list := &v1alpha1.PoolACLList{}
+	err := r.List(ctx, list)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := []v1alpha1.PoolACL{}
+	for _, poolACL := range list.Items {
+		if current != nil && poolACL.Name == current.Name {
+			poolACL = *current
+		}
+		if poolACL.Spec.Baseline && (len(poolACL.Status.Egress) > 0 || len(poolACL.Status.EgressDeny) > 0) {
+			candidates = append(candidates, poolACL)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if !candidates[i].CreationTimestamp.Equal(&candidates[j].CreationTimestamp) {
+			return candidates[i].CreationTimestamp.Before(&candidates[j].CreationTimestamp)
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+
+	pool := ""
+	baselines := []v1alpha1.PoolACL{}
+	for _, poolACL := range candidates {
+		if pool == "" {
+			pool = poolACL.Spec.Pool
+		}
+		if poolACL.Spec.Pool == pool {
+			baselines = append(baselines, poolACL)
+		}
+	}
+	sort.Slice(baselines, func(i, j int) bool {
+		return baselines[i].Name < baselines[j].Name
+	})
+
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(baselineAdminNetworkPolicyGVK)
+	err = r.Get(ctx, client.ObjectKey{Name: baselineAdminNetworkPolicyName}, existing)
+	notFound := k8sErrors.IsNotFound(err)
+	if err != nil && !notFound {
+		return "", err
+	}
+
+	if len(baselines) == 0 {
+		if notFound || !ownedByPoolACL(existing) {
+			return "", nil
+		}
+		return "", r.Delete(ctx, existing)
+	}
+
+	ownerReferences := []metav1.OwnerReference{}
+	egress := []adminNetworkPolicyRule{}
+	egressDeny := []adminNetworkPolicyRule{}
+	for i := range baselines {
+		ownerReferences = append(ownerReferences, *metav1.NewControllerRef(&baselines[i], v1alpha1.GroupVersion.WithKind("PoolACL")))
+		ownerReferences[i].Controller = nil
+		egress = append(egress, adminNetworkPolicyRules(baselines[i].Name+"-", pool, baselines[i].Status.Egress, "Allow", "")...)
+		// BaselineAdminNetworkPolicy has no Pass action, the excepts are cut
+		// out of the networks so they match no rule instead of being allowed
+		egressDeny = append(egressDeny, adminNetworkPolicyRules(baselines[i].Name+"-", pool, baselines[i].Status.EgressDeny, "Deny", "")...)
+	}
+	egress = append(egressDeny, egress...)
+
+	if len(egress) > adminNetworkPolicyMaxRules {
+		return pool, fmt.Errorf("%d egress rules generated by baseline PoolACLs, BaselineAdminNetworkPolicy supports up to %d", len(egress), adminNetworkPolicyMaxRules)
+	}
+
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&adminNetworkPolicySpec{
+		Subject: adminNetworkPolicySubjectForPool(pool),
+		Egress:  egress,
+	})
+	if err != nil {
+		return pool, err
+	}
+
+	if notFound {
+		existing.SetName(baselineAdminNetworkPolicyName)
+		existing.SetOwnerReferences(ownerReferences)
+		existing.Object["spec"] = spec
+		return pool, r.Create(ctx, existing)
+	}
+
+	if reflect.DeepEqual(existing.GetOwnerReferences(), ownerReferences) && reflect.DeepEqual(existing.Object["spec"], spec) {
+		return pool, nil
+	}
+
+	existing.SetOwnerReferences(ownerReferences)
+	existing.Object["spec"] = spec
+	return pool, r.Update(ctx, existing)
+}
+
+func ownedByPoolACL(obj client.Object) bool {
+	for _, ownerReference := range obj.GetOwnerReferences() {
+		if ownerReference.APIVersion == v1alpha1.GroupVersion.String() && ownerReference.Kind == "PoolACL" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func adminNetworkPolicyName(poolACL *v1alpha1.PoolACL) string {
+	return validResourceName("poolacl-" + poolACL.Name)
+}
+
+func adminNetworkPolicySubjectForPool(pool string) adminNetworkPolicySubject {
+	return adminNetworkPolicySubject{
+		Pods: &adminNetworkPolicyPods{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"tsuru.io/app-pool": pool,
+				},
+			},
+		},
+	}
+}
+
+// adminNetworkPolicyRules converts NetworkPolicy egress rules to rules of the
+// given action. The excepts of each IP block become a rule of exceptAction
+// evaluated before the rule of that block, these rules follow the rule of the
+// other peers so the excepts never shadow them. When exceptAction is empty
+// the excepts are subtracted from the networks of the block instead. Pod
+// peers without a namespace selector select the namespace of the pool, as
+// NetworkPolicy peers select the namespace of the policy.
+func adminNetworkPolicyRules(namePrefix, pool string, egressRules []netv1.NetworkPolicyEgressRule, action, exceptAction string) []adminNetworkPolicyRule {
+	result := []adminNetworkPolicyRule{}
+
+	for i, egress := range egressRules {
+		name := fmt.Sprintf("%segress-%d", namePrefix, i)
+		if action == "Deny" {
+			name = fmt.Sprintf("%segress-deny-%d", namePrefix, i)
+		}
+		ports := adminNetworkPolicyPorts(egress.Ports)
+
+		to := []adminNetworkPolicyPeer{}
+		exceptRules := []adminNetworkPolicyRule{}
+		for j, peer := range egress.To {
+			if peer.IPBlock != nil {
+				if len(peer.IPBlock.Except) == 0 {
+					to = append(to, adminNetworkPolicyPeer{Networks: []string{peer.IPBlock.CIDR}})
+				} else if exceptAction == "" {
+					networks := subtractCIDRs(peer.IPBlock.CIDR, peer.IPBlock.Except)
+					if len(networks) > 0 {
+						to = append(to, adminNetworkPolicyPeer{Networks: networks})
+					}
+				} else {
+					peerName := fmt.Sprintf("%s-%d", name, j)
+					exceptRules = append(exceptRules,
+						adminNetworkPolicyRule{
+							Name:   peerName + "-except",
+							Action: exceptAction,
+							To:     []adminNetworkPolicyPeer{{Networks: peer.IPBlock.Except}},
+							Ports:  ports,
+						},
+						adminNetworkPolicyRule{
+							Name:   peerName,
+							Action: action,
+							To:     []adminNetworkPolicyPeer{{Networks: []string{peer.IPBlock.CIDR}}},
+							Ports:  ports,
+						},
+					)
+				}
+				continue
+			}
+
+			if peer.PodSelector == nil {
+				to = append(to, adminNetworkPolicyPeer{Namespaces: peer.NamespaceSelector})
+				continue
+			}
+
+			pods := &adminNetworkPolicyPods{
+				NamespaceSelector: poolNamespaceSelector(pool),
+				PodSelector:       *peer.PodSelector,
+			}
+			if peer.NamespaceSelector != nil {
+				pods.NamespaceSelector = *peer.NamespaceSelector
+			}
+			to = append(to, adminNetworkPolicyPeer{Pods: pods})
+		}
+
+		if len(egress.To) == 0 {
+			to = append(to,
+				adminNetworkPolicyPeer{Namespaces: &metav1.LabelSelector{}},
+				adminNetworkPolicyPeer{Networks: []string{"0.0.0.0/0", "::/0"}},
+			)
+		}
+
+		if len(to) > 0 {
+			result = append(result, adminNetworkPolicyRule{
+				Name:   name,
+				Action: action,
+				To:     to,
+				Ports:  ports,
+			})
+		}
+		result = append(result, exceptRules...)
+	}
+
+	return result
+}
+
+// poolNamespaceSelector selects the namespace of the apps of a tsuru pool.
+func poolNamespaceSelector(pool string) metav1.LabelSelector {
+	return metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"name": "tsuru-" + pool,
+		},
+	}
+}
+
+func adminNetworkPolicyPorts(ports []netv1.NetworkPolicyPort) []adminNetworkPolicyPort {
+	result := []adminNetworkPolicyPort{}
+
+	for _, port := range ports {
+		protocol := string(corev1.ProtocolTCP)
+		if port.Protocol != nil {
+			protocol = string(*port.Protocol)
+		}
+
+		if port.Port == nil {
+			// a port without number matches the whole protocol
+			result = append(result, adminNetworkPolicyPort{PortRange: &adminNetworkPolicyPortRange{
+				Protocol: protocol,
+				Start:    1,
+				End:      65535,
+			}})
+		} else if port.Port.Type != 0 {
+			namedPort := port.Port.StrVal
+			result = append(result, adminNetworkPolicyPort{NamedPort: &namedPort})
+		} else if port.EndPort != nil {
+			result = append(result, adminNetworkPolicyPort{PortRange: &adminNetworkPolicyPortRange{
+				Protocol: protocol,
+				Start:    port.Port.IntVal,
+				End:      *port.EndPort,
+			}})
+		} else {
+			result = append(result, adminNetworkPolicyPort{PortNumber: &adminNetworkPolicyPortNumber{
+				Protocol: protocol,
+				Port:     port.Port.IntVal,
+			}})
+		}
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+
+	return result
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PoolACLReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	adminNetworkPolicy := &unstructured.Unstructured{}
+	adminNetworkPolicy.SetGroupVersionKind(adminNetworkPolicyGVK)
+
+	ctrl, err := ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.PoolACL{}).
+		WithOptions(controller.Options{RecoverPanic: true}).
+		Owns(adminNetworkPolicy).
+		Build(r)
+	if err != nil {
+		return err
+	}
+
+	err = ctrl.Watch(&source.Kind{Type: &v1alpha1.ACLDNSEntry{}},
+		r.enqueuePoolACLsForDestination(func(o client.Object, destination v1alpha1.ACLSpecDestination) bool {
+			dnsEntry, ok := o.(*v1alpha1.ACLDNSEntry)
+			return ok && destination.ExternalDNS != nil && destination.ExternalDNS.Name == dnsEntry.Spec.Host
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = ctrl.Watch(&source.Kind{Type: &v1alpha1.RpaasInstanceAddress{}},
+		r.enqueuePoolACLsForDestination(func(o client.Object, destination v1alpha1.ACLSpecDestination) bool {
+			rpaasInstanceAddress, ok := o.(*v1alpha1.RpaasInstanceAddress)
+			return ok && destination.RpaasInstance != nil &&
+				destination.RpaasInstance.ServiceName == rpaasInstanceAddress.Spec.ServiceName &&
+				destination.RpaasInstance.Instance == rpaasInstanceAddress.Spec.Instance
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = ctrl.Watch(&source.Kind{Type: &v1alpha1.TsuruAppAddress{}},
+		r.enqueuePoolACLsForDestination(func(o client.Object, destination v1alpha1.ACLSpecDestination) bool {
+			tsuruAppAddress, ok := o.(*v1alpha1.TsuruAppAddress)
+			return ok && destination.TsuruApp != "" && destination.TsuruApp == tsuruAppAddress.Spec.Name
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = ctrl.Watch(&source.Kind{Type: &corev1.Service{}},
+		r.enqueuePoolACLsForDestination(func(o client.Object, destination v1alpha1.ACLSpecDestination) bool {
+			return destination.KubernetesService != nil &&
+				destination.KubernetesService.Namespace == o.GetNamespace() &&
+				destination.KubernetesService.Name == o.GetName()
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// enqueuePoolACLsForDestination filters the PoolACLs in memory, there is
+// only a handful of them, usually one per pool.
+func (r *PoolACLReconciler) enqueuePoolACLsForDestination(match func(o client.Object, destination v1alpha1.ACLSpecDestination) bool) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+		list := &v1alpha1.PoolACLList{}
+		err := r.List(context.Background(), list)
+		if err != nil {
+			log.Log.Error(err, "could not list PoolACLs")
+			return nil
+		}
+
+		requests := []reconcile.Request{}
+		for _, poolACL := range list.Items {
+			for _, destination := range poolACL.Spec.Destinations {
+				if match(o, destination) {
+					requests = append(requests, reconcile.Request{
+						NamespacedName: client.ObjectKeyFromObject(&poolACL),
+					})
+					break
+				}
+			}
+		}
+
+		return requests
+	})
+}
@@ -0,0 +1,600 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/acl-operator/api/scheme"
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func (suite *ControllerSuite) TestPoolACLReconcilerAdminNetworkPolicy() {
+	ctx := context.Background()
+	priority := int32(20)
+	poolACL := &v1alpha1.PoolACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "my-pool",
+		},
+		Spec: v1alpha1.PoolACLSpec{
+			Pool:     "my-pool",
+			Priority: &priority,
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.1.1.1/32",
+						Ports: v1alpha1.ACLSpecProtoPorts{
+							{Protocol: "tcp", Number: 443},
+						},
+					},
+				},
+				{
+					TsuruAppPool: "logging",
+				},
+				{
+					ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
+						Name: ".example.com",
+					},
+				},
+			},
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(poolACL).Build()
+	reconciler := &PoolACLReconciler{
+		Client: c,
+		Scheme: scheme.Scheme,
+		ACLReconciler: &ACLReconciler{
+			Client:   c,
+			Scheme:   scheme.Scheme,
+			Resolver: &fakeResolver{},
+			TsuruAPI: &fakeTsuruAPI{},
+		},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name: "my-pool",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingPoolACL := &v1alpha1.PoolACL{}
+	err = c.Get(ctx, client.ObjectKeyFromObject(poolACL), existingPoolACL)
+	suite.Require().NoError(err)
+	suite.Assert().False(existingPoolACL.Status.Ready)
+	suite.Assert().Equal("poolacl-my-pool", existingPoolACL.Status.AdminNetworkPolicy)
+	suite.Assert().Equal([]v1alpha1.ACLStatusRuleError{
+		{
+			RuleID: "externalDNS/.example.com",
+			Error:  `wildcard DNS ".example.com" is not supported by the networkpolicy policy backend`,
+		},
+	}, existingPoolACL.Status.RuleErrors)
+
+	adminNetworkPolicy := &unstructured.Unstructured{}
+	adminNetworkPolicy.SetGroupVersionKind(adminNetworkPolicyGVK)
+	err = c.Get(ctx, client.ObjectKey{Name: "poolacl-my-pool"}, adminNetworkPolicy)
+	suite.Require().NoError(err)
+	suite.Require().Len(adminNetworkPolicy.GetOwnerReferences(), 1)
+	suite.Assert().Equal("PoolACL", adminNetworkPolicy.GetOwnerReferences()[0].Kind)
+
+	suite.Assert().Equal(map[string]interface{}{
+		"priority": int64(20),
+		"subject": map[string]interface{}{
+			"pods": map[string]interface{}{
+				"namespaceSelector": map[string]interface{}{},
+				"podSelector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{
+						"tsuru.io/app-pool": "my-pool",
+					},
+				},
+			},
+		},
+		"egress": []interface{}{
+			map[string]interface{}{
+				"name":   "egress-0",
+				"action": "Allow",
+				"to": []interface{}{
+					map[string]interface{}{
+						"networks": []interface{}{"10.1.1.1/32"},
+					},
+				},
+				"ports": []interface{}{
+					map[string]interface{}{
+						"portNumber": map[string]interface{}{
+							"protocol": "TCP",
+							"port":     int64(443),
+						},
+					},
+				},
+			},
+			map[string]interface{}{
+				"name":   "egress-1",
+				"action": "Allow",
+				"to": []interface{}{
+					map[string]interface{}{
+						"pods": map[string]interface{}{
+							"namespaceSelector": map[string]interface{}{
+								"matchLabels": map[string]interface{}{
+									"name": "tsuru-my-pool",
+								},
+							},
+							"podSelector": map[string]interface{}{
+								"matchLabels": map[string]interface{}{
+									"tsuru.io/app-pool": "logging",
+								},
+							},
+						},
+					},
+					map[string]interface{}{
+						"pods": map[string]interface{}{
+							"namespaceSelector": map[string]interface{}{
+								"matchLabels": map[string]interface{}{
+									"name": "tsuru-logging",
+								},
+							},
+							"podSelector": map[string]interface{}{
+								"matchLabels": map[string]interface{}{
+									"tsuru.io/app-pool": "logging",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, adminNetworkPolicy.Object["spec"])
+}
+
+func (suite *ControllerSuite) TestPoolACLReconcilerAdminNetworkPolicyDeny() {
+	ctx := context.Background()
+	poolACL := &v1alpha1.PoolACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "my-pool",
+		},
+		Spec: v1alpha1.PoolACLSpec{
+			Pool: "my-pool",
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.0.0.0/8",
+					},
+				},
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP:     "172.16.0.0/12",
+						Except: []string{"172.16.1.0/24"},
+					},
+				},
+				{
+					Action: v1alpha1.ACLActionDeny,
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP:     "169.254.0.0/16",
+						Except: []string{"169.254.1.0/24"},
+					},
+				},
+			},
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(poolACL).Build()
+	reconciler := &PoolACLReconciler{
+		Client: c,
+		Scheme: scheme.Scheme,
+		ACLReconciler: &ACLReconciler{
+			Client:   c,
+			Scheme:   scheme.Scheme,
+			Resolver: &fakeResolver{},
+			TsuruAPI: &fakeTsuruAPI{},
+		},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name: "my-pool",
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingPoolACL := &v1alpha1.PoolACL{}
+	err = c.Get(ctx, client.ObjectKeyFromObject(poolACL), existingPoolACL)
+	suite.Require().NoError(err)
+	suite.Assert().True(existingPoolACL.Status.Ready)
+	suite.Assert().Len(existingPoolACL.Status.Egress, 2)
+	suite.Assert().Len(existingPoolACL.Status.EgressDeny, 1)
+
+	adminNetworkPolicy := &unstructured.Unstructured{}
+	adminNetworkPolicy.SetGroupVersionKind(adminNetworkPolicyGVK)
+	err = c.Get(ctx, client.ObjectKey{Name: "poolacl-my-pool"}, adminNetworkPolicy)
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal([]interface{}{
+		map[string]interface{}{
+			"name":   "egress-deny-0-0-except",
+			"action": "Pass",
+			"to": []interface{}{
+				map[string]interface{}{
+					"networks": []interface{}{"169.254.1.0/24"},
+				},
+			},
+		},
+		map[string]interface{}{
+			"name":   "egress-deny-0-0",
+			"action": "Deny",
+			"to": []interface{}{
+				map[string]interface{}{
+					"networks": []interface{}{"169.254.0.0/16"},
+				},
+			},
+		},
+		map[string]interface{}{
+			"name":   "egress-0",
+			"action": "Allow",
+			"to": []interface{}{
+				map[string]interface{}{
+					"networks": []interface{}{"10.0.0.0/8"},
+				},
+			},
+		},
+		map[string]interface{}{
+			"name":   "egress-1-0-except",
+			"action": "Pass",
+			"to": []interface{}{
+				map[string]interface{}{
+					"networks": []interface{}{"172.16.1.0/24"},
+				},
+			},
+		},
+		map[string]interface{}{
+			"name":   "egress-1-0",
+			"action": "Allow",
+			"to": []interface{}{
+				map[string]interface{}{
+					"networks": []interface{}{"172.16.0.0/12"},
+				},
+			},
+		},
+	}, adminNetworkPolicy.Object["spec"].(map[string]interface{})["egress"])
+}
+
+func (suite *ControllerSuite) TestPoolACLReconcilerBaselineAdminNetworkPolicy() {
+	ctx := context.Background()
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	poolACLs := []client.Object{}
+	for i, baseline := range []struct {
+		name string
+		pool string
+		ip   string
+	}{
+		{name: "pool-a", pool: "pool-a", ip: "10.1.1.1/32"},
+		{name: "pool-a-extra", pool: "pool-a", ip: "10.1.1.2/32"},
+		{name: "pool-b", pool: "pool-b", ip: "10.2.2.2/32"},
+	} {
+		poolACLs = append(poolACLs, &v1alpha1.PoolACL{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              baseline.name,
+				CreationTimestamp: metav1.NewTime(created.Add(time.Duration(i) * time.Minute)),
+			},
+			Spec: v1alpha1.PoolACLSpec{
+				Pool:     baseline.pool,
+				Baseline: true,
+				Destinations: []v1alpha1.ACLSpecDestination{
+					{
+						ExternalIP: &v1alpha1.ACLSpecExternalIP{
+							IP: baseline.ip,
+						},
+					},
+				},
+			},
+		})
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(poolACLs...).Build()
+	reconciler := &PoolACLReconciler{
+		Client: c,
+		Scheme: scheme.Scheme,
+		ACLReconciler: &ACLReconciler{
+			Client:   c,
+			Scheme:   scheme.Scheme,
+			Resolver: &fakeResolver{},
+			TsuruAPI: &fakeTsuruAPI{},
+		},
+	}
+
+	for _, poolACL := range poolACLs {
+		_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+			NamespacedName: client.ObjectKeyFromObject(poolACL),
+		})
+		suite.Require().NoError(err)
+	}
+
+	subjectForPool := func(pool string) map[string]interface{} {
+		return map[string]interface{}{
+			"pods": map[string]interface{}{
+				"namespaceSelector": map[string]interface{}{},
+				"podSelector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{
+						"tsuru.io/app-pool": pool,
+					},
+				},
+			},
+		}
+	}
+	egressNetworks := func(spec map[string]interface{}) []string {
+		networks := []string{}
+		for _, rule := range spec["egress"].([]interface{}) {
+			for _, peer := range rule.(map[string]interface{})["to"].([]interface{}) {
+				for _, network := range peer.(map[string]interface{})["networks"].([]interface{}) {
+					networks = append(networks, network.(string))
+				}
+			}
+		}
+		return networks
+	}
+
+	baseline := &unstructured.Unstructured{}
+	baseline.SetGroupVersionKind(baselineAdminNetworkPolicyGVK)
+	err := c.Get(ctx, client.ObjectKey{Name: "default"}, baseline)
+	suite.Require().NoError(err)
+	suite.Require().Len(baseline.GetOwnerReferences(), 2)
+
+	spec := baseline.Object["spec"].(map[string]interface{})
+	suite.Assert().Nil(spec["priority"])
+	suite.Assert().Equal(subjectForPool("pool-a"), spec["subject"])
+	egress := spec["egress"].([]interface{})
+	suite.Require().Len(egress, 2)
+	suite.Assert().Equal("pool-a-egress-0", egress[0].(map[string]interface{})["name"])
+	suite.Assert().Equal("pool-a-extra-egress-0", egress[1].(map[string]interface{})["name"])
+	suite.Assert().ElementsMatch([]string{"10.1.1.1/32", "10.1.1.2/32"}, egressNetworks(spec))
+
+	poolB := &v1alpha1.PoolACL{}
+	err = c.Get(ctx, client.ObjectKey{Name: "pool-b"}, poolB)
+	suite.Require().NoError(err)
+	suite.Assert().False(poolB.Status.Ready)
+	suite.Assert().Empty(poolB.Status.AdminNetworkPolicy)
+	suite.Assert().Contains(poolB.Status.Reason, "already applies to the pool pool-a")
+
+	for _, poolACL := range poolACLs[:2] {
+		err = c.Delete(ctx, poolACL)
+		suite.Require().NoError(err)
+		_, err = reconciler.Reconcile(ctx, controllerruntime.Request{
+			NamespacedName: client.ObjectKeyFromObject(poolACL),
+		})
+		suite.Require().NoError(err)
+	}
+	_, err = reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: client.ObjectKeyFromObject(poolACLs[2]),
+	})
+	suite.Require().NoError(err)
+
+	err = c.Get(ctx, client.ObjectKey{Name: "default"}, baseline)
+	suite.Require().NoError(err)
+	suite.Require().Len(baseline.GetOwnerReferences(), 1)
+	suite.Assert().Equal("pool-b", baseline.GetOwnerReferences()[0].Name)
+	spec = baseline.Object["spec"].(map[string]interface{})
+	suite.Assert().Equal(subjectForPool("pool-b"), spec["subject"])
+	suite.Assert().Equal([]string{"10.2.2.2/32"}, egressNetworks(spec))
+
+	err = c.Get(ctx, client.ObjectKey{Name: "pool-b"}, poolB)
+	suite.Require().NoError(err)
+	suite.Assert().True(poolB.Status.Ready)
+	suite.Assert().Equal("default", poolB.Status.AdminNetworkPolicy)
+}
+
+func TestAdminNetworkPolicyRulesExcepts(t *testing.T) {
+	rules := []netv1.NetworkPolicyEgressRule{
+		{
+			To: []netv1.NetworkPolicyPeer{
+				{IPBlock: &netv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}},
+				{IPBlock: &netv1.IPBlock{CIDR: "10.1.1.0/24"}},
+			},
+		},
+	}
+
+	assert.Equal(t, []adminNetworkPolicyRule{
+		{Name: "egress-0", Action: "Allow", To: []adminNetworkPolicyPeer{{Networks: []string{"10.1.1.0/24"}}}},
+		{Name: "egress-0-0-except", Action: "Pass", To: []adminNetworkPolicyPeer{{Networks: []string{"10.1.0.0/16"}}}},
+		{Name: "egress-0-0", Action: "Allow", To: []adminNetworkPolicyPeer{{Networks: []string{"10.0.0.0/8"}}}},
+	}, adminNetworkPolicyRules("", "pool-a", rules, "Allow", "Pass"))
+
+	assert.Equal(t, []adminNetworkPolicyRule{
+		{Name: "pool-a-egress-0", Action: "Allow", To: []adminNetworkPolicyPeer{
+			{Networks: []string{"10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12", "10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9"}},
+			{Networks: []string{"10.1.1.0/24"}},
+		}},
+	}, adminNetworkPolicyRules("pool-a-", "pool-a", rules, "Allow", ""))
+}
+
+func TestAdminNetworkPolicyPorts(t *testing.T) {
+	tcp := corev1.ProtocolTCP
+	udp := corev1.ProtocolUDP
+	endPort := int32(8090)
+	named := "http"
+
+	ports := []netv1.NetworkPolicyPort{
+		{Protocol: &tcp, Port: &intstr.IntOrString{IntVal: 443}},
+		{Protocol: &udp},
+		{Protocol: &tcp, Port: &intstr.IntOrString{IntVal: 8080}, EndPort: &endPort},
+		{Port: &intstr.IntOrString{Type: intstr.String, StrVal: named}},
+	}
+
+	assert.Equal(t, []adminNetworkPolicyPort{
+		{PortNumber: &adminNetworkPolicyPortNumber{Protocol: "TCP", Port: 443}},
+		{PortRange: &adminNetworkPolicyPortRange{Protocol: "UDP", Start: 1, End: 65535}},
+		{PortRange: &adminNetworkPolicyPortRange{Protocol: "TCP", Start: 8080, End: 8090}},
+		{NamedPort: &named},
+	}, adminNetworkPolicyPorts(ports))
+
+	assert.Nil(t, adminNetworkPolicyPorts(nil))
+}
+
+func (suite *ControllerSuite) TestPoolACLReconcilerBaselineAdminNetworkPolicyDenyExcept() {
+	ctx := context.Background()
+	poolACL := &v1alpha1.PoolACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "my-pool",
+		},
+		Spec: v1alpha1.PoolACLSpec{
+			Pool:     "my-pool",
+			Baseline: true,
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					Action: v1alpha1.ACLActionDeny,
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP:     "169.254.0.0/16",
+						Except: []string{"169.254.0.0/17"},
+					},
+				},
+			},
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(poolACL).Build()
+	reconciler := &PoolACLReconciler{
+		Client: c,
+		Scheme: scheme.Scheme,
+		ACLReconciler: &ACLReconciler{
+			Client:   c,
+			Scheme:   scheme.Scheme,
+			Resolver: &fakeResolver{},
+			TsuruAPI: &fakeTsuruAPI{},
+		},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: client.ObjectKeyFromObject(poolACL),
+	})
+	suite.Require().NoError(err)
+
+	baseline := &unstructured.Unstructured{}
+	baseline.SetGroupVersionKind(baselineAdminNetworkPolicyGVK)
+	err = c.Get(ctx, client.ObjectKey{Name: "default"}, baseline)
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal([]interface{}{
+		map[string]interface{}{
+			"name":   "my-pool-egress-deny-0",
+			"action": "Deny",
+			"to": []interface{}{
+				map[string]interface{}{
+					"networks": []interface{}{"169.254.128.0/17"},
+				},
+			},
+		},
+	}, baseline.Object["spec"].(map[string]interface{})["egress"])
+}
+
+func (suite *ControllerSuite) TestPoolACLReconcilerAdminNetworkPolicyDefaultPriority() {
+	ctx := context.Background()
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	explicitPriority := int32(defaultAdminNetworkPolicyPriority)
+	poolACLs := []client.Object{}
+	for i, name := range []string{"pool-a", "pool-b", "pool-c"} {
+		poolACL := &v1alpha1.PoolACL{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(created.Add(time.Duration(i) * time.Minute)),
+			},
+			Spec: v1alpha1.PoolACLSpec{
+				Pool: name,
+				Destinations: []v1alpha1.ACLSpecDestination{
+					{
+						ExternalIP: &v1alpha1.ACLSpecExternalIP{
+							IP: "10.1.1.1/32",
+						},
+					},
+				},
+			},
+		}
+		if name == "pool-c" {
+			poolACL.Spec.Priority = &explicitPriority
+		}
+		poolACLs = append(poolACLs, poolACL)
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(poolACLs...).Build()
+	reconciler := &PoolACLReconciler{
+		Client: c,
+		Scheme: scheme.Scheme,
+		ACLReconciler: &ACLReconciler{
+			Client:   c,
+			Scheme:   scheme.Scheme,
+			Resolver: &fakeResolver{},
+			TsuruAPI: &fakeTsuruAPI{},
+		},
+	}
+
+	expectedPriorities := map[string]int64{
+		"poolacl-pool-a": defaultAdminNetworkPolicyPriority + 1,
+		"poolacl-pool-b": defaultAdminNetworkPolicyPriority + 2,
+		"poolacl-pool-c": defaultAdminNetworkPolicyPriority,
+	}
+	for _, poolACL := range poolACLs {
+		_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+			NamespacedName: client.ObjectKeyFromObject(poolACL),
+		})
+		suite.Require().NoError(err)
+	}
+
+	for name, priority := range expectedPriorities {
+		adminNetworkPolicy := &unstructured.Unstructured{}
+		adminNetworkPolicy.SetGroupVersionKind(adminNetworkPolicyGVK)
+		err := c.Get(ctx, client.ObjectKey{Name: name}, adminNetworkPolicy)
+		suite.Require().NoError(err)
+		suite.Assert().Equal(priority, adminNetworkPolicy.Object["spec"].(map[string]interface{})["priority"], name)
+	}
+
+	// removing or creating PoolACLs keeps the priority given to the others
+	err := c.Delete(ctx, poolACLs[0])
+	suite.Require().NoError(err)
+	poolD := &v1alpha1.PoolACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pool-d",
+			CreationTimestamp: metav1.NewTime(created.Add(time.Hour)),
+		},
+		Spec: v1alpha1.PoolACLSpec{
+			Pool: "pool-d",
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{
+					ExternalIP: &v1alpha1.ACLSpecExternalIP{
+						IP: "10.1.1.1/32",
+					},
+				},
+			},
+		},
+	}
+	err = c.Create(ctx, poolD)
+	suite.Require().NoError(err)
+
+	expectedPriorities = map[string]int64{
+		"poolacl-pool-b": defaultAdminNetworkPolicyPriority + 2,
+		"poolacl-pool-d": defaultAdminNetworkPolicyPriority + 1,
+	}
+	for _, name := range []string{"pool-b", "pool-d"} {
+		_, err = reconciler.Reconcile(ctx, controllerruntime.Request{
+			NamespacedName: types.NamespacedName{Name: name},
+		})
+		suite.Require().NoError(err)
+	}
+
+	for name, priority := range expectedPriorities {
+		adminNetworkPolicy := &unstructured.Unstructured{}
+		adminNetworkPolicy.SetGroupVersionKind(adminNetworkPolicyGVK)
+		err = c.Get(ctx, client.ObjectKey{Name: name}, adminNetworkPolicy)
+		suite.Require().NoError(err)
+		suite.Assert().Equal(priority, adminNetworkPolicy.Object["spec"].(map[string]interface{})["priority"], name)
+	}
+
+	poolB := &v1alpha1.PoolACL{}
+	err = c.Get(ctx, client.ObjectKey{Name: "pool-b"}, poolB)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(poolB.Status.Priority)
+	suite.Assert().Equal(int32(defaultAdminNetworkPolicyPriority+2), *poolB.Status.Priority)
+}
@@ -22,8 +22,10 @@ import (
 	"reflect"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -41,6 +43,7 @@ type RpaasInstanceAddressReconciler struct {
 	Scheme   *runtime.Scheme
 	Resolver ACLDNSResolver
 	TsuruAPI tsuruapi.Client
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=extensions.tsuru.io,resources=rpaasinstanceaddresses,verbs=get;list;watch;create;update;patch;delete
@@ -62,8 +65,11 @@ func (r *RpaasInstanceAddressReconciler) Reconcile(ctx context.Context, req ctrl
 	oldStatus := rpaasInstanceAddress.Status.DeepCopy()
 	err = r.FillStatus(ctx, rpaasInstanceAddress)
 	if err != nil {
+		recordEvent(r.Recorder, rpaasInstanceAddress, corev1.EventTypeWarning, eventReasonAddressResolutionFailed, err.Error())
+
 		rpaasInstanceAddress.Status.Ready = false
 		rpaasInstanceAddress.Status.Reason = err.Error()
+		setResourceAddressConditions(&rpaasInstanceAddress.Status, rpaasInstanceAddress.Generation)
 
 		err = r.Client.Status().Update(ctx, rpaasInstanceAddress)
 		if err != nil {
@@ -76,7 +82,10 @@ func (r *RpaasInstanceAddressReconciler) Reconcile(ctx context.Context, req ctrl
 		}, nil
 	}
 
-	if oldStatus.Pool != rpaasInstanceAddress.Status.Pool || oldStatus.Ready != rpaasInstanceAddress.Status.Ready || !reflect.DeepEqual(oldStatus.IPs, rpaasInstanceAddress.Status.IPs) {
+	setResourceAddressConditions(&rpaasInstanceAddress.Status, rpaasInstanceAddress.Generation)
+
+	if oldStatus.Pool != rpaasInstanceAddress.Status.Pool || oldStatus.Ready != rpaasInstanceAddress.Status.Ready || !reflect.DeepEqual(oldStatus.IPs, rpaasInstanceAddress.Status.IPs) ||
+		oldStatus.ObservedGeneration != rpaasInstanceAddress.Status.ObservedGeneration || !reflect.DeepEqual(oldStatus.Conditions, rpaasInstanceAddress.Status.Conditions) {
 		err = r.Client.Status().Update(ctx, rpaasInstanceAddress)
 		if err != nil {
 			return ctrl.Result{}, err
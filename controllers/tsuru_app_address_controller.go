@@ -25,8 +25,10 @@ import (
 	"sort"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -45,6 +47,7 @@ type TsuruAppAddressReconciler struct {
 	Scheme   *runtime.Scheme
 	Resolver ACLDNSResolver
 	TsuruAPI tsuruapi.Client
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=extensions.tsuru.io,resources=tsuruappaddresses,verbs=get;list;watch;create;update;patch;delete
@@ -67,12 +70,16 @@ func (r *TsuruAppAddressReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	err = r.FillStatus(ctx, appAddress)
 	if err != nil {
 		l.Error(err, "could not fill TsuruAppAddress status")
+		recordEvent(r.Recorder, appAddress, corev1.EventTypeWarning, eventReasonAddressResolutionFailed, err.Error())
 
 		appAddress.Status.Ready = false
 		appAddress.Status.Reason = err.Error()
 	}
 
-	if oldStatus.Pool != appAddress.Status.Pool || oldStatus.Ready != appAddress.Status.Ready || !reflect.DeepEqual(oldStatus.IPs, appAddress.Status.IPs) || oldStatus.Reason != appAddress.Status.Reason {
+	setResourceAddressConditions(&appAddress.Status, appAddress.Generation)
+
+	if oldStatus.Pool != appAddress.Status.Pool || oldStatus.Ready != appAddress.Status.Ready || !reflect.DeepEqual(oldStatus.IPs, appAddress.Status.IPs) || oldStatus.Reason != appAddress.Status.Reason ||
+		oldStatus.ObservedGeneration != appAddress.Status.ObservedGeneration || !reflect.DeepEqual(oldStatus.Conditions, appAddress.Status.Conditions) {
 		err = r.Status().Update(ctx, appAddress)
 		return ctrl.Result{}, err
 	}
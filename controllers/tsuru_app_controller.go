@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"sort"
 
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
@@ -60,7 +61,81 @@ func (r *TsuruAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
+	// rules scoped to a process are enforced by an ACL of their own, the
+	// rules of the whole app apply to the pods of every process
+	rulesByProcess := map[string][]aclapi.Rule{"": nil}
+	for _, rule := range rules {
+		process := ""
+		if rule.Source.TsuruApp != nil {
+			process = rule.Source.TsuruApp.ProcessName
+		}
+		rulesByProcess[process] = append(rulesByProcess[process], rule)
+	}
+
+	existingACLs := &v1alpha1.ACLList{}
+	err = r.List(ctx, existingACLs, client.InNamespace(app.Spec.NamespaceName))
+	if err != nil {
+		l.Error(err, "could not list ACL objects")
+		return ctrl.Result{}, err
+	}
+	for _, acl := range existingACLs.Items {
+		process := acl.Spec.Source.TsuruAppProcess
+		if acl.Spec.Source.TsuruApp != app.Name || process == "" || acl.Name != tsuruAppProcessACLName(app.Name, process) {
+			continue
+		}
+		if _, found := rulesByProcess[process]; !found {
+			rulesByProcess[process] = nil // the ACL is removed
+		}
+	}
+
+	processes := make([]string, 0, len(rulesByProcess))
+	for process := range rulesByProcess {
+		processes = append(processes, process)
+	}
+	sort.Strings(processes)
+
+	requeue := false
+	for _, process := range processes {
+		key := client.ObjectKey{
+			Name:      app.Name,
+			Namespace: app.Spec.NamespaceName,
+		}
+		if process != "" {
+			key.Name = tsuruAppProcessACLName(app.Name, process)
+		}
+
+		exists, err := ensureTsuruACL(ctx, r.Client, key, v1alpha1.ACLSpecSource{
+			TsuruApp:        app.Name,
+			TsuruAppProcess: process,
+		}, rulesByProcess[process])
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		requeue = requeue || exists
+	}
+
+	if !requeue {
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{
+		Requeue:      true,
+		RequeueAfter: requeueAfter,
+	}, nil
+}
+
+func tsuruAppProcessACLName(appName, process string) string {
+	return validResourceName(appName + "-process-" + process)
+}
+
+// ensureTsuruACL creates, updates or removes the ACL generated from the rules
+// of the ACL API, the ACL is removed when the rules have no destinations. It
+// returns true when the ACL exists after the call.
+func ensureTsuruACL(ctx context.Context, c client.Client, key client.ObjectKey, source v1alpha1.ACLSpecSource, rules []aclapi.Rule) (bool, error) {
+	l := log.FromContext(ctx)
+
 	destinations, errs := convertACLAPIRulesToOperatorRules(rules)
+	destinations = v1alpha1.NormalizeDestinations(destinations)
 
 	warningErrors := []string{}
 	for _, e := range errs {
@@ -68,74 +143,71 @@ func (r *TsuruAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	}
 
 	acl := &v1alpha1.ACL{}
-	err = r.Get(ctx, client.ObjectKey{
-		Name:      app.Name,
-		Namespace: app.Spec.NamespaceName,
-	}, acl)
+	err := c.Get(ctx, key, acl)
 
 	if k8sErrors.IsNotFound(err) {
 		if len(destinations) == 0 {
-			return ctrl.Result{}, nil
+			return false, nil
 		}
 
-		err = r.Create(ctx, &v1alpha1.ACL{
+		acl = &v1alpha1.ACL{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      app.Name,
-				Namespace: app.Spec.NamespaceName,
+				Name:      key.Name,
+				Namespace: key.Namespace,
 			},
 			Spec: v1alpha1.ACLSpec{
-				Source: v1alpha1.ACLSpecSource{
-					TsuruApp: app.Name,
-				},
+				Source:       source,
 				Destinations: destinations,
 			},
-			Status: v1alpha1.ACLStatus{
-				WarningErrors: warningErrors,
-			},
-		})
+		}
+		err = c.Create(ctx, acl)
 		if err != nil {
-			return ctrl.Result{}, err
+			return false, err
+		}
+
+		if len(warningErrors) > 0 {
+			// the status is not stored on create
+			acl.Status.WarningErrors = warningErrors
+			err = c.Status().Update(ctx, acl)
+			if err != nil {
+				l.Error(err, "could not update status of ACL")
+				return true, err
+			}
 		}
 
-		return ctrl.Result{
-			Requeue:      true,
-			RequeueAfter: requeueAfter,
-		}, nil
+		return true, nil
 	} else if err != nil {
 		l.Error(err, "could not get ACL object")
-		return ctrl.Result{}, err
+		return false, err
 	} else if len(destinations) == 0 {
-		err = r.Delete(ctx, acl)
+		err = c.Delete(ctx, acl)
 		if err != nil {
 			l.Error(err, "could not remove unused ACL")
 		}
-		return ctrl.Result{}, nil
+		return false, nil
 	}
 
-	acl.Spec.Source = v1alpha1.ACLSpecSource{
-		TsuruApp: app.Name,
-	}
-	acl.Spec.Destinations = destinations
+	if !reflect.DeepEqual(acl.Spec.Source, source) || !reflect.DeepEqual(acl.Spec.Destinations, destinations) {
+		acl.Spec.Source = source
+		acl.Spec.Destinations = destinations
 
-	err = r.Update(ctx, acl)
-	if err != nil {
-		return ctrl.Result{}, err
+		err = c.Update(ctx, acl)
+		if err != nil {
+			return true, err
+		}
 	}
 
 	if len(warningErrors) > 0 || len(acl.Status.WarningErrors) > 0 {
 		acl.Status.WarningErrors = warningErrors
 
-		err := r.Status().Update(ctx, acl)
+		err := c.Status().Update(ctx, acl)
 		if err != nil {
 			l.Error(err, "could not remove update status of ACL")
-			return ctrl.Result{}, err
+			return true, err
 		}
 	}
 
-	return ctrl.Result{
-		Requeue:      true,
-		RequeueAfter: requeueAfter,
-	}, nil
+	return true, nil
 }
 
 func convertACLAPIRulesToOperatorRules(rules []aclapi.Rule) ([]v1alpha1.ACLSpecDestination, []error) {
@@ -151,78 +223,63 @@ func convertACLAPIRulesToOperatorRules(rules []aclapi.Rule) ([]v1alpha1.ACLSpecD
 			continue
 		}
 
+		destination := v1alpha1.ACLSpecDestination{
+			RuleID: rule.RuleID,
+		}
+
 		if rule.Destination.TsuruApp != nil {
 			if rule.Destination.TsuruApp.AppName != "" {
-				result = append(result, v1alpha1.ACLSpecDestination{
-					RuleID:   rule.RuleID,
-					TsuruApp: rule.Destination.TsuruApp.AppName,
-				})
+				destination.TsuruApp = rule.Destination.TsuruApp.AppName
 			} else if rule.Destination.TsuruApp.PoolName != "" {
-				result = append(result, v1alpha1.ACLSpecDestination{
-					RuleID:       rule.RuleID,
-					TsuruAppPool: rule.Destination.TsuruApp.PoolName,
-				})
+				destination.TsuruAppPool = rule.Destination.TsuruApp.PoolName
+			} else {
+				continue
 			}
 		} else if rule.Destination.ExternalDNS != nil {
-			externalDNS, errs := convertExternalDNSDestination(rule.Destination.ExternalDNS)
-			errors = append(errors, errs...)
-			if result != nil {
-				result = append(result, v1alpha1.ACLSpecDestination{
-					RuleID:      rule.RuleID,
-					ExternalDNS: externalDNS,
-				})
-			}
+			destination.ExternalDNS = convertExternalDNSDestination(rule.Destination.ExternalDNS)
 		} else if rule.Destination.ExternalIP != nil {
-			externalIP, errs := convertExternalIPDestination(rule.Destination.ExternalIP)
-			errors = append(errors, errs...)
-
-			if result != nil {
-				result = append(result, v1alpha1.ACLSpecDestination{
-					RuleID:     rule.RuleID,
-					ExternalIP: externalIP,
-				})
-			}
+			destination.ExternalIP = convertExternalIPDestination(rule.Destination.ExternalIP)
 		} else if rule.Destination.RpaasInstance != nil {
 			rpaasInstance, err := convertRpaasInstanceDestination(rule.Destination.RpaasInstance)
 			if err != nil {
 				errors = append(errors, err)
 				continue
 			}
-			result = append(result, v1alpha1.ACLSpecDestination{
-				RuleID:        rule.RuleID,
-				RpaasInstance: rpaasInstance,
-			})
+			destination.RpaasInstance = rpaasInstance
 		} else if rule.Destination.KubernetesService != nil {
-			err := fmt.Errorf("kubernetes service is not supported yet %v", rule.Destination.KubernetesService)
-			errors = append(errors, err)
+			destination.KubernetesService = convertKubernetesServiceDestination(rule.Destination.KubernetesService)
+		} else {
+			continue
 		}
+
+		// the webhook would reject the whole ACL, only the invalid rule is left out
+		err := v1alpha1.ValidateDestination(destination)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid rule %q: %w", rule.RuleID, err))
+			continue
+		}
+
+		result = append(result, destination)
 	}
 
 	return result, errors
 }
 
-func convertExternalDNSDestination(rule *aclapi.ExternalDNSRule) (*v1alpha1.ACLSpecExternalDNS, []error) {
-	result := &v1alpha1.ACLSpecExternalDNS{
-		Name:  rule.Name,
-		Ports: convertPorts(rule.Ports),
+func convertExternalDNSDestination(rule *aclapi.ExternalDNSRule) *v1alpha1.ACLSpecExternalDNS {
+	return &v1alpha1.ACLSpecExternalDNS{
+		Name:             rule.Name,
+		Ports:            convertPorts(rule.Ports),
+		SyncWholeNetwork: rule.SyncWholeNetwork,
 	}
-	errors := []error{}
-	if rule.SyncWholeNetwork {
-		errors = append(errors, fmt.Errorf("SyncWholeNetwork is not supported for %q", rule.Name))
-	}
-	return result, errors
 }
 
-func convertExternalIPDestination(rule *aclapi.ExternalIPRule) (*v1alpha1.ACLSpecExternalIP, []error) {
-	result := &v1alpha1.ACLSpecExternalIP{
-		IP:    rule.IP,
-		Ports: convertPorts(rule.Ports),
-	}
-	errors := []error{}
-	if rule.SyncWholeNetwork {
-		errors = append(errors, fmt.Errorf("SyncWholeNetwork is not supported for %q", rule.IP))
+func convertExternalIPDestination(rule *aclapi.ExternalIPRule) *v1alpha1.ACLSpecExternalIP {
+	return &v1alpha1.ACLSpecExternalIP{
+		IP:               rule.IP,
+		Ports:            convertPorts(rule.Ports),
+		Except:           rule.Except,
+		SyncWholeNetwork: rule.SyncWholeNetwork,
 	}
-	return result, errors
 }
 
 func convertRpaasInstanceDestination(rule *aclapi.RpaasInstanceRule) (*v1alpha1.ACLSpecRpaasInstance, error) {
@@ -233,6 +290,14 @@ func convertRpaasInstanceDestination(rule *aclapi.RpaasInstanceRule) (*v1alpha1.
 	return result, nil
 }
 
+func convertKubernetesServiceDestination(rule *aclapi.KubernetesServiceRule) *v1alpha1.ACLSpecKubernetesService {
+	return &v1alpha1.ACLSpecKubernetesService{
+		Namespace:   rule.Namespace,
+		Name:        rule.ServiceName,
+		ClusterName: rule.ClusterName,
+	}
+}
+
 func convertPorts(ports aclapi.ProtoPorts) v1alpha1.ACLSpecProtoPorts {
 	result := v1alpha1.ACLSpecProtoPorts{}
 
@@ -240,6 +305,8 @@ func convertPorts(ports aclapi.ProtoPorts) v1alpha1.ACLSpecProtoPorts {
 		result = append(result, v1alpha1.ProtoPort{
 			Protocol: port.Protocol,
 			Number:   port.Port,
+			EndPort:  port.EndPort,
+			Name:     port.Name,
 		})
 	}
 
@@ -50,6 +50,11 @@ func (f *fakeACLAPI) mockRules(_ context.Context, resourceName string) ([]aclapi
 								Protocol: "tcp",
 								Port:     443,
 							},
+							{
+								Protocol: "udp",
+								Port:     10000,
+								EndPort:  20000,
+							},
 						},
 					},
 				},
@@ -106,6 +111,64 @@ func (f *fakeACLAPI) mockRules(_ context.Context, resourceName string) ([]aclapi
 				},
 			},
 		}, nil
+	case "myapp-with-invalid-rules":
+		return []aclapi.Rule{
+			{
+				RuleID: "invalid-ip",
+				Destination: aclapi.RuleType{
+					ExternalIP: &aclapi.ExternalIPRule{
+						IP: "10.1.1.300/32",
+					},
+				},
+			},
+			{
+				RuleID: "invalid-protocol",
+				Destination: aclapi.RuleType{
+					ExternalDNS: &aclapi.ExternalDNSRule{
+						Name: "www.facebook.com",
+						Ports: aclapi.ProtoPorts{
+							{
+								Protocol: "icmp",
+								Port:     80,
+							},
+						},
+					},
+				},
+			},
+			{
+				RuleID: "valid",
+				Destination: aclapi.RuleType{
+					ExternalIP: &aclapi.ExternalIPRule{
+						IP: "10.1.1.1/32",
+					},
+				},
+			},
+		}, nil
+	case "myapp-with-processes":
+		return []aclapi.Rule{
+			{
+				RuleID: "app-wide",
+				Destination: aclapi.RuleType{
+					TsuruApp: &aclapi.TsuruAppRule{
+						AppName: "my-other-app",
+					},
+				},
+			},
+			{
+				RuleID: "worker-only",
+				Source: aclapi.RuleType{
+					TsuruApp: &aclapi.TsuruAppRule{
+						AppName:     "myapp-with-processes",
+						ProcessName: "worker",
+					},
+				},
+				Destination: aclapi.RuleType{
+					ExternalIP: &aclapi.ExternalIPRule{
+						IP: "10.2.2.2/32",
+					},
+				},
+			},
+		}, nil
 	}
 	return nil, nil
 }
@@ -148,7 +211,7 @@ func (suite *ControllerSuite) TestTsuruAppReconcilerSimpleReconcile() {
 			Name: "www.facebook.com",
 			Ports: v1alpha1.ACLSpecProtoPorts{
 				{
-					Protocol: "tcp",
+					Protocol: "TCP",
 					Number:   80,
 				},
 			},
@@ -159,23 +222,28 @@ func (suite *ControllerSuite) TestTsuruAppReconcilerSimpleReconcile() {
 			IP: "10.1.1.1/32",
 			Ports: v1alpha1.ACLSpecProtoPorts{
 				{
-					Protocol: "tcp",
+					Protocol: "TCP",
 					Number:   443,
 				},
+				{
+					Protocol: "UDP",
+					Number:   10000,
+					EndPort:  20000,
+				},
 			},
 		},
 	}, existingACL.Spec.Destinations[1])
-	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
-		TsuruApp: "my-other-app",
-	}, existingACL.Spec.Destinations[2])
-	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
-		TsuruAppPool: "my-other-pool",
-	}, existingACL.Spec.Destinations[3])
 	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
 		RpaasInstance: &v1alpha1.ACLSpecRpaasInstance{
 			ServiceName: "my-service",
 			Instance:    "my-instance",
 		},
+	}, existingACL.Spec.Destinations[2])
+	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
+		TsuruApp: "my-other-app",
+	}, existingACL.Spec.Destinations[3])
+	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
+		TsuruAppPool: "my-other-pool",
 	}, existingACL.Spec.Destinations[4])
 }
 
@@ -332,17 +400,147 @@ func (suite *ControllerSuite) TestTsuruAppReconcilerReconcileAppWithErrors() {
 		Name:      app.Name,
 	}, existingACL)
 	suite.Require().NoError(err)
-	suite.Assert().Len(existingACL.Spec.Destinations, 2)
+	suite.Assert().Len(existingACL.Spec.Destinations, 3)
 	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
 		ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
-			Name: "www.facebook.com",
+			Name:             "www.facebook.com",
+			SyncWholeNetwork: true,
 		},
 	}, existingACL.Spec.Destinations[0])
 	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
 		ExternalIP: &v1alpha1.ACLSpecExternalIP{
-			IP: "10.1.1.1/32",
+			IP:               "10.1.1.1/32",
+			SyncWholeNetwork: true,
 		},
 	}, existingACL.Spec.Destinations[1])
+	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
+		KubernetesService: &v1alpha1.ACLSpecKubernetesService{
+			Namespace: "service",
+			Name:      "blah",
+		},
+	}, existingACL.Spec.Destinations[2])
+
+	suite.Assert().Len(existingACL.Status.WarningErrors, 0)
+}
 
-	suite.Assert().Len(existingACL.Status.WarningErrors, 3)
+func (suite *ControllerSuite) TestTsuruAppReconcilerReconcileAppWithInvalidRules() {
+	ctx := context.Background()
+	app := &tsuruv1.App{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-with-invalid-rules",
+			Namespace: "default",
+		},
+		Spec: tsuruv1.AppSpec{
+			NamespaceName: "tsuru-mypool",
+		},
+	}
+
+	reconciler := &TsuruAppReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(app).Build(),
+		Scheme: scheme.Scheme,
+		ACLAPI: &fakeACLAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      app.Name,
+			Namespace: app.Namespace,
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Get(ctx, types.NamespacedName{
+		Namespace: app.Spec.NamespaceName,
+		Name:      app.Name,
+	}, existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]v1alpha1.ACLSpecDestination{
+		{
+			RuleID: "valid",
+			ExternalIP: &v1alpha1.ACLSpecExternalIP{
+				IP: "10.1.1.1/32",
+			},
+		},
+	}, existingACL.Spec.Destinations)
+	suite.Assert().NoError(existingACL.ValidateCreate())
+
+	suite.Require().Len(existingACL.Status.WarningErrors, 2)
+	suite.Assert().Contains(existingACL.Status.WarningErrors[0], `invalid rule "invalid-ip"`)
+	suite.Assert().Contains(existingACL.Status.WarningErrors[0], "destination.externalIP.ip")
+	suite.Assert().Contains(existingACL.Status.WarningErrors[1], `invalid rule "invalid-protocol"`)
+	suite.Assert().Contains(existingACL.Status.WarningErrors[1], "destination.externalDNS.ports[0].protocol")
+}
+
+func (suite *ControllerSuite) TestTsuruAppReconcilerReconcileAppWithProcesses() {
+	ctx := context.Background()
+	app := &tsuruv1.App{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-with-processes",
+			Namespace: "default",
+		},
+		Spec: tsuruv1.AppSpec{
+			NamespaceName: "tsuru-mypool",
+		},
+	}
+
+	staleACL := &v1alpha1.ACL{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: app.Spec.NamespaceName,
+			Name:      tsuruAppProcessACLName(app.Name, "web"),
+		},
+		Spec: v1alpha1.ACLSpec{
+			Source: v1alpha1.ACLSpecSource{
+				TsuruApp:        app.Name,
+				TsuruAppProcess: "web",
+			},
+			Destinations: []v1alpha1.ACLSpecDestination{
+				{TsuruApp: "removed-app"},
+			},
+		},
+	}
+
+	reconciler := &TsuruAppReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(app, staleACL).Build(),
+		Scheme: scheme.Scheme,
+		ACLAPI: &fakeACLAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      app.Name,
+			Namespace: app.Namespace,
+		},
+	})
+	suite.Require().NoError(err)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Get(ctx, types.NamespacedName{
+		Namespace: app.Spec.NamespaceName,
+		Name:      app.Name,
+	}, existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(v1alpha1.ACLSpecSource{TsuruApp: app.Name}, existingACL.Spec.Source)
+	suite.Assert().Equal([]v1alpha1.ACLSpecDestination{
+		{TsuruApp: "my-other-app", RuleID: "app-wide"},
+	}, existingACL.Spec.Destinations)
+
+	processACL := &v1alpha1.ACL{}
+	err = reconciler.Get(ctx, types.NamespacedName{
+		Namespace: app.Spec.NamespaceName,
+		Name:      "myapp-with-processes-process-worker",
+	}, processACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(v1alpha1.ACLSpecSource{
+		TsuruApp:        app.Name,
+		TsuruAppProcess: "worker",
+	}, processACL.Spec.Source)
+	suite.Assert().Equal([]v1alpha1.ACLSpecDestination{
+		{ExternalIP: &v1alpha1.ACLSpecExternalIP{IP: "10.2.2.2/32"}, RuleID: "worker-only"},
+	}, processACL.Spec.Destinations)
+
+	err = reconciler.Get(ctx, types.NamespacedName{
+		Namespace: staleACL.Namespace,
+		Name:      staleACL.Name,
+	}, &v1alpha1.ACL{})
+	suite.Require().Error(err)
+	suite.Require().True(k8sErrors.IsNotFound(err))
 }
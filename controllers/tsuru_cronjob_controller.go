@@ -22,8 +22,6 @@ import (
 	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
 	aclapi "github.com/tsuru/acl-operator/clients/aclapi"
 	batchv1 "k8s.io/api/batch/v1"
-	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -60,86 +58,30 @@ func (r *TsuruCronJobReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, nil
 	}
 
-	rules, err := r.ACLAPI.JobRules(ctx, jobName)
-	if err != nil {
-		l.Error(err, "could not get Tsuru Job Rules from ACLAPI")
-		return ctrl.Result{}, err
-	}
-
-	destinations, errs := convertACLAPIRulesToOperatorRules(rules)
+	return reconcileTsuruJobACL(ctx, r.Client, r.ACLAPI, job.Namespace, jobName)
+}
 
-	warningErrors := []string{}
-	for _, e := range errs {
-		warningErrors = append(warningErrors, e.Error())
-	}
+// reconcileTsuruJobACL ensures the ACL of a tsuru job, shared by the CronJob
+// and Job reconcilers.
+func reconcileTsuruJobACL(ctx context.Context, c client.Client, aclAPI aclapi.Client, namespace, jobName string) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
 
-	aclName := tsuruJobACLPrefix + jobName
-
-	acl := &v1alpha1.ACL{}
-	err = r.Client.Get(ctx, client.ObjectKey{
-		Name:      aclName,
-		Namespace: job.Namespace,
-	}, acl)
-
-	if k8sErrors.IsNotFound(err) {
-		if len(destinations) == 0 {
-			return ctrl.Result{}, nil
-		}
-
-		err = r.Client.Create(ctx, &v1alpha1.ACL{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      aclName,
-				Namespace: job.Namespace,
-			},
-			Spec: v1alpha1.ACLSpec{
-				Source: v1alpha1.ACLSpecSource{
-					TsuruJob: jobName,
-				},
-				Destinations: destinations,
-			},
-			Status: v1alpha1.ACLStatus{
-				WarningErrors: warningErrors,
-			},
-		})
-		if err != nil {
-			return ctrl.Result{}, err
-		}
-
-		return ctrl.Result{
-			Requeue:      true,
-			RequeueAfter: requeueAfter,
-		}, nil
-	} else if err != nil {
-		l.Error(err, "could not get ACL object")
+	rules, err := aclAPI.JobRules(ctx, jobName)
+	if err != nil {
+		l.Error(err, "could not get Tsuru Job Rules from ACLAPI")
 		return ctrl.Result{}, err
-	} else if len(destinations) == 0 {
-		err = r.Client.Delete(ctx, acl)
-		if err != nil {
-			l.Error(err, "could not remove unused ACL")
-		}
-		return ctrl.Result{}, nil
 	}
 
-	acl.Spec.Source = v1alpha1.ACLSpecSource{
+	exists, err := ensureTsuruACL(ctx, c, client.ObjectKey{
+		Name:      tsuruJobACLPrefix + jobName,
+		Namespace: namespace,
+	}, v1alpha1.ACLSpecSource{
 		TsuruJob: jobName,
-	}
-	acl.Spec.Destinations = destinations
-
-	err = r.Client.Update(ctx, acl)
-	if err != nil {
+	}, rules)
+	if err != nil || !exists {
 		return ctrl.Result{}, err
 	}
 
-	if len(warningErrors) > 0 || len(acl.Status.WarningErrors) > 0 {
-		acl.Status.WarningErrors = warningErrors
-
-		err := r.Client.Status().Update(ctx, acl)
-		if err != nil {
-			l.Error(err, "could not remove update status of ACL")
-			return ctrl.Result{}, err
-		}
-	}
-
 	return ctrl.Result{
 		Requeue:      true,
 		RequeueAfter: requeueAfter,
@@ -51,7 +51,7 @@ func (suite *ControllerSuite) TestTsuruCronJobReconcilerSimpleReconcile() {
 			Name: "www.facebook.com",
 			Ports: v1alpha1.ACLSpecProtoPorts{
 				{
-					Protocol: "tcp",
+					Protocol: "TCP",
 					Number:   80,
 				},
 			},
@@ -62,23 +62,28 @@ func (suite *ControllerSuite) TestTsuruCronJobReconcilerSimpleReconcile() {
 			IP: "10.1.1.1/32",
 			Ports: v1alpha1.ACLSpecProtoPorts{
 				{
-					Protocol: "tcp",
+					Protocol: "TCP",
 					Number:   443,
 				},
+				{
+					Protocol: "UDP",
+					Number:   10000,
+					EndPort:  20000,
+				},
 			},
 		},
 	}, existingACL.Spec.Destinations[1])
-	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
-		TsuruApp: "my-other-app",
-	}, existingACL.Spec.Destinations[2])
-	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
-		TsuruAppPool: "my-other-pool",
-	}, existingACL.Spec.Destinations[3])
 	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
 		RpaasInstance: &v1alpha1.ACLSpecRpaasInstance{
 			ServiceName: "my-service",
 			Instance:    "my-instance",
 		},
+	}, existingACL.Spec.Destinations[2])
+	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
+		TsuruApp: "my-other-app",
+	}, existingACL.Spec.Destinations[3])
+	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
+		TsuruAppPool: "my-other-pool",
 	}, existingACL.Spec.Destinations[4])
 }
 
@@ -234,17 +239,25 @@ func (suite *ControllerSuite) TestTsuruJobReconcilerReconcileJobWithErrors() {
 		Name:      tsuruJobACLPrefix + job.Name,
 	}, existingACL)
 	suite.Require().NoError(err)
-	suite.Assert().Len(existingACL.Spec.Destinations, 2)
+	suite.Assert().Len(existingACL.Spec.Destinations, 3)
 	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
 		ExternalDNS: &v1alpha1.ACLSpecExternalDNS{
-			Name: "www.facebook.com",
+			Name:             "www.facebook.com",
+			SyncWholeNetwork: true,
 		},
 	}, existingACL.Spec.Destinations[0])
 	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
 		ExternalIP: &v1alpha1.ACLSpecExternalIP{
-			IP: "10.1.1.1/32",
+			IP:               "10.1.1.1/32",
+			SyncWholeNetwork: true,
 		},
 	}, existingACL.Spec.Destinations[1])
+	suite.Assert().Equal(v1alpha1.ACLSpecDestination{
+		KubernetesService: &v1alpha1.ACLSpecKubernetesService{
+			Namespace: "service",
+			Name:      "blah",
+		},
+	}, existingACL.Spec.Destinations[2])
 
-	suite.Assert().Len(existingACL.Status.WarningErrors, 3)
+	suite.Assert().Len(existingACL.Status.WarningErrors, 0)
 }
@@ -0,0 +1,80 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	aclapi "github.com/tsuru/acl-operator/clients/aclapi"
+	batchv1 "k8s.io/api/batch/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// TsuruJobReconciler reconciles the Jobs of one-off tsuru jobs, Jobs created
+// by a CronJob are covered by TsuruCronJobReconciler
+type TsuruJobReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	ACLAPI aclapi.Client
+}
+
+func (r *TsuruJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	job := &batchv1.Job{}
+	err := r.Client.Get(ctx, req.NamespacedName, job)
+	if k8sErrors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		l.Error(err, "could not get Job object")
+		return ctrl.Result{}, err
+	}
+
+	if !isTsuruJobRun(job) {
+		return ctrl.Result{}, nil
+	}
+
+	return reconcileTsuruJobACL(ctx, r.Client, r.ACLAPI, job.Namespace, job.Labels[tsuruJobLabel])
+}
+
+// isTsuruJobRun tells whether the Job is a run of a one-off tsuru job, Jobs
+// controlled by a CronJob are runs of scheduled tsuru jobs
+func isTsuruJobRun(o client.Object) bool {
+	if o.GetLabels()[tsuruJobLabel] == "" {
+		return false
+	}
+
+	owner := metav1.GetControllerOf(o)
+	return owner == nil || owner.Kind != "CronJob"
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *TsuruJobReconciler) SetupWithManager(mgr ctrl.Manager, maxConcurrentReconciles int) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&batchv1.Job{}, builder.WithPredicates(predicate.NewPredicateFuncs(isTsuruJobRun))).
+		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrentReconciles, RecoverPanic: true}).
+		Complete(r)
+}
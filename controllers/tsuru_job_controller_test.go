@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/tsuru/acl-operator/api/scheme"
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func (suite *ControllerSuite) TestTsuruJobReconcilerSimpleReconcile() {
+	ctx := context.Background()
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myjob-run",
+			Namespace: "default",
+			Labels: map[string]string{
+				tsuruJobLabel: "myjob",
+			},
+		},
+	}
+
+	reconciler := &TsuruJobReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(job).Build(),
+		Scheme: scheme.Scheme,
+		ACLAPI: &fakeACLAPI{},
+	}
+	result, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      job.Name,
+			Namespace: job.Namespace,
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(requeueAfter, result.RequeueAfter)
+
+	existingACL := &v1alpha1.ACL{}
+	err = reconciler.Get(ctx, types.NamespacedName{
+		Namespace: job.Namespace,
+		Name:      tsuruJobACLPrefix + "myjob",
+	}, existingACL)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(v1alpha1.ACLSpecSource{TsuruJob: "myjob"}, existingACL.Spec.Source)
+	suite.Assert().Len(existingACL.Spec.Destinations, 5)
+}
+
+func (suite *ControllerSuite) TestTsuruJobReconcilerIgnoreCronJobRuns() {
+	ctx := context.Background()
+	isController := true
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myjob-27993720",
+			Namespace: "default",
+			Labels: map[string]string{
+				tsuruJobLabel: "myjob",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: "batch/v1",
+					Kind:       "CronJob",
+					Name:       "myjob",
+					UID:        "cronjob-uid",
+					Controller: &isController,
+				},
+			},
+		},
+	}
+
+	reconciler := &TsuruJobReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(job).Build(),
+		Scheme: scheme.Scheme,
+		ACLAPI: &fakeACLAPI{},
+	}
+	_, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      job.Name,
+			Namespace: job.Namespace,
+		},
+	})
+	suite.Require().NoError(err)
+
+	err = reconciler.Get(ctx, types.NamespacedName{
+		Namespace: job.Namespace,
+		Name:      tsuruJobACLPrefix + "myjob",
+	}, &v1alpha1.ACL{})
+	suite.Require().Error(err)
+	suite.Require().True(k8sErrors.IsNotFound(err))
+}
+
+func (suite *ControllerSuite) TestTsuruJobReconcilerJobNotFound() {
+	ctx := context.Background()
+
+	reconciler := &TsuruJobReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(),
+		Scheme: scheme.Scheme,
+		ACLAPI: &fakeACLAPI{},
+	}
+	result, err := reconciler.Reconcile(ctx, controllerruntime.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "removed-job",
+			Namespace: "default",
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Assert().False(result.Requeue)
+}
+
+func (suite *ControllerSuite) TestIsTsuruJobRun() {
+	isController := true
+	cronJobOwner := []metav1.OwnerReference{
+		{
+			APIVersion: "batch/v1",
+			Kind:       "CronJob",
+			Name:       "myjob",
+			UID:        "cronjob-uid",
+			Controller: &isController,
+		},
+	}
+
+	suite.Assert().True(isTsuruJobRun(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{tsuruJobLabel: "myjob"}},
+	}))
+	suite.Assert().False(isTsuruJobRun(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "other"}},
+	}))
+	suite.Assert().False(isTsuruJobRun(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{tsuruJobLabel: "myjob"}, OwnerReferences: cronJobOwner},
+	}))
+}
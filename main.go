@@ -18,10 +18,13 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -29,7 +32,9 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"github.com/tsuru/acl-operator/api/scheme"
+	v1alpha1 "github.com/tsuru/acl-operator/api/v1alpha1"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -56,6 +61,28 @@ func main() {
 
 	var gcDryRun bool
 
+	var clusterName string
+
+	var wholeNetworkIPv4PrefixLength int
+	var wholeNetworkIPv6PrefixLength int
+
+	var policyBackendName string
+	var calicoPolicyOrder int64
+	var calicoEnterprise bool
+	var enablePoolACLs bool
+	var enableWebhooks bool
+	var defaultACLMode string
+	var maxPolicyEgressPeers int
+	var aggregateCIDRs bool
+	var dnsUpstreams string
+	var dnsCAFile string
+	var dnsMinResolveInterval time.Duration
+	var dnsMaxResolveInterval time.Duration
+	var dnsIPRetention time.Duration
+	var dnsMaxIPs int
+	var dnsKeepResolutions int
+	var dnsHistoryLimit int
+
 	flag.StringVar(&aclAPIAddr, "acl-api-address", "", "The address of ACL API [required]")
 	flag.StringVar(&aclAPIUser, "acl-api-user", "", "The user of ACL API [required]")
 	flag.StringVar(&aclAPIPassword, "acl-api-password", "", "The password of ACL API [required]")
@@ -72,6 +99,28 @@ func main() {
 	flag.BoolVar(&gcDryRun, "gc-dry-run", false,
 		"Enable Dry run for garbage collector")
 
+	flag.StringVar(&clusterName, "cluster-name", "", "The name of the cluster managed by the operator, used to match kubernetesService destinations")
+
+	flag.IntVar(&wholeNetworkIPv4PrefixLength, "whole-network-ipv4-prefix-length", 24, "The prefix length of IPv4 networks allowed by rules with SyncWholeNetwork")
+	flag.IntVar(&wholeNetworkIPv6PrefixLength, "whole-network-ipv6-prefix-length", 64, "The prefix length of IPv6 networks allowed by rules with SyncWholeNetwork")
+
+	flag.StringVar(&policyBackendName, "policy-backend", "", "The kind of policy object used to enforce the ACLs, networkpolicy, cilium or calico (default networkpolicy)")
+	flag.Int64Var(&calicoPolicyOrder, "calico-policy-order", 0, "The order of the calico policies, it must be lower than the order of the policies that may allow the denied destinations (default 100)")
+	flag.BoolVar(&calicoEnterprise, "calico-enterprise", false, "Render the externalDNS destinations as domains of the calico policies, requires Calico Enterprise. Calico OSS allows the resolved addresses of the hosts")
+	flag.BoolVar(&enablePoolACLs, "enable-pool-acls", false, "Enable the PoolACL controller, requires the AdminNetworkPolicy CRDs")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false, "Enable the admission webhooks, requires the webhook server certificates")
+	flag.StringVar(&defaultACLMode, "default-acl-mode", "", "The mode of ACLs without spec.mode, Enforce or Audit (default Enforce)")
+	flag.IntVar(&maxPolicyEgressPeers, "max-policy-egress-peers", 0, "The maximum number of egress peers of a policy object, larger ACLs are split across multiple objects. Disabled by default")
+	flag.StringVar(&dnsUpstreams, "dns-upstreams", "", "Comma separated nameservers used to resolve the ACL hosts, their answers are merged, tls://host[:port] uses DNS over TLS and https:// URLs DNS over HTTPS (default the nameservers of resolv.conf)")
+	flag.StringVar(&dnsCAFile, "dns-ca-file", "", "PEM file with the CA certificates trusted by the DNS over TLS and DNS over HTTPS nameservers, in addition to the system roots")
+	flag.DurationVar(&dnsMinResolveInterval, "dns-min-resolve-interval", 0, "The minimum interval between resolutions of a host, lower record TTLs are raised to it (default 30s)")
+	flag.DurationVar(&dnsMaxResolveInterval, "dns-max-resolve-interval", 0, "The maximum interval between resolutions of a host, also used for records without TTL (default REQUEUE_AFTER)")
+	flag.DurationVar(&dnsIPRetention, "dns-ip-retention", 0, "How long an address no longer answered by the DNS stays allowed (default 168h)")
+	flag.IntVar(&dnsMaxIPs, "dns-max-ips", 0, "The maximum number of addresses kept per host, 0 means unlimited")
+	flag.IntVar(&dnsKeepResolutions, "dns-keep-resolutions", 0, "Remove the addresses missing from the last N resolutions of a host, 0 disables it")
+	flag.IntVar(&dnsHistoryLimit, "dns-history-limit", 0, "The number of resolution results kept on the status of each host (default 10)")
+	flag.BoolVar(&aggregateCIDRs, "aggregate-egress-cidrs", false, "Collapse adjacent IP blocks of the egress rules into their covering CIDRs")
+
 	opts := zap.Options{
 		Development:     true,
 		StacktraceLevel: zapcore.DPanicLevel,
@@ -121,6 +170,123 @@ func main() {
 		gcDryRun = true
 	}
 
+	if clusterName == "" {
+		clusterName = os.Getenv("CLUSTER_NAME")
+	}
+
+	if v := os.Getenv("ENABLE_POOL_ACLS"); v != "" {
+		enablePoolACLs = true
+	}
+
+	if v := os.Getenv("ENABLE_WEBHOOKS"); v != "" {
+		enableWebhooks = true
+	}
+
+	if policyBackendName == "" {
+		policyBackendName = os.Getenv("POLICY_BACKEND")
+	}
+
+	policyBackend, err := controllers.PolicyBackendByName(policyBackendName)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	if v := os.Getenv("CALICO_POLICY_ORDER"); v != "" && calicoPolicyOrder == 0 {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			calicoPolicyOrder = n
+		}
+	}
+
+	if v := os.Getenv("CALICO_ENTERPRISE"); v != "" {
+		calicoEnterprise = true
+	}
+
+	if policyBackend == controllers.CalicoBackend && (calicoPolicyOrder > 0 || calicoEnterprise) {
+		if calicoPolicyOrder == 0 {
+			calicoPolicyOrder = controllers.DefaultCalicoPolicyOrder
+		}
+		policyBackend = controllers.NewCalicoBackend(calicoPolicyOrder, calicoEnterprise)
+	}
+
+	if defaultACLMode == "" {
+		defaultACLMode = os.Getenv("DEFAULT_ACL_MODE")
+	}
+
+	switch v1alpha1.ACLMode(defaultACLMode) {
+	case "", v1alpha1.ACLModeEnforce, v1alpha1.ACLModeAudit:
+	default:
+		fmt.Printf("unknown ACL mode %q\n", defaultACLMode)
+		os.Exit(1)
+	}
+
+	if dnsUpstreams == "" {
+		dnsUpstreams = os.Getenv("DNS_UPSTREAMS")
+	}
+
+	if v := os.Getenv("DNS_MIN_RESOLVE_INTERVAL"); v != "" && dnsMinResolveInterval == 0 {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			dnsMinResolveInterval = d
+		}
+	}
+
+	if v := os.Getenv("DNS_MAX_RESOLVE_INTERVAL"); v != "" && dnsMaxResolveInterval == 0 {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			dnsMaxResolveInterval = d
+		}
+	}
+
+	if v := os.Getenv("DNS_IP_RETENTION"); v != "" && dnsIPRetention == 0 {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			dnsIPRetention = d
+		}
+	}
+
+	if v := os.Getenv("DNS_MAX_IPS"); v != "" && dnsMaxIPs == 0 {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			dnsMaxIPs = n
+		}
+	}
+
+	if v := os.Getenv("DNS_KEEP_RESOLUTIONS"); v != "" && dnsKeepResolutions == 0 {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			dnsKeepResolutions = n
+		}
+	}
+
+	if v := os.Getenv("DNS_HISTORY_LIMIT"); v != "" && dnsHistoryLimit == 0 {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			dnsHistoryLimit = n
+		}
+	}
+
+	dnsRetention := v1alpha1.ACLDNSEntryRetention{
+		MaxIPs:          int32(dnsMaxIPs),
+		KeepResolutions: int32(dnsKeepResolutions),
+	}
+	if dnsIPRetention > 0 {
+		dnsRetention.Duration = &metav1.Duration{Duration: dnsIPRetention}
+	}
+
+	if dnsCAFile == "" {
+		dnsCAFile = os.Getenv("DNS_CA_FILE")
+	}
+
+	var dnsTLSConfig *tls.Config
+	if dnsCAFile != "" {
+		dnsTLSConfig, err = loadDNSTLSConfig(dnsCAFile)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	resolver, err := controllers.NewUpstreamResolver(controllers.ParseNameservers(dnsUpstreams), dnsTLSConfig)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
 	defaultMaxConcurrent := 8
 	if v := os.Getenv("MAX_CONCURRENT_RECONCILES"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n > 0 {
@@ -161,23 +327,58 @@ func main() {
 		os.Exit(1)
 	}
 
-	maxConcurrentReconciles := getMaxConcurrent("MAX_CONCURRENT_RECONCILES_ACL")
-	if err = (&controllers.ACLReconciler{
+	recorder := mgr.GetEventRecorderFor("acl-operator")
+
+	dnsEntryReconciler := &controllers.ACLDNSEntryReconciler{
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
-		Resolver: controllers.DefaultResolver,
-		TsuruAPI: tsuruAPI,
-	}).SetupWithManager(mgr, maxConcurrentReconciles); err != nil {
+		Resolver: resolver,
+		Recorder: recorder,
+
+		MinResolveInterval: dnsMinResolveInterval,
+		MaxResolveInterval: dnsMaxResolveInterval,
+		Retention:          dnsRetention,
+		HistoryLimit:       dnsHistoryLimit,
+	}
+
+	maxConcurrentReconciles := getMaxConcurrent("MAX_CONCURRENT_RECONCILES_ACL")
+	aclReconciler := &controllers.ACLReconciler{
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Resolver:    resolver,
+		TsuruAPI:    tsuruAPI,
+		Recorder:    recorder,
+		ClusterName: clusterName,
+
+		WholeNetworkIPv4PrefixLength: wholeNetworkIPv4PrefixLength,
+		WholeNetworkIPv6PrefixLength: wholeNetworkIPv6PrefixLength,
+
+		PolicyBackend: policyBackend,
+		DefaultMode:   v1alpha1.ACLMode(defaultACLMode),
+
+		MaxPolicyEgressPeers: maxPolicyEgressPeers,
+		AggregateCIDRs:       aggregateCIDRs,
+
+		DNSEntryReconciler: dnsEntryReconciler,
+	}
+	if err = aclReconciler.SetupWithManager(mgr, maxConcurrentReconciles); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ACL")
 		os.Exit(1)
 	}
 
+	if enablePoolACLs {
+		if err = (&controllers.PoolACLReconciler{
+			Client:        mgr.GetClient(),
+			Scheme:        mgr.GetScheme(),
+			ACLReconciler: aclReconciler,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "PoolACL")
+			os.Exit(1)
+		}
+	}
+
 	maxConcurrentReconciles = getMaxConcurrent("MAX_CONCURRENT_RECONCILES_ACL_DNS_ENTRY")
-	if err = (&controllers.ACLDNSEntryReconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Resolver: controllers.DefaultResolver,
-	}).SetupWithManager(mgr, maxConcurrentReconciles); err != nil {
+	if err = dnsEntryReconciler.SetupWithManager(mgr, maxConcurrentReconciles); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ACLDNSEntry")
 		os.Exit(1)
 	}
@@ -202,6 +403,16 @@ func main() {
 			setupLog.Error(err, "unable to create controller", "controller", "TsuruCronJobReconciler")
 			os.Exit(1)
 		}
+
+		maxConcurrentReconciles = getMaxConcurrent("MAX_CONCURRENT_RECONCILES_TSURU_JOB")
+		if err = (&controllers.TsuruJobReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+			ACLAPI: aclapi.New(aclAPIAddr, aclAPIUser, aclAPIPassword),
+		}).SetupWithManager(mgr, maxConcurrentReconciles); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "TsuruJobReconciler")
+			os.Exit(1)
+		}
 	}
 
 	maxConcurrentReconciles = getMaxConcurrent("MAX_CONCURRENT_RECONCILES_RPAAS_INSTANCE")
@@ -217,8 +428,9 @@ func main() {
 	if err = (&controllers.TsuruAppAddressReconciler{
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
-		Resolver: controllers.DefaultResolver,
+		Resolver: resolver,
 		TsuruAPI: tsuruAPI,
+		Recorder: recorder,
 	}).SetupWithManager(mgr, maxConcurrentReconciles); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "TsuruAppAddress")
 		os.Exit(1)
@@ -228,18 +440,29 @@ func main() {
 	if err = (&controllers.RpaasInstanceAddressReconciler{
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
-		Resolver: controllers.DefaultResolver,
+		Resolver: resolver,
 		TsuruAPI: tsuruAPI,
+		Recorder: recorder,
 	}).SetupWithManager(mgr, maxConcurrentReconciles); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "RpaasInstanceAddress")
 		os.Exit(1)
 	}
 
+	if enableWebhooks {
+		if err = (&v1alpha1.ACL{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ACL")
+			os.Exit(1)
+		}
+	}
+
 	gc := &controllers.ACLGarbageCollector{
 		Client:       mgr.GetClient(),
 		DryRunOutput: os.Stdout,
 		DryRun:       gcDryRun,
 		Logger:       ctrl.Log.WithName("acl-gc"),
+		Recorder:     recorder,
+
+		PolicyBackend: policyBackend,
 	}
 	go gc.Run(context.Background())
 
@@ -261,3 +484,22 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// loadDNSTLSConfig trusts the CA certificates of the file in addition to the
+// system roots.
+func loadDNSTLSConfig(caFile string) (*tls.Config, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	return &tls.Config{RootCAs: pool}, nil
+}